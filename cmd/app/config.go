@@ -0,0 +1,18 @@
+package app
+
+import (
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/ratelimit"
+)
+
+// Config keeps settings of the server which are not services
+type Config struct {
+	// LegacyCompat serves un-prefixed /customers routes without authentication
+	LegacyCompat bool
+	// Sunset is the date when deprecated routes are going to be removed
+	Sunset time.Time
+	// LoginRateIP and LoginRatePhone limit token requests per client address and per phone
+	LoginRateIP    ratelimit.Limit
+	LoginRatePhone ratelimit.Limit
+}
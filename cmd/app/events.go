@@ -0,0 +1,177 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/outbox"
+)
+
+// streamEventTypes are events streamed to managers' dashboards
+var streamEventTypes = []string{
+	outbox.EventSaleCreated,
+	outbox.EventProductLowStock,
+	outbox.EventProductPriceChanged,
+}
+
+const (
+	// streamHeartbeat is interval of pings keeping proxies from closing idle
+	// streams, token of the connection is checked again with every ping
+	streamHeartbeat = 15 * time.Second
+	// streamRetry is reconnection delay suggested to clients, in milliseconds
+	streamRetry = 3000
+	// streamResumeLimit is number of missed events sent after reconnection,
+	// older ones are available from /managers/sales
+	streamResumeLimit = 1000
+)
+
+// handleManagerEvents streams new sales, low stock and price changes as
+// Server-Sent Events, Last-Event-ID resumes after the event client has seen
+func (s *Server) handleManagerEvents(w http.ResponseWriter, r *http.Request) {
+	managerID, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		responceError(w, r, apperr.ErrInternal)
+		return
+	}
+
+	query := r.URL.Query()
+	types, err := parseStreamTypes(query.Get("types"))
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = query.Get("last_event_id")
+	}
+	var afterID int64
+	if lastID != "" {
+		afterID, err = strconv.ParseInt(lastID, 10, 64)
+		if err != nil || afterID < 0 {
+			responceError(w, r, apperr.ErrBadRequest.WithDetails(apperr.Detail{
+				Field: "Last-Event-ID", Rule: "type", Message: "must be id of an event",
+			}))
+			return
+		}
+	}
+
+	// subscribe before loading missed events, so none is lost in between
+	subscriber := s.listener.Subscribe(types)
+	defer subscriber.Close()
+
+	ctx := r.Context()
+	log := logger.FromContext(ctx)
+	sent := map[int64]bool{}
+	var missed []*outbox.Event
+	if afterID != 0 {
+		missed, err = s.outboxSvc.EventsAfter(ctx, afterID, types, streamResumeLimit)
+		if err != nil {
+			responceError(w, r, err)
+			return
+		}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	for _, item := range missed {
+		if err == nil {
+			err = writeStreamEvent(w, item)
+			sent[item.ID] = true
+		}
+	}
+	if err != nil {
+		return
+	}
+	flusher.Flush()
+
+	token := r.Header.Get("Authorization")
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.shutdown:
+			return
+		case <-heartbeat.C:
+			// tokens revoked or expired while stream is open end it
+			// unknown tokens give id 0 rather than an error
+			var id int64
+			id, err = s.managersSvc.IDByToken(ctx, token)
+			if err == nil && id != managerID {
+				err = apperr.ErrUnauthorized
+			}
+			if err != nil {
+				log.Info("event stream closed", logger.Err(err))
+				return
+			}
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case item, ok := <-subscriber.C:
+			if !ok {
+				// fell behind, client reconnects with Last-Event-ID
+				return
+			}
+			if sent[item.ID] {
+				delete(sent, item.ID)
+				continue
+			}
+			err = writeStreamEvent(w, item)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeStreamEvent writes event in text/event-stream format
+func writeStreamEvent(w http.ResponseWriter, item *outbox.Event) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", item.ID, item.Type, data)
+	return err
+}
+
+// parseStreamTypes reads comma separated types, empty value is every streamed type
+func parseStreamTypes(value string) ([]string, error) {
+	if value == "" {
+		return streamEventTypes, nil
+	}
+	types := make([]string, 0)
+	for _, eventType := range strings.Split(value, ",") {
+		eventType = strings.TrimSpace(eventType)
+		known := false
+		for _, item := range streamEventTypes {
+			if item == eventType {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, apperr.ErrBadRequest.WithDetails(apperr.Detail{
+				Field: "types", Rule: "oneof", Message: "must be one of " + strings.Join(streamEventTypes, " "),
+			})
+		}
+		types = append(types, eventType)
+	}
+	return types, nil
+}
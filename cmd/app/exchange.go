@@ -0,0 +1,46 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/darkside1809/gosql/pkg/exchange"
+)
+
+// handleManagerGetExchangeRates returns exchange rates, latest first, administrators only
+func (s *Server) handleManagerGetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	items, err := s.exchangeSvc.Rates(r.Context())
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, items)
+}
+
+// handleManagerAddExchangeRate adds rate used by consolidated reports, administrators only
+func (s *Server) handleManagerAddExchangeRate(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &exchange.Rate{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	saved, err := s.exchangeSvc.AddRate(r.Context(), item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, saved)
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/export"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/gorilla/mux"
+)
+
+// handleManagerExport streams customers, products or sales as CSV or XLSX attachment
+func (s *Server) handleManagerExport(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	entity := mux.Vars(r)["entity"]
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	filter, err := export.ParseFilter(r.URL.Query())
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	body := &countingWriter{w: w}
+	out, err := export.NewWriter(format, body, entity)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+entity+"-"+time.Now().Format("20060102")+"."+format+`"`)
+	err = s.exportSvc.Export(r.Context(), entity, filter, out)
+	if err == nil {
+		return
+	}
+	if body.n == 0 {
+		w.Header().Del("Content-Disposition")
+		responceError(w, r, err)
+		return
+	}
+	// status is sent already, connection is aborted so client doesn't keep truncated file
+	logger.FromContext(r.Context()).Error("export aborted", logger.Err(err))
+	panic(http.ErrAbortHandler)
+}
+
+// countingWriter tells whether anything was written to the response
+type countingWriter struct {
+	w http.ResponseWriter
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
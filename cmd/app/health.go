@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/buildinfo"
+	"github.com/darkside1809/gosql/pkg/logger"
+)
+
+// schemaVersion is the migration the code expects, bump it together with
+// new file in migrations directory
+const schemaVersion = 17
+
+// readyTimeout limits time spent by readiness checks
+const readyTimeout = 2 * time.Second
+
+// Health is response of /healthz and /readyz
+type Health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+// BeginShutdown makes /readyz fail so the orchestrator stops routing
+// traffic before the listener is closed, event streams are ended so
+// clients reconnect to other instances
+func (s *Server) BeginShutdown() {
+	if atomic.CompareAndSwapInt32(&s.shuttingDown, 0, 1) {
+		close(s.shutdown)
+	}
+}
+
+func (s *Server) isShuttingDown() bool {
+	return atomic.LoadInt32(&s.shuttingDown) == 1
+}
+
+// handleHealthz reports that process is alive and serving
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	responceByJson(w, &Health{Status: statusOK})
+}
+
+// handleReadyz reports whether instance may receive traffic
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	checks := map[string]string{
+		"database":   statusOK,
+		"migrations": statusOK,
+		"shutdown":   statusOK,
+	}
+	ready := true
+	fail := func(name string, err error) {
+		ready = false
+		checks[name] = statusFail + ": " + err.Error()
+		logger.FromContext(ctx).Warn("readiness check failed", logger.F("check", name), logger.Err(err))
+	}
+
+	if s.isShuttingDown() {
+		ready = false
+		checks["shutdown"] = statusFail + ": shutting down"
+	}
+	err := s.pool.Ping(ctx)
+	if err != nil {
+		fail("database", err)
+		checks["migrations"] = statusFail + ": database is unavailable"
+	} else {
+		err = s.checkSchemaVersion(ctx)
+		if err != nil {
+			fail("migrations", err)
+		}
+	}
+
+	health := &Health{Status: statusOK, Checks: checks}
+	if !ready {
+		health.Status = statusFail
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	responceByJson(w, health)
+}
+
+type schemaVersionError struct {
+	current int64
+}
+
+func (e *schemaVersionError) Error() string {
+	return "schema version " + strconv.FormatInt(e.current, 10) + ", expected " + strconv.Itoa(schemaVersion)
+}
+
+// checkSchemaVersion compares last applied migration with schemaVersion
+func (s *Server) checkSchemaVersion(ctx context.Context) error {
+	var current int64
+	err := s.pool.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if current != schemaVersion {
+		return &schemaVersionError{current: current}
+	}
+	return nil
+}
+
+// handleVersion reports build information of the binary
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	responceByJson(w, buildinfo.Get())
+}
@@ -1,12 +1,12 @@
 package app
 
 import (
+	"mime"
 	"net/http"
-	"encoding/json"
-	"log"
 	"strconv"
 
-	"github.com/darkside1809/gosql/cmd/app/middleware"
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
 	"github.com/darkside1809/gosql/pkg/managers"
 	"github.com/darkside1809/gosql/pkg/customers"
 	"github.com/gorilla/mux"
@@ -14,43 +14,27 @@ import (
 
 
 func (s *Server) handleManagerRegistrations(w http.ResponseWriter, r *http.Request) {
-	id, err := middleware.Authentication(r.Context())
+	id, err := authenticatedID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
-	if id == 0 {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-		return
-	}
-
-	var item struct {
-		ID 	int64		`json:"id"`
-		Name 	string	`json:"name"`
-		Phone string	`json:"phone"`
-		Roles	[]string	`json:"roles"`
-	}
 
-
-	err = json.NewDecoder(r.Body).Decode(&item)
+	item := &managers.Registration{}
+	err = decodeJSON(w, r, item)
 	if err != nil {
-		log.Print("Can't decode login and password")
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
 
 	Admin := "ADMIN"
 	administrator := s.managersSvc.IsAdmin(r.Context(), id)
 	if administrator != true {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, managers.ErrNotAdmin)
 		return
 	}
 
 	itemManager := &managers.Manager{
-		ID:	 item.ID,
 		Name:  item.Name,
 		Phone: item.Phone,
 	}
@@ -62,52 +46,36 @@ func (s *Server) handleManagerRegistrations(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	token, err := s.managersSvc.Register(r.Context(), itemManager)
+	invitation, err := s.managersSvc.Register(r.Context(), itemManager)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
-	responceByJson(w, map[string]interface{}{"token": token})
+	responceByJson(w, invitation)
 }
 
 func (s *Server) handleManagerRegistration(w http.ResponseWriter, r *http.Request) {
-	id, err := middleware.Authentication(r.Context())
+	id, err := authenticatedID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-	if id == 0 {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		responceError(w, r, err)
 		return
 	}
 
 	const Admin = "ADMIN"
-	var registrationItem struct {
-		ID    int64    `json:"id"`
-		Name  string   `json:"name"`
-		Phone string   `json:"phone"`
-		Roles []string `json:"roles"`
-	}
-
-	err = json.NewDecoder(r.Body).Decode(&registrationItem)
+	registrationItem := &managers.Registration{}
+	err = decodeJSON(w, r, registrationItem)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
 
 	administrator := s.managersSvc.IsAdmin(r.Context(),id)
 	if administrator != true {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, managers.ErrNotAdmin)
 		return
 	}
 
 	item := &managers.Manager{
-		ID:    registrationItem.ID,
 		Name:  registrationItem.Name,
 		Phone: registrationItem.Phone,
 	}
@@ -119,251 +87,385 @@ func (s *Server) handleManagerRegistration(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	token, err := s.managersSvc.Register(r.Context(), item)
+	invitation, err := s.managersSvc.Register(r.Context(), item)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
-	responceByJson(w, map[string]interface{}{"token": token})
+	responceByJson(w, invitation)
 }
 
 func (s *Server) handleManagerGetToken(w http.ResponseWriter, r *http.Request) {
-	var item *managers.Manager
+	item := &managers.Credentials{}
 
-	err := json.NewDecoder(r.Body).Decode(&item)
+	err := decodeJSON(w, r, item)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
 
-	token, err := s.managersSvc.Token(r.Context(), item.Phone, item.Password)
+	login, err := s.managersSvc.Token(r.Context(), item.Phone, item.Password)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
-	responceByJson(w, map[string]interface{}{"token": token})
+	responceByJson(w, login)
 }
 
 func (s *Server) handleManagerGetProducts(w http.ResponseWriter, r *http.Request) {
 	items, err := s.managersSvc.Products(r.Context())
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
 	responceByJson(w, items)
 }
 
 func (s *Server) handleManagerChangeProducts(w http.ResponseWriter, r *http.Request) {
-	var item *managers.Product	
-	err := json.NewDecoder(r.Body).Decode(&item)
-		
+	// audit entries of the change name the manager put into context by AuditActor
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &managers.Product{}
+	err = decodeJSON(w, r, item)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
-	
+
 	items, err := s.managersSvc.ChangeProducts(r.Context(), item)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
 	responceByJson(w, items)
 }
 
+// handleManagerProductBySKU finds product by stock keeping unit
+func (s *Server) handleManagerProductBySKU(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item, err := s.managersSvc.ProductBySKU(r.Context(), mux.Vars(r)["sku"])
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, item)
+}
+
+// handleManagerProductByBarcode finds product by scanned EAN or UPC code
+func (s *Server) handleManagerProductByBarcode(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item, err := s.managersSvc.ProductByBarcode(r.Context(), mux.Vars(r)["code"])
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, item)
+}
+
+// maxImportSize limits body of product imports, they are larger than JSON requests
+const maxImportSize = 32 << 20
+
+// handleManagerImportProducts upserts products by SKU from CSV or JSON Lines body,
+// format is taken from query or Content-Type
+func (s *Server) handleManagerImportProducts(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+		case "text/csv":
+			format = managers.ImportCSV
+		case "application/x-ndjson", "application/jsonl":
+			format = managers.ImportJSONLines
+		}
+	}
+	dryRun := false
+	if value := query.Get("dry_run"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			responceError(w, r, apperr.ErrBadRequest.WithDetails(apperr.Detail{Field: "dry_run", Rule: "type", Message: "must be true or false"}))
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	report, err := s.managersSvc.ImportProducts(r.Context(), format, body, dryRun)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, report)
+}
+
 func (s *Server) handleManagerGetPurchases(w http.ResponseWriter, r *http.Request) {
-	id, err := middleware.Authentication(r.Context())
+	id, err := authenticatedID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
 
 	items, err := s.managersSvc.Purchases(r.Context(), id)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
 	responceByJson(w, items)
 }
 
 func (s *Server) handleManagerMakeSale(w http.ResponseWriter, r *http.Request) {
-	id, err := middleware.Authentication(r.Context())
+	id, err := authenticatedID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
-	
-	var item *managers.Sale
-	err = json.NewDecoder(r.Body).Decode(&item)
-	item.ManagerID = id	
+
+	item := &managers.Sale{}
+	err = decodeJSON(w, r, item)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
-	
+	item.ManagerID = id
+
 	items, err := s.managersSvc.MakeSale(r.Context(), item)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
 	responceByJson(w, items)
 }
 
 func (s *Server) handleManagerGetSales(w http.ResponseWriter, r *http.Request) {
-	id, err := middleware.Authentication(r.Context())
+	id, err := authenticatedID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
 
-	if id == 0 {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	total, err := s.managersSvc.GetSales(r.Context(), id)
+	if err != nil {
+		responceError(w, r, err)
 		return
 	}
+	responceByJson(w, total)
+}
 
-	total, err := s.managersSvc.GetSales(r.Context(), id)
+func (s *Server) handleManagerRemoveProductByID(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	productID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.managersSvc.RemoveProductByID(r.Context(), productID)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
-	responceByJson(w, map[string]interface{}{"manager_id": id, "total": total})
 }
 
-func (s *Server) handleManagerRemoveProductByID(w http.ResponseWriter, r *http.Request) {
-	id, err := middleware.Authentication(r.Context())
+func (s *Server) handleManagerChangeCustomer(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
 
-	if id == 0 {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	customer := &customers.Customer{}
+	err = decodeJSON(w, r, customer)
+	if err != nil {
+		responceError(w, r, err)
 		return
 	}
 
-	idParam, ok := mux.Vars(r)["id"]
-	if !ok {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	customer, err = s.managersSvc.ChangeCustomer(r.Context(), customer)
+	if err != nil {
+		responceError(w, r, err)
 		return
 	}
 
-	productID, err := strconv.ParseInt(idParam, 10, 64)
+	responceByJson(w, customer)
+}
+
+func (s *Server) handleManagerGetCustomers(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
 
-	err = s.managersSvc.RemoveProductByID(r.Context(), productID)
+	items, err := s.managersSvc.GetCustomers(r.Context())
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
+	responceByJson(w, items)
 }
 
-func (s *Server) handleManagerChangeCustomer(w http.ResponseWriter, r *http.Request) {
-	id, err := middleware.Authentication(r.Context())
+func (s *Server) handleManagerRemoveCustomerByID(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
 
-	if id == 0 {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	customerID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
 		return
 	}
-	customer := &customers.Customer{}
-	err = json.NewDecoder(r.Body).Decode(&customer)
+
+	err = s.managersSvc.RemoveCustomerByID(r.Context(), customerID)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		responceError(w, r, err)
 		return
 	}
+}
 
-	customer, err = s.managersSvc.ChangeCustomer(r.Context(), customer)
+func (s *Server) handleManagerGetCustomerByID(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
 
-	responceByJson(w, customer)
+	customerID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item, err := s.customersSvc.ByID(r.Context(), customerID)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, item)
 }
 
-func (s *Server) handleManagerGetCustomers(w http.ResponseWriter, r *http.Request) {
-	id, err := middleware.Authentication(r.Context())
+func (s *Server) handleManagerBlockCustomerByID(w http.ResponseWriter, r *http.Request) {
+	s.handleManagerSetCustomerActive(w, r, false)
+}
+
+func (s *Server) handleManagerUnblockCustomerByID(w http.ResponseWriter, r *http.Request) {
+	s.handleManagerSetCustomerActive(w, r, true)
+}
 
+func (s *Server) handleManagerSetCustomerActive(w http.ResponseWriter, r *http.Request, active bool) {
+	_, err := authenticatedID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
 
-	if id == 0 {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	customerID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
 		return
 	}
 
-	items, err := s.managersSvc.GetCustomers(r.Context())
+	item, err := s.customersSvc.BlockAndUnblockByID(r.Context(), customerID, active)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
-	responceByJson(w, items)
+	responceByJson(w, item)
 }
 
-func (s *Server) handleManagerRemoveCustomerByID(w http.ResponseWriter, r *http.Request) {
-	id, err := middleware.Authentication(r.Context())
+// handleManagerUnlockCustomer clears lock set after repeated failed logins of the customer
+func (s *Server) handleManagerUnlockCustomer(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	customerID, err := pathID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
 
-	if id == 0 {
-		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	item, err := s.customersSvc.Unlock(r.Context(), customerID)
+	if err != nil {
+		responceError(w, r, err)
 		return
 	}
+	responceByJson(w, item)
+}
 
-	idParam, ok := mux.Vars(r)["id"]
-	if !ok {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+// handleManagerUnlockManager clears lock of another manager, administrators only
+func (s *Server) handleManagerUnlockManager(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	if !s.managersSvc.IsAdmin(r.Context(), id) {
+		responceError(w, r, managers.ErrNotAdmin)
 		return
 	}
 
-	customerID, err := strconv.ParseInt(idParam, 10, 64)
+	managerID, err := pathID(r)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
 
-	err = s.managersSvc.RemoveCustomerByID(r.Context(), customerID)
+	err = s.managersSvc.Unlock(r.Context(), managerID)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		responceError(w, r, err)
 		return
 	}
-}
\ No newline at end of file
+}
+
+// handleManagerGetAudit returns audit log filtered by query, administrators only
+func (s *Server) handleManagerGetAudit(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	if !s.managersSvc.IsAdmin(r.Context(), id) {
+		responceError(w, r, managers.ErrNotAdmin)
+		return
+	}
+
+	filter, err := audit.ParseFilter(r.URL.Query())
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	items, err := s.managersSvc.AuditLog(r.Context(), filter)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, items)
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/darkside1809/gosql/pkg/audit"
+)
+
+// AuditActor puts account authenticated by Authenticate and client address
+// into context of the request, services take them for audit entries
+func AuditActor(realm string) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := audit.WithIP(r.Context(), ClientIP(r))
+			if id, err := Authentication(ctx); err == nil && id != 0 {
+				ctx = audit.WithActor(ctx, audit.Actor{Realm: realm, ID: id})
+			}
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
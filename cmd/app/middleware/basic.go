@@ -1,11 +1,19 @@
 package middleware
 
 import (
-	"log"
 	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/tracing"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+// RequestIDHeader carries id of the request between client, proxies and server
+const RequestIDHeader = "X-Request-ID"
+
 type Service struct {
 	pool *pgxpool.Pool
 }
@@ -20,12 +28,11 @@ func Basic(auth func(login, pass string) bool) func(handler http.Handler) http.H
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 			username, password, ok := request.BasicAuth()
 			if !ok {
-				log.Print("Cant parse username or password")
-				http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				apperr.Write(writer, request, apperr.ErrUnauthorized)
 				return
 			}
 			if !auth(username, password) {
-				http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				apperr.Write(writer, request, apperr.ErrUnauthorized)
 				return
 			}
 			handler.ServeHTTP(writer, request)
@@ -33,12 +40,53 @@ func Basic(auth func(login, pass string) bool) func(handler http.Handler) http.H
 	}
 }
 
-// Logger print handler's paths and methods which were called
+// Logger writes access log record with status, latency and size of every response
 func Logger(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Start: %s %s", r.Method, r.URL.Path)
-		handler.ServeHTTP(w, r)
-		log.Printf("Finish: %s %s", r.Method, r.URL.Path)
+		start := time.Now()
+		recorder := NewResponseRecorder(w)
+		handler.ServeHTTP(recorder, r)
+
+		fields := []logger.Field{
+			logger.F("method", r.Method),
+			logger.F("path", r.URL.Path),
+			logger.F("status", recorder.Status()),
+			logger.F("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			logger.F("bytes", recorder.Bytes()),
+			logger.F("remote", r.RemoteAddr),
+		}
+		if r.URL.RawQuery != "" {
+			fields = append(fields, logger.F("query", url.Values(logger.RedactValues(r.URL.Query())).Encode()))
+		}
+		log := logger.FromContext(r.Context())
+		switch {
+		case recorder.Status() >= http.StatusInternalServerError:
+			log.Error("request", fields...)
+		case recorder.Status() >= http.StatusBadRequest:
+			log.Warn("request", fields...)
+		default:
+			log.Info("request", fields...)
+		}
+	})
+}
+
+// RequestID takes id from X-Request-ID header or generates it, then puts it
+// into context, response header and logger of the request
+func RequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = logger.NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := logger.WithRequestID(r.Context(), id)
+		fields := []logger.Field{logger.F("request_id", id)}
+		if span := tracing.SpanFromContext(ctx); span != nil {
+			fields = append(fields, logger.F("trace_id", span.TraceID().String()))
+		}
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).With(fields...))
+		handler.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
@@ -47,7 +95,7 @@ func CheckHeader(header string, value string) func(handler http.Handler) http.Ha
 	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if value != r.Header.Get(header) {
-				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				apperr.Write(w, r, apperr.ErrBadRequest)
 				return
 			}
 			handler.ServeHTTP(w, r)
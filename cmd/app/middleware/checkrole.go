@@ -3,6 +3,8 @@ package middleware
 import (
 	"context"
 	"net/http"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
 )
 
 type HasAnyRoleFunc func(ctx context.Context, roles ...string) bool
@@ -11,7 +13,7 @@ func CheckRole(hasAnyRoleFunc HasAnyRoleFunc, roles ...string) func(http.Handler
 	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if !hasAnyRoleFunc(r.Context(), roles ...) {
-				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				apperr.Write(w, r, apperr.ErrForbidden)
 				return
 			}
 			handler.ServeHTTP(w, r)
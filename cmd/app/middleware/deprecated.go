@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// SuccessorFunc returns path which replaces the deprecated one
+type SuccessorFunc func(r *http.Request) string
+
+// Deprecated marks responses of old routes with Deprecation, Sunset and Link headers
+func Deprecated(sunset time.Time, successor SuccessorFunc) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			if successor != nil {
+				if path := successor(r); path != "" {
+					w.Header().Set("Link", "<"+path+`>; rel="successor-version"`)
+				}
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Successor always points to the same path
+func Successor(path string) SuccessorFunc {
+	return func(r *http.Request) string {
+		return path
+	}
+}
+
+// SuccessorPrefix replaces old prefix of request path with the new one
+func SuccessorPrefix(oldPrefix string, newPrefix string) SuccessorFunc {
+	return func(r *http.Request) string {
+		if len(r.URL.Path) < len(oldPrefix) || r.URL.Path[:len(oldPrefix)] != oldPrefix {
+			return ""
+		}
+		return newPrefix + r.URL.Path[len(oldPrefix):]
+	}
+}
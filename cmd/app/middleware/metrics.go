@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/metrics"
+)
+
+// RouteFunc returns template of the route which serves request
+type RouteFunc func(r *http.Request) string
+
+// Metrics counts requests and observes their latency labelled by route template,
+// raw paths are never used as labels so ids don't blow up cardinality
+func Metrics(registry *metrics.Registry, route RouteFunc) func(http.Handler) http.Handler {
+	requests := registry.CounterVec("gosql_http_requests_total", "HTTP requests by route, method and status.", "route", "method", "status")
+	latency := registry.HistogramVec("gosql_http_request_duration_seconds", "HTTP request latency by route and method.", metrics.DefaultBuckets, "route", "method")
+
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			template := route(r)
+			recorder := NewResponseRecorder(w)
+			handler.ServeHTTP(recorder, r)
+
+			latency.With(template, r.Method).ObserveDuration(start)
+			requests.With(template, r.Method, strconv.Itoa(recorder.Status())).Inc()
+		})
+	}
+}
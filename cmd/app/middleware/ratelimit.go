@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/phone"
+	"github.com/darkside1809/gosql/pkg/ratelimit"
+)
+
+var ErrRateLimited = apperr.New(apperr.KindTooManyRequests, "rate_limited", "too many requests")
+
+// KeyFunc extracts key of the bucket from request, empty key skips the rule
+type KeyFunc func(r *http.Request) string
+
+// RateRule limits requests sharing a key, Name separates buckets of different rules
+type RateRule struct {
+	Name  string
+	Limit ratelimit.Limit
+	Key   KeyFunc
+}
+
+// RateLimit rejects requests exceeding any of the rules with 429 and Retry-After,
+// failures of the store are logged and let the request through
+func RateLimit(store ratelimit.Store, rules ...RateRule) func(handler http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, rule := range rules {
+				key := rule.Key(r)
+				if key == "" {
+					continue
+				}
+				ok, retryAfter, err := store.Take(r.Context(), rule.Name+":"+key, rule.Limit)
+				if err != nil {
+					logger.FromContext(r.Context()).Warn("rate limit store", logger.F("rule", rule.Name), logger.Err(err))
+					continue
+				}
+				if !ok {
+					logger.FromContext(r.Context()).Info("rate limited", logger.F("rule", rule.Name))
+					apperr.Write(w, r, ErrRateLimited.WithRetryAfter(retryAfter))
+					return
+				}
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP is key of the client address, proxies are not trusted
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// maxPeekSize limits part of the body read by JSONField
+const maxPeekSize = 1 << 16
+
+// JSONField is key of a string field of JSON body, e.g. phone of login request,
+// body is restored for the handler
+func JSONField(name string) KeyFunc {
+	return func(r *http.Request) string {
+		if r.Body == nil {
+			return ""
+		}
+		peeked, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPeekSize))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(peeked), r.Body), r.Body}
+		if err != nil {
+			return ""
+		}
+
+		var fields map[string]interface{}
+		if json.Unmarshal(peeked, &fields) != nil {
+			return ""
+		}
+		value, _ := fields[name].(string)
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+}
+
+// PhoneField is key of a phone field of JSON body, phone is normalized the
+// way services do, so every spelling of a number shares the bucket
+func PhoneField(name string) KeyFunc {
+	field := JSONField(name)
+	return func(r *http.Request) string {
+		return phone.Clean(field(r))
+	}
+}
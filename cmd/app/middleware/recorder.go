@@ -0,0 +1,54 @@
+package middleware
+
+import "net/http"
+
+// ResponseRecorder remembers status and size of the response written by handler
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// NewResponseRecorder wraps writer, recorders are not wrapped twice
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	if recorder, ok := w.(*ResponseRecorder); ok {
+		return recorder
+	}
+	return &ResponseRecorder{ResponseWriter: w}
+}
+
+func (r *ResponseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *ResponseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers work through the recorder
+func (r *ResponseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Status returns written status, 200 when handler wrote nothing
+func (r *ResponseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Bytes returns size of written body
+func (r *ResponseRecorder) Bytes() int64 {
+	return r.bytes
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"errors"
 	"context"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
 )
 
 type contextKey struct {
@@ -25,8 +27,8 @@ func Authenticate(idFunc IDFunc) func(http.Handler) http.Handler {
 			token := r.Header.Get("Authorization")
 
 			id, err := idFunc(r.Context(), token)
-			if err == nil {
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			if err != nil {
+				apperr.Write(w, r, err)
 				return
 			}
 
@@ -42,4 +44,15 @@ func Authentication(ctx context.Context) (int64, error) {
 		return value, nil
 	}
 	return 0, ErrNoAuthentication
-}
\ No newline at end of file
+}
+// RequireAuthentication rejects requests which Authenticate left anonymous
+func RequireAuthentication(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := Authentication(r.Context())
+		if err != nil || id == 0 {
+			apperr.Write(w, r, apperr.ErrUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,282 @@
+package app
+
+import (
+	_ "embed"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/buildinfo"
+	"github.com/darkside1809/gosql/pkg/customers"
+	"github.com/darkside1809/gosql/pkg/exchange"
+	"github.com/darkside1809/gosql/pkg/export"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/managers"
+	"github.com/darkside1809/gosql/pkg/openapi"
+	"github.com/darkside1809/gosql/pkg/outbox"
+	"github.com/darkside1809/gosql/pkg/password"
+	"github.com/darkside1809/gosql/pkg/receipts"
+	"github.com/darkside1809/gosql/pkg/payments"
+	"github.com/darkside1809/gosql/pkg/reorder"
+	"github.com/darkside1809/gosql/pkg/reports"
+	"github.com/darkside1809/gosql/pkg/reservations"
+	"github.com/darkside1809/gosql/pkg/security"
+	"github.com/darkside1809/gosql/pkg/taxes"
+	"github.com/darkside1809/gosql/pkg/validate"
+	"github.com/gorilla/mux"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+const (
+	customerToken = "customerToken"
+	managerToken  = "managerToken"
+)
+
+// v1Routes documents routes registered by registerV1, paths are relative to version prefix
+func v1Routes() []openapi.Route {
+	return []openapi.Route{
+		{Method: POST, Path: "/customers", Summary: "Register customer", Tag: "customers", Request: customers.Registration{}, Response: customers.Customer{}},
+		{Method: POST, Path: "/customers/verify", Summary: "Verify phone with code sent by SMS", Tag: "customers", Request: customers.Verification{}, Response: customers.Customer{}},
+		{Method: POST, Path: "/customers/verify/resend", Summary: "Send phone verification code again", Tag: "customers", Request: customers.VerificationRequest{}, Status: http.StatusAccepted},
+		{Method: POST, Path: "/customers/token", Summary: "Issue customer token", Tag: "customers", Request: security.Auth{}, Response: security.Token{}},
+		{Method: POST, Path: "/customers/token/validate", Summary: "Validate customer token", Tag: "customers", Request: security.Token{}, Response: security.ResponceOk{}},
+		{Method: POST, Path: "/customers/password", Summary: "Change password of current customer", Tag: "customers", Security: customerToken, Request: password.Change{}, Status: http.StatusNoContent},
+		{Method: POST, Path: "/customers/password/reset", Summary: "Send password reset code to the phone", Tag: "customers", Request: password.ResetRequest{}, Status: http.StatusAccepted},
+		{Method: POST, Path: "/customers/password/reset/confirm", Summary: "Set password using reset code", Tag: "customers", Request: password.Reset{}, Status: http.StatusNoContent},
+		{Method: GET, Path: "/customers/products", Summary: "List active products", Tag: "customers", Security: customerToken, Response: []customers.Products{}},
+		{Method: GET, Path: "/customers/purchases", Summary: "List purchases of current customer", Tag: "customers", Security: customerToken, Response: []customers.Purchase{}},
+		{Method: GET, Path: "/customers/purchases/{id}/receipt", Summary: "Download receipt of a purchase of current customer", Tag: "customers", Security: customerToken, Query: receiptQuery(), Response: &openapi.Schema{Type: "string", Format: "binary"}, ContentType: "application/pdf"},
+
+		{Method: POST, Path: "/managers", Summary: "Register manager and send invitation", Tag: "managers", Security: managerToken, Request: managers.Registration{}, Response: managers.Invitation{}},
+		{Method: POST, Path: "/managers/invitations/accept", Summary: "Set password of invited manager", Tag: "managers", Request: password.InvitationAccept{}, Response: security.Token{}},
+		{Method: POST, Path: "/managers/password", Summary: "Change password of current manager", Tag: "managers", Security: managerToken, Request: password.Change{}, Status: http.StatusNoContent},
+		{Method: POST, Path: "/managers/password/reset", Summary: "Send password reset code to the phone", Tag: "managers", Request: password.ResetRequest{}, Status: http.StatusAccepted},
+		{Method: POST, Path: "/managers/password/reset/confirm", Summary: "Set password using reset code", Tag: "managers", Request: password.Reset{}, Status: http.StatusNoContent},
+		{Method: POST, Path: "/managers/token", Summary: "Issue manager token, or challenge when two-factor authentication is enabled", Tag: "managers", Request: managers.Credentials{}, Response: managers.Login{}},
+		{Method: POST, Path: "/managers/token/totp", Summary: "Exchange challenge and authentication or recovery code for token", Tag: "managers", Request: managers.TOTPVerification{}, Response: managers.Login{}},
+		{Method: POST, Path: "/managers/totp/enroll", Summary: "Start two-factor authentication enrollment, accepts enrollment tokens", Tag: "managers", Security: managerToken, Response: managers.Enrollment{}},
+		{Method: POST, Path: "/managers/totp/confirm", Summary: "Enable two-factor authentication and issue recovery codes", Tag: "managers", Security: managerToken, Request: managers.TOTPCode{}, Response: managers.RecoveryCodes{}},
+		{Method: POST, Path: "/managers/totp/recovery-codes", Summary: "Replace recovery codes", Tag: "managers", Security: managerToken, Request: managers.TOTPCode{}, Response: managers.RecoveryCodes{}},
+		{Method: POST, Path: "/managers/totp/disable", Summary: "Disable two-factor authentication", Tag: "managers", Security: managerToken, Request: managers.TOTPCode{}, Status: http.StatusNoContent},
+		{Method: GET, Path: "/managers/security-policy", Summary: "Get security policy, administrators only", Tag: "managers", Security: managerToken, Response: managers.SecurityPolicy{}},
+		{Method: PUT, Path: "/managers/security-policy", Summary: "Change security policy, administrators only", Tag: "managers", Security: managerToken, Request: managers.SecurityPolicy{}, Response: managers.SecurityPolicy{}},
+		{Method: GET, Path: "/managers/sales", Summary: "Sales total of current manager converted into APP_CURRENCY at current rates", Tag: "managers", Security: managerToken, Response: managers.SalesTotal{}},
+		{Method: POST, Path: "/managers/sales", Summary: "Make sale", Tag: "managers", Security: managerToken, Request: managers.Sale{}, Response: managers.Sale{}},
+		{Method: GET, Path: "/managers/sales/{id}/receipt", Summary: "Download receipt of a sale", Tag: "managers", Security: managerToken, Query: receiptQuery(), Response: &openapi.Schema{Type: "string", Format: "binary"}, ContentType: "application/pdf"},
+		{Method: GET, Path: "/managers/sales/{id}/payments", Summary: "Status of sale with total, captured, refunded and due amounts and its payments", Tag: "payments", Security: managerToken, Response: payments.Summary{}},
+		{Method: POST, Path: "/managers/sales/{id}/payments", Summary: "Pay part or rest of pending sale by cash, card or transfer, sale is paid when captured payments cover its total, paying again with the same idempotency key returns or finishes the payment", Tag: "payments", Security: managerToken, Request: payments.Payment{}, Response: payments.Payment{}},
+		{Method: POST, Path: "/managers/payments/{id}/capture", Summary: "Capture authorized payment, or finish payment left pending or capturing by a failure", Tag: "payments", Security: managerToken, Response: payments.Payment{}},
+		{Method: POST, Path: "/managers/payments/{id}/refund", Summary: "Refund captured payment, whole rest when amount is zero, refund in progress is finished first, administrators only", Tag: "payments", Security: managerToken, Request: payments.Refund{}, Response: payments.Payment{}},
+		{Method: GET, Path: "/managers/events", Summary: "Stream of new sales, low stock and price changes as Server-Sent Events, Last-Event-ID header resumes it", Tag: "managers", Security: managerToken, Query: []*openapi.Parameter{
+			{Name: "types", In: "query", Description: "comma separated sale.created, product.low_stock, product.price_changed, every type by default", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "last_event_id", In: "query", Description: "resume after the event when Last-Event-ID header can't be set", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+		}, Response: outbox.Event{}, ContentType: "text/event-stream"},
+		{Method: GET, Path: "/managers/reports/sales", Summary: "Revenue, units and average order value by day, week or month", Tag: "reports", Security: managerToken, Query: reportQuery(true), Response: reports.SalesReport{}},
+		{Method: GET, Path: "/managers/reports/sales/{dimension}", Summary: "Top managers, departments, products or customers by sales", Tag: "reports", Security: managerToken, Query: reportQuery(false), Response: reports.GroupReport{}},
+		{Method: GET, Path: "/managers/export/{entity}", Summary: "Download customers, products or sales, one line per sale position, as spreadsheet", Tag: "reports", Security: managerToken, Query: []*openapi.Parameter{
+			{Name: "format", In: "query", Description: "csv by default", Schema: &openapi.Schema{Type: "string", Enum: []string{export.FormatCSV, export.FormatXLSX}}},
+			{Name: "include_inactive", In: "query", Description: "customers and products which are not active too", Schema: &openapi.Schema{Type: "boolean"}},
+			{Name: "from", In: "query", Description: "sales from date YYYY-MM-DD in tz or RFC 3339 time, 30 days before to by default", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "to", In: "query", Description: "sales to date YYYY-MM-DD in tz, inclusive, or RFC 3339 time, today by default", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "tz", In: "query", Description: "IANA timezone of dates and times, UTC by default", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "manager_id", In: "query", Description: "sales of the manager", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+			{Name: "customer_id", In: "query", Description: "sales of the customer", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+		}, Response: &openapi.Schema{Type: "string", Format: "binary"}, ContentType: "application/octet-stream"},
+		{Method: GET, Path: "/managers/products", Summary: "List active products", Tag: "managers", Security: managerToken, Response: []managers.Product{}},
+		{Method: POST, Path: "/managers/products", Summary: "Create or update product", Tag: "managers", Security: managerToken, Request: managers.Product{}, Response: managers.Product{}},
+		{Method: POST, Path: "/managers/products/import", Summary: "Create or update products by SKU from CSV with header or JSON Lines of sku, barcode, name, price in minor units, currency, qty and active", Tag: "managers", Security: managerToken, Query: []*openapi.Parameter{
+			{Name: "format", In: "query", Description: "taken from Content-Type when missing", Schema: &openapi.Schema{Type: "string", Enum: []string{managers.ImportCSV, managers.ImportJSONLines}}},
+			{Name: "dry_run", In: "query", Description: "validate and report without writing", Schema: &openapi.Schema{Type: "boolean"}},
+		}, Request: &openapi.Schema{Type: "string", Format: "binary"}, RequestContentTypes: []string{"text/csv", "application/x-ndjson"}, Response: managers.ImportReport{}},
+		{Method: GET, Path: "/managers/products/reorder", Summary: "Products below reorder threshold or selling out within cover days with quantities to order, soonest to run out first", Tag: "managers", Security: managerToken, Query: []*openapi.Parameter{
+			{Name: "days", In: "query", Description: "days of sales the velocity is averaged over, 30 by default", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "cover_days", In: "query", Description: "days of sales the order covers, 14 by default", Schema: &openapi.Schema{Type: "integer"}},
+		}, Response: []reorder.Suggestion{}},
+		{Method: GET, Path: "/managers/products/by-sku/{sku}", Summary: "Find product by SKU", Tag: "managers", Security: managerToken, Response: managers.Product{}},
+		{Method: GET, Path: "/managers/products/by-barcode/{code}", Summary: "Find product by EAN-8, UPC-A, EAN-13 or GTIN-14 barcode", Tag: "managers", Security: managerToken, Response: managers.Product{}},
+		{Method: DELETE, Path: "/managers/products/{id}", Summary: "Remove product", Tag: "managers", Security: managerToken},
+		{Method: GET, Path: "/managers/products/{id}/availability", Summary: "Stock of product, quantity held by active reservations and available to sell", Tag: "managers", Security: managerToken, Response: reservations.Availability{}},
+		{Method: GET, Path: "/managers/reservations", Summary: "Reservations, newest first", Tag: "managers", Security: managerToken, Query: []*openapi.Parameter{
+			{Name: "status", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []string{reservations.StatusActive, reservations.StatusConverted, reservations.StatusReleased, reservations.StatusExpired}}},
+			{Name: "product_id", In: "query", Description: "reservations of the product", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+			{Name: "customer_id", In: "query", Description: "reservations of the customer", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+		}, Response: []reservations.Reservation{}},
+		{Method: POST, Path: "/managers/reservations", Summary: "Hold stock of product for pending order until ttl in seconds passes, sale position with reservation_id sells it", Tag: "managers", Security: managerToken, Request: reservations.Reservation{}, Response: reservations.Reservation{}},
+		{Method: DELETE, Path: "/managers/reservations/{id}", Summary: "Release active reservation", Tag: "managers", Security: managerToken, Status: http.StatusNoContent},
+		{Method: GET, Path: "/managers/customers", Summary: "List active customers", Tag: "managers", Security: managerToken, Response: []customers.Customer{}},
+		{Method: POST, Path: "/managers/customers", Summary: "Change customer", Tag: "managers", Security: managerToken, Request: customers.Customer{}, Response: customers.Customer{}},
+		{Method: GET, Path: "/managers/customers/{id}", Summary: "Get customer", Tag: "managers", Security: managerToken, Response: customers.Customer{}},
+		{Method: DELETE, Path: "/managers/customers/{id}", Summary: "Remove customer", Tag: "managers", Security: managerToken},
+		{Method: POST, Path: "/managers/customers/{id}/block", Summary: "Block customer", Tag: "managers", Security: managerToken, Response: customers.Customer{}},
+		{Method: DELETE, Path: "/managers/customers/{id}/block", Summary: "Unblock customer", Tag: "managers", Security: managerToken, Response: customers.Customer{}},
+		{Method: DELETE, Path: "/managers/customers/{id}/lock", Summary: "Unlock customer locked after failed logins", Tag: "managers", Security: managerToken, Response: customers.Customer{}},
+		{Method: DELETE, Path: "/managers/managers/{id}/lock", Summary: "Unlock manager locked after failed logins, administrators only", Tag: "managers", Security: managerToken},
+		{Method: GET, Path: "/managers/audit", Summary: "Audit log of writes, newest first, administrators only", Tag: "managers", Security: managerToken, Query: auditQuery(), Response: []audit.Entry{}},
+		{Method: GET, Path: "/managers/tax-classes", Summary: "Tax classes with current rate and every rate, latest first", Tag: "taxes", Security: managerToken, Response: []taxes.Class{}},
+		{Method: POST, Path: "/managers/tax-classes", Summary: "Create tax class, administrators only", Tag: "taxes", Security: managerToken, Request: taxes.Class{}, Response: taxes.Class{}},
+		{Method: PUT, Path: "/managers/tax-classes/{id}", Summary: "Change code or name of tax class, administrators only", Tag: "taxes", Security: managerToken, Request: taxes.Class{}, Response: taxes.Class{}},
+		{Method: POST, Path: "/managers/tax-classes/{id}/rates", Summary: "Add rate in basis points effective from the time, past sales keep their taxes, administrators only", Tag: "taxes", Security: managerToken, Request: taxes.Rate{}, Response: taxes.Rate{}},
+		{Method: GET, Path: "/managers/exchange-rates", Summary: "Exchange rates of consolidated reports, latest first, administrators only", Tag: "reports", Security: managerToken, Response: []exchange.Rate{}},
+		{Method: POST, Path: "/managers/exchange-rates", Summary: "Add rate of currency to base currency effective from the time, administrators only", Tag: "reports", Security: managerToken, Request: exchange.Rate{}, Response: exchange.Rate{}},
+		{Method: GET, Path: "/managers/webhooks", Summary: "List webhook subscriptions, administrators only", Tag: "webhooks", Security: managerToken, Response: []outbox.Subscription{}},
+		{Method: POST, Path: "/managers/webhooks", Summary: "Subscribe endpoint to events, secret is returned only once, administrators only", Tag: "webhooks", Security: managerToken, Request: outbox.Subscription{}, Response: outbox.Subscription{}},
+		{Method: PUT, Path: "/managers/webhooks/{id}", Summary: "Change webhook subscription, administrators only", Tag: "webhooks", Security: managerToken, Request: outbox.Subscription{}, Response: outbox.Subscription{}},
+		{Method: DELETE, Path: "/managers/webhooks/{id}", Summary: "Remove webhook subscription with its deliveries, administrators only", Tag: "webhooks", Security: managerToken, Status: http.StatusNoContent},
+		{Method: GET, Path: "/managers/webhooks/{id}/deliveries", Summary: "Last deliveries of subscription, administrators only", Tag: "webhooks", Security: managerToken, Query: []*openapi.Parameter{
+			{Name: "status", In: "query", Description: "pending, delivered or dead", Schema: &openapi.Schema{Type: "string", Enum: []string{outbox.StatusPending, outbox.StatusDelivered, outbox.StatusDead}}},
+		}, Response: []outbox.Delivery{}},
+		{Method: GET, Path: "/managers/outbox/events", Summary: "Published events, newest first, administrators only", Tag: "webhooks", Security: managerToken, Query: []*openapi.Parameter{
+			{Name: "type", In: "query", Description: "e.g. sale.created, product.updated", Schema: &openapi.Schema{Type: "string", Enum: outbox.EventTypes}},
+			{Name: "before_id", In: "query", Description: "events older than the event, for paging", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+		}, Response: []outbox.Event{}},
+		{Method: POST, Path: "/managers/outbox/events/{id}/replay", Summary: "Send event to subscriptions again, administrators only", Tag: "webhooks", Security: managerToken, Request: outbox.Replay{}, Response: outbox.ReplayResult{}},
+	}
+}
+
+// auditQuery documents filters read by audit.ParseFilter
+func auditQuery() []*openapi.Parameter {
+	text := &openapi.Schema{Type: "string"}
+	id := &openapi.Schema{Type: "integer", Format: "int64"}
+	datetime := &openapi.Schema{Type: "string", Format: "date-time"}
+	return []*openapi.Parameter{
+		{Name: "actor_realm", In: "query", Description: "customer or manager", Schema: text},
+		{Name: "actor_id", In: "query", Schema: id},
+		{Name: "action", In: "query", Description: "e.g. customer.block, product.update", Schema: text},
+		{Name: "target", In: "query", Description: "e.g. customer, product, sale", Schema: text},
+		{Name: "target_id", In: "query", Schema: id},
+		{Name: "from", In: "query", Description: "entries created at or after the time", Schema: datetime},
+		{Name: "to", In: "query", Description: "entries created before the time", Schema: datetime},
+		{Name: "before_id", In: "query", Description: "entries older than the entry, for paging", Schema: id},
+		{Name: "limit", In: "query", Description: "at most 500, 100 by default", Schema: id},
+	}
+}
+
+// reportQuery documents filters read by reports.ParseFilter, series
+// take interval and groups take order and limit
+func reportQuery(series bool) []*openapi.Parameter {
+	text := &openapi.Schema{Type: "string"}
+	params := []*openapi.Parameter{
+		{Name: "from", In: "query", Description: "date YYYY-MM-DD in tz or RFC 3339 time, 30 days before to by default", Schema: text},
+		{Name: "to", In: "query", Description: "date YYYY-MM-DD in tz, inclusive, or RFC 3339 time, today by default", Schema: text},
+		{Name: "tz", In: "query", Description: "IANA timezone of dates and periods, UTC by default", Schema: text},
+		{Name: "currency", In: "query", Description: "ISO 4217 currency amounts are converted into at rates effective at the end of the range, APP_CURRENCY by default", Schema: &openapi.Schema{Type: "string", Pattern: validate.Currency.String()}},
+		{Name: "compare", In: "query", Description: "compare with previous period of the same length", Schema: &openapi.Schema{Type: "boolean"}},
+	}
+	if series {
+		return append(params, &openapi.Parameter{Name: "interval", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []string{reports.IntervalDay, reports.IntervalWeek, reports.IntervalMonth}}})
+	}
+	return append(params,
+		&openapi.Parameter{Name: "order", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []string{reports.OrderRevenue, reports.OrderUnits, reports.OrderOrders}}},
+		&openapi.Parameter{Name: "limit", In: "query", Description: "at most 500, 10 by default", Schema: &openapi.Schema{Type: "integer"}},
+	)
+}
+
+// receiptQuery documents format of receipts, HTML is sent as text/html
+func receiptQuery() []*openapi.Parameter {
+	return []*openapi.Parameter{
+		{Name: "format", In: "query", Description: "pdf by default", Schema: &openapi.Schema{Type: "string", Enum: []string{receipts.FormatPDF, receipts.FormatHTML}}},
+	}
+}
+
+// legacyRoutes documents routes registered by registerLegacy, paths are relative to /customers
+func legacyRoutes() []openapi.Route {
+	return []openapi.Route{
+		{Method: GET, Path: "", Summary: "List customers", Response: []customers.Customer{}},
+		{Method: GET, Path: "/active", Summary: "List active customers", Response: []customers.Customer{}},
+		{Method: GET, Path: "/{id}", Summary: "Get customer", Response: customers.Customer{}},
+		{Method: POST, Path: "", Summary: "Create or update customer", Request: customers.Customer{}, Response: customers.Customer{}},
+		{Method: DELETE, Path: "/{id}", Summary: "Remove customer", Response: customers.Customer{}},
+		{Method: POST, Path: "/{id}/block", Summary: "Block customer", Response: customers.Customer{}},
+		{Method: DELETE, Path: "/{id}/block", Summary: "Unblock customer", Response: customers.Customer{}},
+	}
+}
+
+// apiRoutes documents every route registered in Init,
+// CheckSpec fails when a route is missing here
+func (s *Server) apiRoutes() []openapi.Route {
+	routes := []openapi.Route{
+		{Method: GET, Path: "/openapi.json", Summary: "OpenAPI specification", Tag: "docs", Response: &openapi.Schema{Type: "object"}},
+		{Method: GET, Path: "/docs", Summary: "API documentation viewer", Tag: "docs"},
+		{Method: GET, Path: "/metrics", Summary: "Prometheus metrics", Tag: "operations"},
+		{Method: GET, Path: "/healthz", Summary: "Liveness probe", Tag: "operations", Response: Health{}},
+		{Method: GET, Path: "/readyz", Summary: "Readiness probe, 503 when not ready", Tag: "operations", Response: Health{}},
+		{Method: GET, Path: "/version", Summary: "Build information", Tag: "operations", Response: buildinfo.Info{}},
+	}
+	for _, route := range v1Routes() {
+		versioned := route
+		versioned.Path = apiV1 + route.Path
+		alias := route
+		alias.Path = apiUnversioned + route.Path
+		alias.Deprecated = true
+		routes = append(routes, versioned, alias)
+	}
+	for _, route := range legacyRoutes() {
+		route.Path = legacyCustomers + route.Path
+		route.Tag = "legacy"
+		route.Deprecated = true
+		if !s.config.LegacyCompat {
+			route.Security = managerToken
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// Spec builds OpenAPI document from documented routes
+func (s *Server) Spec() *openapi.Builder {
+	builder := openapi.NewBuilder("gosql API", "1.0.0", apperr.Response{})
+	builder.SecurityScheme(customerToken, "Authorization", "Token issued by POST /api/v1/customers/token")
+	builder.SecurityScheme(managerToken, "Authorization", "Token issued by POST /api/v1/managers/token")
+	for _, route := range s.apiRoutes() {
+		builder.Add(route)
+	}
+	return builder
+}
+
+// CheckSpec returns error listing routes of the router which are not in the specification
+func (s *Server) CheckSpec() error {
+	builder := s.Spec()
+	missing := make([]string, 0)
+	err := s.mux.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// subrouter prefixes have no methods
+			return nil
+		}
+		for _, method := range methods {
+			if !builder.Has(method, path) {
+				missing = append(missing, method+" "+path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return errors.New("routes missing in OpenAPI specification: " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	responceByJson(w, s.Spec().Document())
+}
+
+func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := w.Write(docsPage)
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("write docs page", logger.Err(err))
+	}
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/darkside1809/gosql/pkg/managers"
+	"github.com/gorilla/mux"
+)
+
+// newTestServer returns server with routes, services are not called by Init
+func newTestServer() *Server {
+	s := NewServer(&Config{}, mux.NewRouter(), nil, nil, &managers.Service{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	s.Init()
+	return s
+}
+
+func TestSpecHasEveryRoute(t *testing.T) {
+	err := newTestServer().CheckSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpecHasEveryLegacyRoute(t *testing.T) {
+	s := NewServer(&Config{LegacyCompat: true}, mux.NewRouter(), nil, nil, &managers.Service{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	s.Init()
+	err := s.CheckSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
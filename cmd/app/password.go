@@ -0,0 +1,133 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/darkside1809/gosql/pkg/password"
+	"github.com/darkside1809/gosql/pkg/security"
+)
+
+func (s *Server) handleCustomerChangePassword(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &password.Change{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.customersSvc.ChangePassword(r.Context(), id, item.CurrentPassword, item.NewPassword)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleCustomerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	item := &password.ResetRequest{}
+	err := decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.customersSvc.RequestPasswordReset(r.Context(), item.Phone)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) handleCustomerResetPassword(w http.ResponseWriter, r *http.Request) {
+	item := &password.Reset{}
+	err := decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.customersSvc.ResetPassword(r.Context(), item.Phone, item.Code, item.Password)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleManagerChangePassword(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &password.Change{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.managersSvc.ChangePassword(r.Context(), id, item.CurrentPassword, item.NewPassword)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleManagerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	item := &password.ResetRequest{}
+	err := decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.managersSvc.RequestPasswordReset(r.Context(), item.Phone)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) handleManagerResetPassword(w http.ResponseWriter, r *http.Request) {
+	item := &password.Reset{}
+	err := decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.managersSvc.ResetPassword(r.Context(), item.Phone, item.Code, item.Password)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleManagerAcceptInvitation sets password of invited manager and logs him in
+func (s *Server) handleManagerAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	item := &password.InvitationAccept{}
+	err := decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	token, err := s.managersSvc.AcceptInvitation(r.Context(), item.Code, item.Password)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, security.Token{Token: token})
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/darkside1809/gosql/pkg/payments"
+)
+
+// handleManagerGetPayments returns status of the sale with its payments
+func (s *Server) handleManagerGetPayments(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	saleID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	summary, err := s.paymentsSvc.Payments(r.Context(), saleID)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, summary)
+}
+
+// handleManagerPay takes payment of the sale by current manager
+func (s *Server) handleManagerPay(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	saleID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &payments.Payment{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	item.ManagerID = id
+
+	saved, err := s.paymentsSvc.Pay(r.Context(), saleID, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, saved)
+}
+
+// handleManagerCapturePayment takes amount of authorized payment
+func (s *Server) handleManagerCapturePayment(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	id, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	saved, err := s.paymentsSvc.Capture(r.Context(), id)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, saved)
+}
+
+// handleManagerRefundPayment returns amount of captured payment, administrators only
+func (s *Server) handleManagerRefundPayment(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	id, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &payments.Refund{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	saved, err := s.paymentsSvc.Refund(r.Context(), id, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, saved)
+}
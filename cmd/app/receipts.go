@@ -0,0 +1,57 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/darkside1809/gosql/pkg/receipts"
+)
+
+// handleCustomerReceipt returns receipt of a purchase of the customer
+func (s *Server) handleCustomerReceipt(w http.ResponseWriter, r *http.Request) {
+	customerID, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	s.writeReceipt(w, r, customerID)
+}
+
+// handleManagerReceipt returns receipt of any sale
+func (s *Server) handleManagerReceipt(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	s.writeReceipt(w, r, 0)
+}
+
+// writeReceipt renders receipt of the sale {id} as PDF or HTML, receipt is
+// rendered into memory first so errors are still sent as JSON
+func (s *Server) writeReceipt(w http.ResponseWriter, r *http.Request, customerID int64) {
+	id, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = receipts.FormatPDF
+	}
+	receipt, err := s.receiptsSvc.Receipt(r.Context(), id, customerID)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	body := &bytes.Buffer{}
+	err = receipts.Write(body, format, receipt)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", receipts.ContentType(format))
+	w.Header().Set("Content-Disposition", `inline; filename="`+receipt.Number+"."+format+`"`)
+	_, _ = body.WriteTo(w)
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/reorder"
+)
+
+// handleManagerReorderProducts suggests quantities to order of products
+// running low, from sales of the last days
+func (s *Server) handleManagerReorderProducts(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := &reorder.Filter{}
+	for name, value := range map[string]*int{"days": &filter.Days, "cover_days": &filter.CoverDays} {
+		text := query.Get(name)
+		if text == "" {
+			continue
+		}
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 1 {
+			responceError(w, r, apperr.ErrBadRequest.WithDetails(apperr.Detail{
+				Field: name, Rule: "type", Message: "must be a positive integer",
+			}))
+			return
+		}
+		*value = n
+	}
+
+	items, err := s.reorderSvc.Suggestions(r.Context(), filter)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, items)
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/darkside1809/gosql/pkg/reports"
+	"github.com/gorilla/mux"
+)
+
+// handleManagerSalesReport returns totals and time series of sales
+func (s *Server) handleManagerSalesReport(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	filter, err := reports.ParseFilter(r.URL.Query())
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	report, err := s.reportsSvc.Sales(r.Context(), filter)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, report)
+}
+
+// handleManagerGroupReport returns top managers, departments, products or customers by sales
+func (s *Server) handleManagerGroupReport(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	filter, err := reports.ParseFilter(r.URL.Query())
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	report, err := s.reportsSvc.Groups(r.Context(), mux.Vars(r)["dimension"], filter)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, report)
+}
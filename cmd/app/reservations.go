@@ -0,0 +1,128 @@
+package app
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/reservations"
+)
+
+// handleManagerGetReservations returns reservations filtered by status, product and customer
+func (s *Server) handleManagerGetReservations(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := &reservations.Filter{Status: query.Get("status")}
+	switch filter.Status {
+	case "", reservations.StatusActive, reservations.StatusConverted, reservations.StatusReleased, reservations.StatusExpired:
+	default:
+		responceError(w, r, apperr.ErrBadRequest.WithDetails(apperr.Detail{
+			Field: "status", Rule: "oneof", Message: "must be one of active converted released expired",
+		}))
+		return
+	}
+	filter.ProductID, err = queryID(query, "product_id")
+	if err == nil {
+		filter.CustomerID, err = queryID(query, "customer_id")
+	}
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	items, err := s.reservationsSvc.Reservations(r.Context(), filter)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, items)
+}
+
+// handleManagerReserve holds stock of the product for pending order of current manager
+func (s *Server) handleManagerReserve(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &reservations.Reservation{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	item.ManagerID = id
+
+	saved, err := s.reservationsSvc.Reserve(r.Context(), item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, saved)
+}
+
+// handleManagerReleaseReservation returns stock held by the reservation
+func (s *Server) handleManagerReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	id, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.reservationsSvc.Release(r.Context(), id)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleManagerProductAvailability returns stock of the product less active reservations
+func (s *Server) handleManagerProductAvailability(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	id, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item, err := s.reservationsSvc.Availability(r.Context(), id)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, item)
+}
+
+// queryID parses optional id parameter of the query, zero when missing
+func queryID(query url.Values, name string) (int64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, apperr.ErrBadRequest.WithDetails(apperr.Detail{
+			Field: name, Rule: "type", Message: "must be a positive integer",
+		})
+	}
+	return id, nil
+}
@@ -2,99 +2,391 @@ package app
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/darkside1809/gosql/cmd/app/middleware"
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
 	"github.com/darkside1809/gosql/pkg/customers"
+	"github.com/darkside1809/gosql/pkg/exchange"
+	"github.com/darkside1809/gosql/pkg/export"
+	"github.com/darkside1809/gosql/pkg/logger"
 	"github.com/darkside1809/gosql/pkg/managers"
+	"github.com/darkside1809/gosql/pkg/metrics"
+	"github.com/darkside1809/gosql/pkg/outbox"
+	"github.com/darkside1809/gosql/pkg/payments"
+	"github.com/darkside1809/gosql/pkg/ratelimit"
+	"github.com/darkside1809/gosql/pkg/receipts"
+	"github.com/darkside1809/gosql/pkg/reorder"
+	"github.com/darkside1809/gosql/pkg/reports"
+	"github.com/darkside1809/gosql/pkg/reservations"
 	"github.com/darkside1809/gosql/pkg/security"
+	"github.com/darkside1809/gosql/pkg/taxes"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/darkside1809/gosql/pkg/validate"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 type Server struct {
+	config       *Config
 	mux          *mux.Router
 	customersSvc *customers.Service
 	securitySvc  *security.Service
 	managersSvc	 *managers.Service
+	outboxSvc    *outbox.Service
+	listener     *outbox.Listener
+	reportsSvc   *reports.Service
+	exportSvc    *export.Service
+	receiptsSvc  *receipts.Service
+	taxesSvc     *taxes.Service
+	exchangeSvc  *exchange.Service
+	reservationsSvc *reservations.Service
+	reorderSvc   *reorder.Service
+	paymentsSvc  *payments.Service
+	pool         *pgxpool.Pool
+	limiter      ratelimit.Store
+	handler      http.Handler
+	shuttingDown int32
+	shutdown     chan struct{}
 }
 
+// Route prefixes of API versions
+const (
+	apiV1           = "/api/v1"
+	apiUnversioned  = "/api"
+	legacyCustomers = "/customers"
+)
+
+// maxBodySize limits size of JSON bodies accepted by handlers
+const maxBodySize = 1 << 20
+
+var errBodyTooLarge = apperr.New(apperr.KindTooLarge, "body_too_large", "request body is too large")
+
 const (
 	GET = "GET"
 	POST = "POST"
+	PUT = "PUT"
 	DELETE = "DELETE"
 )
 
-func NewServer(mux *mux.Router, customersSvc	*customers.Service, securitySvc *security.Service, managersSvc *managers.Service) *Server {
-	return &Server{mux: mux, customersSvc: customersSvc, securitySvc: securitySvc, managersSvc: managersSvc}
+func NewServer(config *Config, mux *mux.Router, customersSvc	*customers.Service, securitySvc *security.Service, managersSvc *managers.Service, outboxSvc *outbox.Service, listener *outbox.Listener, reportsSvc *reports.Service, exportSvc *export.Service, receiptsSvc *receipts.Service, taxesSvc *taxes.Service, exchangeSvc *exchange.Service, reservationsSvc *reservations.Service, reorderSvc *reorder.Service, paymentsSvc *payments.Service, pool *pgxpool.Pool, limiter ratelimit.Store) *Server {
+	return &Server{config: config, mux: mux, customersSvc: customersSvc, securitySvc: securitySvc, managersSvc: managersSvc, outboxSvc: outboxSvc, listener: listener, reportsSvc: reportsSvc, exportSvc: exportSvc, receiptsSvc: receiptsSvc, taxesSvc: taxesSvc, exchangeSvc: exchangeSvc, reservationsSvc: reservationsSvc, reorderSvc: reorderSvc, paymentsSvc: paymentsSvc, pool: pool, limiter: limiter, shutdown: make(chan struct{})}
 }
 
+// ServeHTTP traces request as server span, trace parent is taken from
+// traceparent header of the request
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+	route := s.routeTemplate(r)
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), r.Method+" "+route, tracing.WithKind(tracing.KindServer), tracing.WithAttributes(map[string]interface{}{
+		"http.method": r.Method,
+		"http.route":  route,
+		"http.target": r.URL.Path,
+	}))
+	defer span.End()
+
+	recorder := middleware.NewResponseRecorder(w)
+	s.handler.ServeHTTP(recorder, r.WithContext(ctx))
+
+	span.SetAttribute("http.status_code", recorder.Status())
+	if recorder.Status() >= http.StatusInternalServerError {
+		span.SetStatus(tracing.StatusError, http.StatusText(recorder.Status()))
+	}
 }
 func responceByJson(w http.ResponseWriter, d interface{}) {
 	data, err := json.Marshal(d)
 	if err != nil {
-		log.Print(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		apperr.Write(w, nil, apperr.ErrInternal.Wrap(err))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(data)
 	if err != nil {
-		log.Print(err)
+		logger.Default().Warn("write response", logger.Err(err))
 	}
 }
+// decodeJSON strictly decodes limited request body into dst and validates it
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	if err != nil {
+		return decodeError(err)
+	}
+	if decoder.More() {
+		return apperr.ErrBadRequest.WithDetails(apperr.Detail{Message: "body must contain a single JSON object"})
+	}
+	if n, ok := dst.(normalizer); ok {
+		n.Normalize()
+	}
+	return validate.Struct(dst)
+}
+
+// normalizer is implemented by requests which bring fields to canonical
+// form before validation, e.g. phones to E.164
+type normalizer interface {
+	Normalize()
+}
+
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return apperr.ErrBadRequest.Wrap(err).WithDetails(apperr.Detail{
+			Message: "malformed JSON at position " + strconv.FormatInt(syntaxErr.Offset, 10),
+		})
+	case errors.As(err, &typeErr):
+		return apperr.ErrBadRequest.Wrap(err).WithDetails(apperr.Detail{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: "must be " + typeErr.Type.String(),
+		})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return apperr.ErrBadRequest.Wrap(err).WithDetails(apperr.Detail{
+			Field:   strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`),
+			Rule:    "unknown",
+			Message: "unknown field",
+		})
+	case errors.Is(err, io.EOF):
+		return apperr.ErrBadRequest.WithDetails(apperr.Detail{Message: "body is empty"})
+	case err.Error() == "http: request body too large":
+		return errBodyTooLarge
+	}
+	return apperr.ErrBadRequest.Wrap(err)
+}
+
+// responceError writes error as JSON envelope with status chosen by apperr
+func responceError(w http.ResponseWriter, r *http.Request, err error) {
+	apperr.Write(w, r, err)
+}
+
+// pathID parses {id} variable of the route
+func pathID(r *http.Request) (int64, error) {
+	idParam, ok := mux.Vars(r)["id"]
+	if !ok {
+		return 0, apperr.ErrBadRequest.WithDetails(apperr.Detail{Field: "id", Message: "missing id"})
+	}
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		return 0, apperr.ErrBadRequest.Wrap(err).WithDetails(apperr.Detail{Field: "id", Message: "id must be an integer"})
+	}
+	return id, nil
+}
+
+// authenticatedAdmin returns id of authenticated manager with administrator role
+func (s *Server) authenticatedAdmin(r *http.Request) (int64, error) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		return 0, err
+	}
+	if !s.managersSvc.IsAdmin(r.Context(), id) {
+		return 0, managers.ErrNotAdmin
+	}
+	return id, nil
+}
+
+// authenticatedID returns id set by Authenticate middleware,
+// anonymous requests get ErrUnauthorized
+func authenticatedID(r *http.Request) (int64, error) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil || id == 0 {
+		return 0, apperr.ErrUnauthorized
+	}
+	return id, nil
+}
+
 // Init server with its routes
 func (s *Server) Init() {
-	// Authenticate customers routes by token and create prefix /api/customers
+	// Every request gets id and access log record, including unmatched ones
+	s.handler = middleware.RequestID(middleware.Logger(middleware.Metrics(metrics.Default, s.routeTemplate)(s.mux)))
+
+	// Probes for orchestrator and build information, no authentication
+	s.mux.HandleFunc("/healthz", s.handleHealthz).Methods(GET)
+	s.mux.HandleFunc("/readyz", s.handleReadyz).Methods(GET)
+	s.mux.HandleFunc("/version", s.handleVersion).Methods(GET)
+
+	// Prometheus metrics
+	s.mux.HandleFunc("/metrics", s.handleMetrics).Methods(GET)
+
+	// API specification and its viewer
+	s.mux.HandleFunc("/openapi.json", s.handleOpenAPI).Methods(GET)
+	s.mux.HandleFunc("/docs", s.handleDocs).Methods(GET)
+
+	// Current version of API
+	s.registerV1(s.mux.PathPrefix(apiV1).Subrouter())
+
+	// Un-versioned /api is an alias of v1 kept for old clients
+	unversioned := s.mux.PathPrefix(apiUnversioned).Subrouter()
+	unversioned.Use(middleware.Deprecated(s.config.Sunset, middleware.SuccessorPrefix(apiUnversioned, apiV1)))
+	s.registerV1(unversioned)
+
+	// Un-prefixed customers routes
+	s.registerLegacy(s.mux.PathPrefix(legacyCustomers).Subrouter())
+
+	// s.mux.Use(middleware.Basic(s.securitySvc.Auth))
+}
+
+// routeTemplate returns template of the route matching request, it's used
+// as metrics label instead of raw path
+func (s *Server) routeTemplate(r *http.Request) string {
+	var match mux.RouteMatch
+	if !s.mux.Match(r, &match) || match.Route == nil {
+		return "unmatched"
+	}
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return "unmatched"
+	}
+	return template
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, err := metrics.Default.WriteTo(w)
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("write metrics", logger.Err(err))
+	}
+}
+
+// registerV1 registers handlers of API version 1 on router
+func (s *Server) registerV1(router *mux.Router) {
+	// Authenticate customers routes by token and create prefix /customers
 	customersAuthenticateMd := middleware.Authenticate(s.customersSvc.IDByToken)
-	customersSubrouter := s.mux.PathPrefix("/api/customers").Subrouter()
+	customersSubrouter := router.PathPrefix("/customers").Subrouter()
 	customersSubrouter.Use(customersAuthenticateMd)
-	// Customers routes 
+	customersSubrouter.Use(middleware.AuditActor(audit.RealmCustomer))
+	// Customers routes
 	customersSubrouter.HandleFunc("", s.handleRegisterCustomer).Methods(POST)
-	customersSubrouter.HandleFunc("/token", s.handleGetCustomerToken).Methods(POST)
+	customersSubrouter.Handle("/token", s.loginRateLimit("customers.token", "login")(http.HandlerFunc(s.handleGetCustomerToken))).Methods(POST)
+	customersSubrouter.HandleFunc("/token/validate", s.handleValidateToken).Methods(POST)
+	customersSubrouter.Handle("/verify", s.loginRateLimit("customers.verify", "phone")(http.HandlerFunc(s.handleCustomerVerify))).Methods(POST)
+	customersSubrouter.Handle("/verify/resend", s.loginRateLimit("customers.verify.resend", "phone")(http.HandlerFunc(s.handleCustomerResendVerification))).Methods(POST)
+	customersSubrouter.HandleFunc("/password", s.handleCustomerChangePassword).Methods(POST)
+	customersSubrouter.Handle("/password/reset", s.loginRateLimit("customers.reset", "phone")(http.HandlerFunc(s.handleCustomerRequestPasswordReset))).Methods(POST)
+	customersSubrouter.Handle("/password/reset/confirm", s.loginRateLimit("customers.reset.confirm", "phone")(http.HandlerFunc(s.handleCustomerResetPassword))).Methods(POST)
 	customersSubrouter.HandleFunc("/products", s.handleCustomerGetProducts).Methods(GET)
 	customersSubrouter.HandleFunc("/purchases", s.handleCustomerGetPurchases).Methods(GET)
-	//customersSubrouter.HandleFunc("/purchases", s.handleCustomerMakePurchases).Methods(POST)
+	customersSubrouter.HandleFunc("/purchases/{id}/receipt", s.handleCustomerReceipt).Methods(GET)
+
+	// Enrollment of two-factor authentication accepts tokens limited to it,
+	// registered before /managers so the prefix matches first
+	totpSubrouter := router.PathPrefix("/managers/totp").Subrouter()
+	totpSubrouter.Use(middleware.Authenticate(s.managersSvc.IDByEnrollmentToken))
+	totpSubrouter.Use(middleware.AuditActor(audit.RealmManager))
+	totpSubrouter.HandleFunc("/enroll", s.handleManagerEnrollTOTP).Methods(POST)
+	totpSubrouter.HandleFunc("/confirm", s.handleManagerConfirmTOTP).Methods(POST)
+	totpSubrouter.HandleFunc("/recovery-codes", s.handleManagerRegenerateRecoveryCodes).Methods(POST)
+	totpSubrouter.HandleFunc("/disable", s.handleManagerDisableTOTP).Methods(POST)
 
-	//Authenticate managers routes by token and create prefix /api/managers
+	// Authenticate managers routes by token and create prefix /managers
 	managersAuthenticateMd := middleware.Authenticate(s.managersSvc.IDByToken)
-	managersSubrouter := s.mux.PathPrefix("/api/managers").Subrouter()
+	managersSubrouter := router.PathPrefix("/managers").Subrouter()
 	managersSubrouter.Use(managersAuthenticateMd)
+	managersSubrouter.Use(middleware.AuditActor(audit.RealmManager))
 	// Managers routes
 	managersSubrouter.HandleFunc("", s.handleManagerRegistration).Methods(POST)
-	managersSubrouter.HandleFunc("/token", s.handleManagerGetToken).Methods(POST)
+	managersSubrouter.Handle("/token", s.loginRateLimit("managers.token", "phone")(http.HandlerFunc(s.handleManagerGetToken))).Methods(POST)
+	managersSubrouter.Handle("/token/totp", s.loginRateLimit("managers.token.totp", "")(http.HandlerFunc(s.handleManagerVerifyTOTP))).Methods(POST)
+	managersSubrouter.HandleFunc("/security-policy", s.handleManagerGetSecurityPolicy).Methods(GET)
+	managersSubrouter.HandleFunc("/security-policy", s.handleManagerSetSecurityPolicy).Methods(PUT)
+	managersSubrouter.HandleFunc("/password", s.handleManagerChangePassword).Methods(POST)
+	managersSubrouter.Handle("/password/reset", s.loginRateLimit("managers.reset", "phone")(http.HandlerFunc(s.handleManagerRequestPasswordReset))).Methods(POST)
+	managersSubrouter.Handle("/password/reset/confirm", s.loginRateLimit("managers.reset.confirm", "phone")(http.HandlerFunc(s.handleManagerResetPassword))).Methods(POST)
+	managersSubrouter.Handle("/invitations/accept", s.loginRateLimit("managers.invitation", "")(http.HandlerFunc(s.handleManagerAcceptInvitation))).Methods(POST)
 	managersSubrouter.HandleFunc("/sales", s.handleManagerGetSales).Methods(GET)
 	managersSubrouter.HandleFunc("/sales", s.handleManagerMakeSale).Methods(POST)
+	managersSubrouter.HandleFunc("/sales/{id}/receipt", s.handleManagerReceipt).Methods(GET)
+	managersSubrouter.HandleFunc("/sales/{id}/payments", s.handleManagerGetPayments).Methods(GET)
+	managersSubrouter.HandleFunc("/sales/{id}/payments", s.handleManagerPay).Methods(POST)
+	managersSubrouter.HandleFunc("/payments/{id}/capture", s.handleManagerCapturePayment).Methods(POST)
+	managersSubrouter.HandleFunc("/payments/{id}/refund", s.handleManagerRefundPayment).Methods(POST)
+	managersSubrouter.HandleFunc("/events", s.handleManagerEvents).Methods(GET)
+	managersSubrouter.HandleFunc("/reports/sales", s.handleManagerSalesReport).Methods(GET)
+	managersSubrouter.HandleFunc("/reports/sales/{dimension:manager|department|product|customer}", s.handleManagerGroupReport).Methods(GET)
+	managersSubrouter.HandleFunc("/export/{entity:customers|products|sales}", s.handleManagerExport).Methods(GET)
 	managersSubrouter.HandleFunc("/products", s.handleManagerGetProducts).Methods(GET)
 	managersSubrouter.HandleFunc("/products", s.handleManagerChangeProducts).Methods(POST)
+	managersSubrouter.HandleFunc("/products/import", s.handleManagerImportProducts).Methods(POST)
+	managersSubrouter.HandleFunc("/products/reorder", s.handleManagerReorderProducts).Methods(GET)
+	managersSubrouter.HandleFunc("/products/by-sku/{sku}", s.handleManagerProductBySKU).Methods(GET)
+	managersSubrouter.HandleFunc("/products/by-barcode/{code}", s.handleManagerProductByBarcode).Methods(GET)
 	managersSubrouter.HandleFunc("/products/{id}", s.handleManagerRemoveProductByID).Methods(DELETE)
+	managersSubrouter.HandleFunc("/products/{id}/availability", s.handleManagerProductAvailability).Methods(GET)
+	managersSubrouter.HandleFunc("/reservations", s.handleManagerGetReservations).Methods(GET)
+	managersSubrouter.HandleFunc("/reservations", s.handleManagerReserve).Methods(POST)
+	managersSubrouter.HandleFunc("/reservations/{id}", s.handleManagerReleaseReservation).Methods(DELETE)
 	managersSubrouter.HandleFunc("/customers", s.handleManagerGetCustomers).Methods(GET)
 	managersSubrouter.HandleFunc("/customers", s.handleManagerChangeCustomer).Methods(POST)
+	managersSubrouter.HandleFunc("/customers/{id}", s.handleManagerGetCustomerByID).Methods(GET)
 	managersSubrouter.HandleFunc("/customers/{id}", s.handleManagerRemoveCustomerByID).Methods(DELETE)
+	managersSubrouter.HandleFunc("/customers/{id}/block", s.handleManagerBlockCustomerByID).Methods(POST)
+	managersSubrouter.HandleFunc("/customers/{id}/block", s.handleManagerUnblockCustomerByID).Methods(DELETE)
+	managersSubrouter.HandleFunc("/customers/{id}/lock", s.handleManagerUnlockCustomer).Methods(DELETE)
+	managersSubrouter.HandleFunc("/managers/{id}/lock", s.handleManagerUnlockManager).Methods(DELETE)
+	managersSubrouter.HandleFunc("/audit", s.handleManagerGetAudit).Methods(GET)
+	managersSubrouter.HandleFunc("/tax-classes", s.handleManagerGetTaxClasses).Methods(GET)
+	managersSubrouter.HandleFunc("/tax-classes", s.handleManagerCreateTaxClass).Methods(POST)
+	managersSubrouter.HandleFunc("/tax-classes/{id}", s.handleManagerUpdateTaxClass).Methods(PUT)
+	managersSubrouter.HandleFunc("/tax-classes/{id}/rates", s.handleManagerAddTaxRate).Methods(POST)
+	managersSubrouter.HandleFunc("/exchange-rates", s.handleManagerGetExchangeRates).Methods(GET)
+	managersSubrouter.HandleFunc("/exchange-rates", s.handleManagerAddExchangeRate).Methods(POST)
+	managersSubrouter.HandleFunc("/webhooks", s.handleManagerGetWebhooks).Methods(GET)
+	managersSubrouter.HandleFunc("/webhooks", s.handleManagerCreateWebhook).Methods(POST)
+	managersSubrouter.HandleFunc("/webhooks/{id}", s.handleManagerUpdateWebhook).Methods(PUT)
+	managersSubrouter.HandleFunc("/webhooks/{id}", s.handleManagerRemoveWebhook).Methods(DELETE)
+	managersSubrouter.HandleFunc("/webhooks/{id}/deliveries", s.handleManagerGetWebhookDeliveries).Methods(GET)
+	managersSubrouter.HandleFunc("/outbox/events", s.handleManagerGetOutboxEvents).Methods(GET)
+	managersSubrouter.HandleFunc("/outbox/events/{id}/replay", s.handleManagerReplayOutboxEvent).Methods(POST)
+}
+
+// loginRateLimit limits login attempts per client address and per
+// phone taken from field of the request body, empty field limits by address only
+func (s *Server) loginRateLimit(name string, phoneField string) func(http.Handler) http.Handler {
+	rules := []middleware.RateRule{
+		{Name: name + ".ip", Limit: s.config.LoginRateIP, Key: middleware.ClientIP},
+	}
+	if phoneField != "" {
+		rules = append(rules, middleware.RateRule{Name: name + ".phone", Limit: s.config.LoginRatePhone, Key: middleware.PhoneField(phoneField)})
+	}
+	return middleware.RateLimit(s.limiter, rules...)
+}
 
+// legacySuccessor returns v1 route replacing legacy customers route. Active
+// customers are listed by /managers/customers, listing of every customer
+// has no v1 route, so it gets no successor link.
+func legacySuccessor(r *http.Request) string {
+	switch r.URL.Path {
+	case legacyCustomers:
+		if r.Method == GET {
+			return ""
+		}
+	case legacyCustomers + "/active":
+		return apiV1 + "/managers/customers"
+	}
+	return middleware.SuccessorPrefix(legacyCustomers, apiV1+"/managers/customers")(r)
+}
 
-	// Customer's routes without prefixes
-	s.mux.HandleFunc("/api/customers/token", s.handleGetCustomerToken).Methods(POST)
-	s.mux.HandleFunc("/api/customers/token/validate", s.handleValidateToken).Methods(POST)
-	s.mux.HandleFunc("/api/customers", s.handleSaveCustomer).Methods(POST)
-	
-	s.mux.HandleFunc("/customers", 			s.handleGetAllCustomers).Methods(GET)
-	s.mux.HandleFunc("/customers/active", 	s.handleGetAllActiveCustomers).Methods(GET)
-	s.mux.HandleFunc("/customers/{id}", 	s.handleGetCustomerByID).Methods(GET)
-	s.mux.HandleFunc("/customers", 			s.handleSaveCustomer).Methods(POST)
-	s.mux.HandleFunc("/customers/{id}",		 s.handleRemoveCustomerByID).Methods(DELETE)
-	s.mux.HandleFunc("/customers/{id}/block", s.handleblockCustomerByID).Methods(POST)
-	s.mux.HandleFunc("/customers/{id}/block", s.handleUnblockCustomerByID).Methods(DELETE)
+// registerLegacy registers deprecated un-prefixed customers routes,
+// they require manager token unless compatibility mode is on
+func (s *Server) registerLegacy(router *mux.Router) {
+	router.Use(middleware.Deprecated(s.config.Sunset, legacySuccessor))
+	if !s.config.LegacyCompat {
+		router.Use(middleware.Authenticate(s.managersSvc.IDByToken))
+		router.Use(middleware.RequireAuthentication)
+	}
+	router.Use(middleware.AuditActor(audit.RealmManager))
 
-	// s.mux.Use(middleware.Basic(s.securitySvc.Auth))
-	// s.mux.Use(middleware.Logger)
-	
-	//s.mux.HandleFunc("/customers.getById", 		s.handleGetCustomerByID)
-	//s.mux.HandleFunc("/customers.getAll",			s.handleGetAllCustomers)
-	//s.mux.HandleFunc("/customers.save", 			s.handleSaveCustomer)
-	//s.mux.HandleFunc("/customers.removeById", 	s.handleRemoveCustomerByID)
-	//s.mux.HandleFunc("/customers.getAllActive", 	s.handleGetAllActiveCustomers)
-	//s.mux.HandleFunc("/customers.blockById", 		s.handleblockCustomerByID)
-	//s.mux.HandleFunc("/customers.unblockById", 	s.handleUnblockCustomerByID)
-}
\ No newline at end of file
+	router.HandleFunc("", s.handleGetAllCustomers).Methods(GET)
+	router.HandleFunc("/active", s.handleGetAllActiveCustomers).Methods(GET)
+	router.HandleFunc("/{id}", s.handleGetCustomerByID).Methods(GET)
+	router.HandleFunc("", s.handleSaveCustomer).Methods(POST)
+	router.HandleFunc("/{id}", s.handleRemoveCustomerByID).Methods(DELETE)
+	router.HandleFunc("/{id}/block", s.handleblockCustomerByID).Methods(POST)
+	router.HandleFunc("/{id}/block", s.handleUnblockCustomerByID).Methods(DELETE)
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/darkside1809/gosql/pkg/taxes"
+)
+
+// handleManagerGetTaxClasses returns tax classes with their rates
+func (s *Server) handleManagerGetTaxClasses(w http.ResponseWriter, r *http.Request) {
+	_, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	items, err := s.taxesSvc.Classes(r.Context())
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, items)
+}
+
+// handleManagerCreateTaxClass creates tax class, administrators only
+func (s *Server) handleManagerCreateTaxClass(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &taxes.Class{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	item.ID = 0
+
+	saved, err := s.taxesSvc.SaveClass(r.Context(), item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, saved)
+}
+
+func (s *Server) handleManagerUpdateTaxClass(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	classID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &taxes.Class{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	item.ID = classID
+
+	saved, err := s.taxesSvc.SaveClass(r.Context(), item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, saved)
+}
+
+// handleManagerAddTaxRate schedules new rate of tax class, administrators only
+func (s *Server) handleManagerAddTaxRate(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	classID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &taxes.Rate{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	saved, err := s.taxesSvc.AddRate(r.Context(), classID, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, saved)
+}
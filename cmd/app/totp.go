@@ -0,0 +1,151 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/darkside1809/gosql/pkg/managers"
+)
+
+func (s *Server) handleManagerVerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	item := &managers.TOTPVerification{}
+	err := decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	login, err := s.managersSvc.VerifyTOTP(r.Context(), item.Challenge, item.Code)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, login)
+}
+
+func (s *Server) handleManagerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	enrollment, err := s.managersSvc.EnrollTOTP(r.Context(), id)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, enrollment)
+}
+
+func (s *Server) handleManagerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &managers.TOTPCode{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	codes, err := s.managersSvc.ConfirmTOTP(r.Context(), id, item.Code)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, codes)
+}
+
+func (s *Server) handleManagerRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &managers.TOTPCode{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	codes, err := s.managersSvc.RegenerateRecoveryCodes(r.Context(), id, item.Code)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, codes)
+}
+
+func (s *Server) handleManagerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &managers.TOTPCode{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.managersSvc.DisableTOTP(r.Context(), id, item.Code)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleManagerGetSecurityPolicy returns security policy, administrators only
+func (s *Server) handleManagerGetSecurityPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	if !s.managersSvc.IsAdmin(r.Context(), id) {
+		responceError(w, r, managers.ErrNotAdmin)
+		return
+	}
+
+	policy, err := s.managersSvc.SecurityPolicy(r.Context())
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, policy)
+}
+
+// handleManagerSetSecurityPolicy changes security policy, administrators only
+func (s *Server) handleManagerSetSecurityPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := authenticatedID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	if !s.managersSvc.IsAdmin(r.Context(), id) {
+		responceError(w, r, managers.ErrNotAdmin)
+		return
+	}
+
+	item := &managers.SecurityPolicy{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.managersSvc.SetSecurityPolicy(r.Context(), item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, item)
+}
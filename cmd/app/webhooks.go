@@ -0,0 +1,188 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/outbox"
+)
+
+// handleManagerGetWebhooks returns webhook subscriptions, administrators only
+func (s *Server) handleManagerGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	items, err := s.outboxSvc.Subscriptions(r.Context())
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, items)
+}
+
+// handleManagerCreateWebhook subscribes endpoint to events, secret is returned only here
+func (s *Server) handleManagerCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &outbox.Subscription{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	item.ID = 0
+
+	saved, err := s.outboxSvc.SaveSubscription(r.Context(), item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, saved)
+}
+
+func (s *Server) handleManagerUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	subscriptionID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &outbox.Subscription{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	item.ID = subscriptionID
+
+	saved, err := s.outboxSvc.SaveSubscription(r.Context(), item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, saved)
+}
+
+func (s *Server) handleManagerRemoveWebhook(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	subscriptionID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	err = s.outboxSvc.RemoveSubscription(r.Context(), subscriptionID)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleManagerGetWebhookDeliveries returns deliveries of the subscription filtered by status
+func (s *Server) handleManagerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	subscriptionID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", outbox.StatusPending, outbox.StatusDelivered, outbox.StatusDead:
+	default:
+		responceError(w, r, apperr.ErrBadRequest.WithDetails(apperr.Detail{
+			Field: "status", Rule: "oneof", Message: "must be one of pending delivered dead",
+		}))
+		return
+	}
+
+	items, err := s.outboxSvc.Deliveries(r.Context(), subscriptionID, status)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, items)
+}
+
+// handleManagerGetOutboxEvents returns page of published events, newest first
+func (s *Server) handleManagerGetOutboxEvents(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	var beforeID int64
+	if value := query.Get("before_id"); value != "" {
+		beforeID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || beforeID < 0 {
+			responceError(w, r, apperr.ErrBadRequest.WithDetails(apperr.Detail{
+				Field: "before_id", Rule: "type", Message: "must be a positive integer",
+			}))
+			return
+		}
+	}
+
+	items, err := s.outboxSvc.Events(r.Context(), query.Get("type"), beforeID)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, items)
+}
+
+// handleManagerReplayOutboxEvent schedules event to subscriptions again
+func (s *Server) handleManagerReplayOutboxEvent(w http.ResponseWriter, r *http.Request) {
+	_, err := s.authenticatedAdmin(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	eventID, err := pathID(r)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	item := &outbox.Replay{}
+	err = decodeJSON(w, r, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+
+	result, err := s.outboxSvc.Replay(r.Context(), eventID, item)
+	if err != nil {
+		responceError(w, r, err)
+		return
+	}
+	responceByJson(w, result)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/managers"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// importProducts is import-products command: it upserts products by SKU
+// from CSV or JSON Lines file, "-" is standard input, and prints report as JSON
+func importProducts(dsn string, args []string) error {
+	flags := flag.NewFlagSet("import-products", flag.ContinueOnError)
+	format := flags.String("format", "", "csv or jsonl, taken from file extension by default")
+	dryRun := flags.Bool("dry-run", false, "validate and report without writing")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: import-products [-format csv|jsonl] [-dry-run] FILE")
+	}
+	path := flags.Arg(0)
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = managers.ImportCSV
+		case ".jsonl", ".ndjson":
+			*format = managers.ImportJSONLines
+		default:
+			return errors.New("import-products: -format is required for " + path)
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	ctx := context.Background()
+	connCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	pool, err := pgxpool.Connect(connCtx, dsn)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	svc, err := newManagersService(pool, nil, nil)
+	if err != nil {
+		return err
+	}
+	report, err := svc.ImportProducts(ctx, *format, in, *dryRun)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
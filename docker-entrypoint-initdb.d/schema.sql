@@ -4,6 +4,9 @@ CREATE TABLE customers (
    phone      TEXT      NOT NULL UNIQUE,
    password   TEXT      NOT NULL,
    active     BOOLEAN   NOT NULL DEFAULT TRUE,
+   verified   BOOLEAN   NOT NULL DEFAULT FALSE,
+   failed_logins INTEGER NOT NULL DEFAULT 0,
+   locked_until  TIMESTAMP,
    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -19,6 +22,11 @@ CREATE TABLE managers (
    password   TEXT      NOT NULL,
    is_admin   BOOLEAN   NOT NULL DEFAULT TRUE,
    active     BOOLEAN   NOT NULL DEFAULT TRUE,
+   failed_logins INTEGER NOT NULL DEFAULT 0,
+   locked_until  TIMESTAMP,
+   totp_secret    TEXT,
+   totp_enabled   BOOLEAN NOT NULL DEFAULT FALSE,
+   totp_last_step BIGINT  NOT NULL DEFAULT 0,
    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 ); 
 
@@ -42,30 +50,263 @@ CREATE TABLE customers_tokens (
 CREATE TABLE managers_tokens (
    token       TEXT NOT NULL      UNIQUE,
    manager_id  BIGINT NOT NULL    REFERENCES managers,
+   scope       TEXT NOT NULL      DEFAULT 'full',
    expire      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP + INTERVAL '1 hour',
    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Tax classes of products, e.g. standard or reduced
+CREATE TABLE tax_classes (
+   id      BIGSERIAL PRIMARY KEY,
+   code    TEXT      NOT NULL UNIQUE,
+   name    TEXT      NOT NULL,
+   created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Rates of tax classes in basis points, rate applies from effective time
+-- until the next rate of the class
+CREATE TABLE tax_rates (
+   id        BIGSERIAL PRIMARY KEY,
+   class_id  BIGINT    NOT NULL REFERENCES tax_classes,
+   rate      INTEGER   NOT NULL CHECK(rate >= 0 AND rate <= 10000),
+   effective TIMESTAMP NOT NULL,
+   created   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   UNIQUE (class_id, effective)
+);
+
 CREATE TABLE products (
    id      BIGSERIAL PRIMARY KEY,
+   -- stock keeping unit, products entered by hand may have none
+   sku     TEXT      UNIQUE,
+   -- EAN-8 or GTIN-13, UPC-A and GTIN-14 codes are stored as GTIN-13
+   barcode TEXT      UNIQUE,
+   -- products without tax class are not taxed
+   tax_class_id BIGINT REFERENCES tax_classes,
    name    TEXT      NOT NULL,
+   -- price in minor units of ISO 4217 currency
    price   BIGINT    NOT NULL CHECK(price >= 0),
+   currency TEXT     NOT NULL DEFAULT 'TJS' CHECK(currency ~ '^[A-Z]{3}$'),
    qty     BIGINT    NOT NULL DEFAULT 0 CHECK(qty >= 0),
    active  BOOLEAN   NOT NULL DEFAULT TRUE,
+   -- stock below which product is reordered, NULL is APP_LOW_STOCK_THRESHOLD
+   reorder_threshold BIGINT CHECK(reorder_threshold >= 0),
+   -- set when administrators were notified of low stock, cleared when
+   -- stock is back above the threshold
+   reorder_alerted   TIMESTAMP,
    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);
    
 CREATE TABLE sales (
    id          BIGSERIAL          PRIMARY KEY,
    manager_id  BIGINT NOT NULL    REFERENCES managers,
    customer_id BIGINT NOT NULL    REFERENCES customers,
+   -- invoice number, taken from invoice_numbers
+   number      BIGINT NOT NULL    UNIQUE,
+   -- follows payments of the sale, see payments
+   status      TEXT   NOT NULL    DEFAULT 'pending' CHECK(status IN ('pending', 'paid', 'partially_refunded', 'refunded')),
    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Last invoice number, the only row is locked by transaction of the sale
+-- until it commits, so numbers have no gaps
+CREATE TABLE invoice_numbers (
+   id   BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK(id),
+   last BIGINT  NOT NULL
+);
+INSERT INTO invoice_numbers (last) VALUES (0);
+
 CREATE TABLE sale_positions (
     id          BIGSERIAL           PRIMARY KEY,
     product_id  BIGINT    NOT NULL  REFERENCES products,
     sale_id     BIGINT    NOT NULL  REFERENCES sales,
     price       BIGINT    NOT NULL  CHECK(price >= 0),
+    -- currency of the product when it was sold, positions of a sale share it
+    currency    TEXT      NOT NULL  DEFAULT 'TJS' CHECK(currency ~ '^[A-Z]{3}$'),
     qty         BIGINT    NOT NULL  DEFAULT 0 CHECK(qty >= 0),
+    -- tax of the position at rate in effect when it was sold, total is paid
+    -- by customer and includes tax
+    tax_rate    INTEGER   NOT NULL  DEFAULT 0,
+    tax         BIGINT    NOT NULL  DEFAULT 0,
+    total       BIGINT    NOT NULL,
     created     TIMESTAMP NOT NULL  DEFAULT CURRENT_TIMESTAMP
 );
+-- sales velocity of products for reorder suggestions
+CREATE INDEX sale_positions_product_idx ON sale_positions (product_id);
+
+-- One-time codes of password reset, phone verification and manager invitations, only hashes are stored
+CREATE TABLE password_codes (
+    id          BIGSERIAL PRIMARY KEY,
+    realm       TEXT      NOT NULL,
+    purpose     TEXT      NOT NULL,
+    user_id     BIGINT    NOT NULL,
+    code_hash   TEXT      NOT NULL,
+    attempts    INTEGER   NOT NULL DEFAULT 0,
+    expire      TIMESTAMP NOT NULL,
+    used        TIMESTAMP,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX password_codes_user_idx ON password_codes (realm, purpose, user_id);
+CREATE INDEX password_codes_hash_idx ON password_codes (code_hash);
+
+-- Recovery codes of managers with two-factor authentication, only hashes are stored
+CREATE TABLE managers_recovery_codes (
+    id          BIGSERIAL PRIMARY KEY,
+    manager_id  BIGINT    NOT NULL REFERENCES managers,
+    code_hash   TEXT      NOT NULL,
+    used        TIMESTAMP,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX managers_recovery_codes_manager_idx ON managers_recovery_codes (manager_id);
+
+-- Settings changed by administrators at runtime, e.g. security policy
+CREATE TABLE settings (
+    key         TEXT      PRIMARY KEY,
+    value       TEXT      NOT NULL,
+    updated     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Append-only log of writes, see pkg/audit, the trigger rejects changes of entries
+CREATE TABLE audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    actor_realm TEXT,
+    actor_id    BIGINT,
+    action      TEXT      NOT NULL,
+    target      TEXT      NOT NULL,
+    target_id   BIGINT,
+    before_data JSONB,
+    after_data  JSONB,
+    changes     JSONB,
+    ip          TEXT,
+    request_id  TEXT,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_realm, actor_id);
+CREATE INDEX audit_log_target_idx ON audit_log (target, target_id);
+CREATE INDEX audit_log_created_idx ON audit_log (created);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_append_only();
+
+-- Domain events written in the transaction of the change, see pkg/outbox
+CREATE TABLE outbox_events (
+    id           BIGSERIAL PRIMARY KEY,
+    type         TEXT      NOT NULL,
+    aggregate    TEXT      NOT NULL,
+    aggregate_id BIGINT    NOT NULL,
+    payload      JSONB     NOT NULL,
+    request_id   TEXT,
+    dispatched   TIMESTAMP,
+    created      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX outbox_events_pending_idx ON outbox_events (id) WHERE dispatched IS NULL;
+CREATE INDEX outbox_events_type_idx ON outbox_events (type, id);
+
+-- Webhook endpoints of downstream systems, empty event_types is every event
+CREATE TABLE webhook_subscriptions (
+    id          BIGSERIAL PRIMARY KEY,
+    url         TEXT      NOT NULL,
+    secret      TEXT      NOT NULL,
+    event_types TEXT[]    NOT NULL DEFAULT '{}',
+    active      BOOLEAN   NOT NULL DEFAULT TRUE,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Deliveries of events to subscriptions, status is pending, delivered or dead
+CREATE TABLE webhook_deliveries (
+    id              BIGSERIAL PRIMARY KEY,
+    event_id        BIGINT    NOT NULL REFERENCES outbox_events,
+    subscription_id BIGINT    NOT NULL REFERENCES webhook_subscriptions ON DELETE CASCADE,
+    status          TEXT      NOT NULL DEFAULT 'pending',
+    attempts        INTEGER   NOT NULL DEFAULT 0,
+    next_attempt    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_status     INTEGER,
+    last_error      TEXT,
+    delivered       TIMESTAMP,
+    created         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (event_id, subscription_id)
+);
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, id);
+
+-- Committed events are announced on channel outbox_events, payload is id of the event
+CREATE FUNCTION outbox_events_notify() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('outbox_events', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER outbox_events_notify AFTER INSERT ON outbox_events
+    FOR EACH ROW EXECUTE PROCEDURE outbox_events_notify();
+
+-- Exchange rates for consolidated reports, one unit of currency costs rate
+-- units of base currency from the effective time
+CREATE TABLE exchange_rates (
+    id          BIGSERIAL PRIMARY KEY,
+    currency    TEXT      NOT NULL CHECK(currency ~ '^[A-Z]{3}$'),
+    base        TEXT      NOT NULL CHECK(base ~ '^[A-Z]{3}$'),
+    rate        NUMERIC(20, 10) NOT NULL CHECK(rate > 0),
+    effective   TIMESTAMP NOT NULL,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK(currency <> base),
+    UNIQUE (currency, base, effective)
+);
+
+-- Stock held for pending orders, available stock is qty of the product less
+-- active reservations which have not expired yet
+CREATE TABLE reservations (
+    id          BIGSERIAL PRIMARY KEY,
+    product_id  BIGINT    NOT NULL REFERENCES products,
+    -- reservation without customer may be sold to any customer
+    customer_id BIGINT    REFERENCES customers,
+    manager_id  BIGINT    NOT NULL REFERENCES managers,
+    qty         BIGINT    NOT NULL CHECK(qty > 0),
+    status      TEXT      NOT NULL DEFAULT 'active' CHECK(status IN ('active', 'converted', 'released', 'expired')),
+    expires     TIMESTAMP NOT NULL,
+    -- sale the reservation was converted into
+    sale_id     BIGINT    REFERENCES sales,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX reservations_product_idx ON reservations (product_id) WHERE status = 'active';
+CREATE INDEX reservations_expires_idx ON reservations (expires) WHERE status = 'active';
+
+-- Payments of sales, a sale may be paid by several payments of any method
+CREATE TABLE payments (
+    id          BIGSERIAL PRIMARY KEY,
+    sale_id     BIGINT    NOT NULL REFERENCES sales,
+    manager_id  BIGINT    NOT NULL REFERENCES managers,
+    method      TEXT      NOT NULL CHECK(method IN ('cash', 'card', 'transfer')),
+    -- authorized amount in minor units of currency of the sale
+    amount      BIGINT    NOT NULL CHECK(amount > 0),
+    currency    TEXT      NOT NULL CHECK(currency ~ '^[A-Z]{3}$'),
+    -- provider is called after pending payment is committed, capturing is
+    -- sent to the provider and not confirmed yet
+    status      TEXT      NOT NULL CHECK(status IN ('pending', 'authorized', 'capturing', 'captured', 'refunded', 'declined')),
+    -- the same key is the same payment at the provider
+    idempotency_key TEXT  NOT NULL UNIQUE,
+    authorize_only  BOOLEAN NOT NULL DEFAULT FALSE,
+    refunded    BIGINT    NOT NULL DEFAULT 0 CHECK(refunded >= 0),
+    -- refund sent to the provider with refund_key and not confirmed yet
+    refunding   BIGINT    NOT NULL DEFAULT 0 CHECK(refunding >= 0),
+    refund_key  TEXT,
+    -- reference of the payment at the provider, cash has none
+    reference   TEXT,
+    error       TEXT,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK(refunded + refunding <= amount)
+);
+CREATE INDEX payments_sale_idx ON payments (sale_id);
+
+-- Version of the schema, checked by /readyz, see migrations directory
+CREATE TABLE schema_migrations (
+    version     BIGINT    PRIMARY KEY,
+    applied     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO schema_migrations (version) VALUES (17);
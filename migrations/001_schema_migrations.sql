@@ -0,0 +1,8 @@
+-- Databases created before schema versioning: records baseline schema as version 1.
+-- Every schema change adds next numbered file here, updates
+-- docker-entrypoint-initdb.d/schema.sql and bumps schemaVersion in cmd/app/health.go
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version     BIGINT    PRIMARY KEY,
+    applied     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO schema_migrations (version) VALUES (1) ON CONFLICT DO NOTHING;
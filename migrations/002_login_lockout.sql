@@ -0,0 +1,6 @@
+-- Failed logins in a row and progressive lock of customers and managers accounts
+ALTER TABLE customers ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE customers ADD COLUMN locked_until TIMESTAMP;
+ALTER TABLE managers ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE managers ADD COLUMN locked_until TIMESTAMP;
+INSERT INTO schema_migrations (version) VALUES (2);
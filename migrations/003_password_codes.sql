@@ -0,0 +1,15 @@
+-- One-time codes of password reset and manager invitations
+CREATE TABLE password_codes (
+    id          BIGSERIAL PRIMARY KEY,
+    realm       TEXT      NOT NULL,
+    purpose     TEXT      NOT NULL,
+    user_id     BIGINT    NOT NULL,
+    code_hash   TEXT      NOT NULL,
+    attempts    INTEGER   NOT NULL DEFAULT 0,
+    expire      TIMESTAMP NOT NULL,
+    used        TIMESTAMP,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX password_codes_user_idx ON password_codes (realm, purpose, user_id);
+CREATE INDEX password_codes_hash_idx ON password_codes (code_hash);
+INSERT INTO schema_migrations (version) VALUES (3);
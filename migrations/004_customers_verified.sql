@@ -0,0 +1,4 @@
+-- Customers confirm phone with code sent by SMS, existing customers are trusted
+ALTER TABLE customers ADD COLUMN verified BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE customers SET verified = TRUE;
+INSERT INTO schema_migrations (version) VALUES (4);
@@ -0,0 +1,22 @@
+-- Two-factor authentication of managers with TOTP and recovery codes
+ALTER TABLE managers ADD COLUMN totp_secret TEXT;
+ALTER TABLE managers ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE managers ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+-- Tokens of administrators who must enroll before using the API have scope 'totp_enrollment'
+ALTER TABLE managers_tokens ADD COLUMN scope TEXT NOT NULL DEFAULT 'full';
+
+CREATE TABLE managers_recovery_codes (
+    id          BIGSERIAL PRIMARY KEY,
+    manager_id  BIGINT    NOT NULL REFERENCES managers,
+    code_hash   TEXT      NOT NULL,
+    used        TIMESTAMP,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX managers_recovery_codes_manager_idx ON managers_recovery_codes (manager_id);
+
+CREATE TABLE settings (
+    key         TEXT      PRIMARY KEY,
+    value       TEXT      NOT NULL,
+    updated     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO schema_migrations (version) VALUES (5);
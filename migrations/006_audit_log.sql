@@ -0,0 +1,29 @@
+-- Append-only audit log of writes, the trigger rejects changes of entries
+CREATE TABLE audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    actor_realm TEXT,
+    actor_id    BIGINT,
+    action      TEXT      NOT NULL,
+    target      TEXT      NOT NULL,
+    target_id   BIGINT,
+    before_data JSONB,
+    after_data  JSONB,
+    changes     JSONB,
+    ip          TEXT,
+    request_id  TEXT,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_realm, actor_id);
+CREATE INDEX audit_log_target_idx ON audit_log (target, target_id);
+CREATE INDEX audit_log_created_idx ON audit_log (created);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_append_only();
+INSERT INTO schema_migrations (version) VALUES (6);
@@ -0,0 +1,41 @@
+-- Transactional outbox of domain events and webhook delivery
+CREATE TABLE outbox_events (
+    id           BIGSERIAL PRIMARY KEY,
+    type         TEXT      NOT NULL,
+    aggregate    TEXT      NOT NULL,
+    aggregate_id BIGINT    NOT NULL,
+    payload      JSONB     NOT NULL,
+    request_id   TEXT,
+    dispatched   TIMESTAMP,
+    created      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX outbox_events_pending_idx ON outbox_events (id) WHERE dispatched IS NULL;
+CREATE INDEX outbox_events_type_idx ON outbox_events (type, id);
+
+-- Webhook endpoints of downstream systems, empty event_types is every event
+CREATE TABLE webhook_subscriptions (
+    id          BIGSERIAL PRIMARY KEY,
+    url         TEXT      NOT NULL,
+    secret      TEXT      NOT NULL,
+    event_types TEXT[]    NOT NULL DEFAULT '{}',
+    active      BOOLEAN   NOT NULL DEFAULT TRUE,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Deliveries of events to subscriptions, status is pending, delivered or dead
+CREATE TABLE webhook_deliveries (
+    id              BIGSERIAL PRIMARY KEY,
+    event_id        BIGINT    NOT NULL REFERENCES outbox_events,
+    subscription_id BIGINT    NOT NULL REFERENCES webhook_subscriptions ON DELETE CASCADE,
+    status          TEXT      NOT NULL DEFAULT 'pending',
+    attempts        INTEGER   NOT NULL DEFAULT 0,
+    next_attempt    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_status     INTEGER,
+    last_error      TEXT,
+    delivered       TIMESTAMP,
+    created         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (event_id, subscription_id)
+);
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, id);
+INSERT INTO schema_migrations (version) VALUES (7);
@@ -0,0 +1,10 @@
+-- Committed events are announced on channel outbox_events, payload is id of the event
+CREATE FUNCTION outbox_events_notify() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('outbox_events', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER outbox_events_notify AFTER INSERT ON outbox_events
+    FOR EACH ROW EXECUTE PROCEDURE outbox_events_notify();
+INSERT INTO schema_migrations (version) VALUES (8);
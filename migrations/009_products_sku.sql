@@ -0,0 +1,3 @@
+-- Stock keeping units identify products in imports, products entered by hand may have none
+ALTER TABLE products ADD COLUMN sku TEXT UNIQUE;
+INSERT INTO schema_migrations (version) VALUES (9);
@@ -0,0 +1,3 @@
+-- EAN-8 or GTIN-13 barcodes, UPC-A and GTIN-14 codes are stored as GTIN-13
+ALTER TABLE products ADD COLUMN barcode TEXT UNIQUE;
+INSERT INTO schema_migrations (version) VALUES (10);
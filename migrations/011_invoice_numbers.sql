@@ -0,0 +1,13 @@
+-- Sales get invoice numbers without gaps, existing sales are numbered in order they were made
+ALTER TABLE sales ADD COLUMN number BIGINT UNIQUE;
+UPDATE sales s SET number = n.number
+    FROM (SELECT id, row_number() OVER (ORDER BY id) AS number FROM sales) n
+    WHERE n.id = s.id;
+ALTER TABLE sales ALTER COLUMN number SET NOT NULL;
+
+CREATE TABLE invoice_numbers (
+   id   BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK(id),
+   last BIGINT  NOT NULL
+);
+INSERT INTO invoice_numbers (last) SELECT COALESCE(MAX(number), 0) FROM sales;
+INSERT INTO schema_migrations (version) VALUES (11);
@@ -0,0 +1,26 @@
+-- Tax classes with rates effective from a time, taxes of positions are kept as they were sold
+CREATE TABLE tax_classes (
+   id      BIGSERIAL PRIMARY KEY,
+   code    TEXT      NOT NULL UNIQUE,
+   name    TEXT      NOT NULL,
+   created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE tax_rates (
+   id        BIGSERIAL PRIMARY KEY,
+   class_id  BIGINT    NOT NULL REFERENCES tax_classes,
+   rate      INTEGER   NOT NULL CHECK(rate >= 0 AND rate <= 10000),
+   effective TIMESTAMP NOT NULL,
+   created   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   UNIQUE (class_id, effective)
+);
+
+ALTER TABLE products ADD COLUMN tax_class_id BIGINT REFERENCES tax_classes;
+
+-- positions sold before are untaxed, customers paid their prices
+ALTER TABLE sale_positions ADD COLUMN tax_rate INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sale_positions ADD COLUMN tax BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE sale_positions ADD COLUMN total BIGINT;
+UPDATE sale_positions SET total = price * qty;
+ALTER TABLE sale_positions ALTER COLUMN total SET NOT NULL;
+INSERT INTO schema_migrations (version) VALUES (12);
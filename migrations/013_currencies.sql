@@ -0,0 +1,17 @@
+-- Prices in ISO 4217 currencies, prices entered before are in somoni
+ALTER TABLE products ADD COLUMN currency TEXT NOT NULL DEFAULT 'TJS' CHECK(currency ~ '^[A-Z]{3}$');
+ALTER TABLE sale_positions ADD COLUMN currency TEXT NOT NULL DEFAULT 'TJS' CHECK(currency ~ '^[A-Z]{3}$');
+
+-- Exchange rates for consolidated reports, one unit of currency costs rate
+-- units of base currency from the effective time
+CREATE TABLE exchange_rates (
+    id          BIGSERIAL PRIMARY KEY,
+    currency    TEXT      NOT NULL CHECK(currency ~ '^[A-Z]{3}$'),
+    base        TEXT      NOT NULL CHECK(base ~ '^[A-Z]{3}$'),
+    rate        NUMERIC(20, 10) NOT NULL CHECK(rate > 0),
+    effective   TIMESTAMP NOT NULL,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK(currency <> base),
+    UNIQUE (currency, base, effective)
+);
+INSERT INTO schema_migrations (version) VALUES (13);
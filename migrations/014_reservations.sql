@@ -0,0 +1,19 @@
+-- Stock held for pending orders, available stock is qty of the product less
+-- active reservations which have not expired yet
+CREATE TABLE reservations (
+    id          BIGSERIAL PRIMARY KEY,
+    product_id  BIGINT    NOT NULL REFERENCES products,
+    -- reservation without customer may be sold to any customer
+    customer_id BIGINT    REFERENCES customers,
+    manager_id  BIGINT    NOT NULL REFERENCES managers,
+    qty         BIGINT    NOT NULL CHECK(qty > 0),
+    status      TEXT      NOT NULL DEFAULT 'active' CHECK(status IN ('active', 'converted', 'released', 'expired')),
+    expires     TIMESTAMP NOT NULL,
+    -- sale the reservation was converted into
+    sale_id     BIGINT    REFERENCES sales,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX reservations_product_idx ON reservations (product_id) WHERE status = 'active';
+CREATE INDEX reservations_expires_idx ON reservations (expires) WHERE status = 'active';
+INSERT INTO schema_migrations (version) VALUES (14);
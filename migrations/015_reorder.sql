@@ -0,0 +1,8 @@
+-- Stock below which products are reordered, NULL is APP_LOW_STOCK_THRESHOLD,
+-- reorder_alerted is set when administrators were notified and cleared when
+-- stock is back above the threshold, so alerts are not repeated
+ALTER TABLE products ADD COLUMN reorder_threshold BIGINT CHECK(reorder_threshold >= 0);
+ALTER TABLE products ADD COLUMN reorder_alerted TIMESTAMP;
+-- sales velocity of products for reorder suggestions
+CREATE INDEX sale_positions_product_idx ON sale_positions (product_id);
+INSERT INTO schema_migrations (version) VALUES (15);
@@ -0,0 +1,33 @@
+-- Status of sales follows their payments, sales made before payments were
+-- recorded are taken as paid
+ALTER TABLE sales ADD COLUMN status TEXT NOT NULL DEFAULT 'paid' CHECK(status IN ('pending', 'paid', 'partially_refunded', 'refunded'));
+ALTER TABLE sales ALTER COLUMN status SET DEFAULT 'pending';
+
+-- Payments of sales, a sale may be paid by several payments of any method
+CREATE TABLE payments (
+    id          BIGSERIAL PRIMARY KEY,
+    sale_id     BIGINT    NOT NULL REFERENCES sales,
+    manager_id  BIGINT    NOT NULL REFERENCES managers,
+    method      TEXT      NOT NULL CHECK(method IN ('cash', 'card', 'transfer')),
+    -- authorized amount in minor units of currency of the sale
+    amount      BIGINT    NOT NULL CHECK(amount > 0),
+    currency    TEXT      NOT NULL CHECK(currency ~ '^[A-Z]{3}$'),
+    -- provider is called after pending payment is committed, capturing is
+    -- sent to the provider and not confirmed yet
+    status      TEXT      NOT NULL CHECK(status IN ('pending', 'authorized', 'capturing', 'captured', 'refunded', 'declined')),
+    -- the same key is the same payment at the provider
+    idempotency_key TEXT  NOT NULL UNIQUE,
+    authorize_only  BOOLEAN NOT NULL DEFAULT FALSE,
+    refunded    BIGINT    NOT NULL DEFAULT 0 CHECK(refunded >= 0),
+    -- refund sent to the provider with refund_key and not confirmed yet
+    refunding   BIGINT    NOT NULL DEFAULT 0 CHECK(refunding >= 0),
+    refund_key  TEXT,
+    -- reference of the payment at the provider, cash has none
+    reference   TEXT,
+    error       TEXT,
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK(refunded + refunding <= amount)
+);
+CREATE INDEX payments_sale_idx ON payments (sale_id);
+INSERT INTO schema_migrations (version) VALUES (16);
@@ -0,0 +1,57 @@
+-- Logins, registrations and codes take phones in E.164 format, see phone.Normalize,
+-- so phones stored before are converted the same way. Numbers without + or 00
+-- are national numbers of the country in app.phone_country_code setting, or
+-- international ones when they start with its code, e.g. run
+--   SET app.phone_country_code = '992';
+-- before the migration. Phones which can't be converted or would take phone of
+-- another account are kept and reported by warnings, they are fixed by hand.
+CREATE FUNCTION pg_temp.e164(raw TEXT) RETURNS TEXT AS $$
+DECLARE
+    country TEXT := NULLIF(ltrim(trim(COALESCE(current_setting('app.phone_country_code', true), '')), '+'), '');
+    number  TEXT := regexp_replace(trim(raw), '[ ().-]', '', 'g');
+BEGIN
+    IF number LIKE '+%' THEN
+        NULL;
+    ELSIF number LIKE '00%' THEN
+        number := '+' || substr(number, 3);
+    ELSIF country IS NOT NULL AND number LIKE country || '%' THEN
+        number := '+' || number;
+    ELSIF country IS NOT NULL THEN
+        -- national trunk prefix is dropped, e.g. 0901234567
+        number := '+' || country || ltrim(number, '0');
+    END IF;
+    IF number ~ '^\+[1-9][0-9]{6,14}$' THEN
+        RETURN number;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+WITH normalized AS (SELECT id, phone, pg_temp.e164(phone) AS e164 FROM customers)
+UPDATE customers c SET phone = n.e164
+    FROM normalized n
+    WHERE n.id = c.id AND n.e164 IS NOT NULL AND n.e164 <> n.phone
+        AND NOT EXISTS (SELECT FROM normalized o WHERE o.id <> n.id AND (o.phone = n.e164 OR o.e164 = n.e164));
+
+WITH normalized AS (SELECT id, phone, pg_temp.e164(phone) AS e164 FROM managers)
+UPDATE managers m SET phone = n.e164
+    FROM normalized n
+    WHERE n.id = m.id AND n.e164 IS NOT NULL AND n.e164 <> n.phone
+        AND NOT EXISTS (SELECT FROM normalized o WHERE o.id <> n.id AND (o.phone = n.e164 OR o.e164 = n.e164));
+
+DO $$
+DECLARE
+    item RECORD;
+BEGIN
+    FOR item IN
+        SELECT 'customer' AS realm, id, phone FROM customers WHERE phone !~ '^\+[1-9][0-9]{6,14}$'
+        UNION ALL
+        SELECT 'manager', id, phone FROM managers WHERE phone !~ '^\+[1-9][0-9]{6,14}$'
+        ORDER BY 1, 2
+    LOOP
+        RAISE WARNING '% % keeps phone %: it is invalid or another account has it in E.164 format',
+            item.realm, item.id, item.phone;
+    END LOOP;
+END;
+$$;
+INSERT INTO schema_migrations (version) VALUES (17);
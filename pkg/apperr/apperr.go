@@ -0,0 +1,179 @@
+package apperr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/logger"
+)
+
+// Kind classifies domain errors and decides which HTTP status they map to
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindUnprocessable
+	KindTooLarge
+	KindTooManyRequests
+)
+
+// Error is a domain error shared by customers, managers and security services
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Details []Detail
+	Err     error
+	// RetryAfter is sent as Retry-After header when positive
+	RetryAfter time.Duration
+	origin     *Error
+}
+
+// Detail describes a problem with a single field of the request
+type Detail struct {
+	Field   string `json:"field,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// Response is a JSON envelope returned to the client on every error
+type Response struct {
+	Code      string   `json:"code"`
+	Message   string   `json:"message"`
+	Details   []Detail `json:"details,omitempty"`
+	RequestID string   `json:"request_id,omitempty"`
+}
+
+var ErrBadRequest = New(KindInvalid, "bad_request", "malformed request")
+var ErrUnauthorized = New(KindUnauthorized, "unauthorized", "authentication required")
+var ErrForbidden = New(KindForbidden, "forbidden", "access denied")
+var ErrInternal = New(KindInternal, "internal", "internal error")
+
+// New creates domain error of provided kind
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is lets copies made by Wrap and WithDetails match their sentinel
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e == t || e.origin == t
+}
+
+func (e *Error) copy() *Error {
+	c := *e
+	if e.origin == nil {
+		c.origin = e
+	}
+	return &c
+}
+
+// Wrap returns copy of the error which keeps cause for logging
+func (e *Error) Wrap(cause error) *Error {
+	c := e.copy()
+	c.Err = cause
+	return c
+}
+
+// WithDetails returns copy of the error with field level details
+func (e *Error) WithDetails(details ...Detail) *Error {
+	c := e.copy()
+	c.Details = append(append([]Detail{}, e.Details...), details...)
+	return c
+}
+
+// WithRetryAfter returns copy of the error telling client when to retry
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	c := e.copy()
+	c.RetryAfter = d
+	return c
+}
+
+// Status maps error to HTTP status code, unknown errors are internal
+func Status(err error) int {
+	var e *Error
+	if !errors.As(err, &e) {
+		return http.StatusInternalServerError
+	}
+	switch e.Kind {
+	case KindInvalid:
+		return http.StatusBadRequest
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindUnprocessable:
+		return http.StatusUnprocessableEntity
+	case KindTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case KindTooManyRequests:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// Envelope builds response body for the error, internal details are never exposed
+func Envelope(err error, requestID string) *Response {
+	var e *Error
+	if !errors.As(err, &e) || e.Kind == KindInternal {
+		return &Response{Code: ErrInternal.Code, Message: ErrInternal.Message, RequestID: requestID}
+	}
+	return &Response{Code: e.Code, Message: e.Message, Details: e.Details, RequestID: requestID}
+}
+
+// Write sends error envelope with mapped status, request may be nil
+// when it is not available to the caller
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+	}
+	status := Status(err)
+	if status == http.StatusInternalServerError {
+		logger.FromContext(ctx).Error("internal error", logger.Err(err))
+	}
+	var e *Error
+	if errors.As(err, &e) && e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(e.RetryAfter.Seconds())), 10))
+	}
+	data, err := json.Marshal(Envelope(err, logger.RequestID(ctx)))
+	if err != nil {
+		logger.FromContext(ctx).Error("marshal error envelope", logger.Err(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	if err != nil {
+		logger.FromContext(ctx).Warn("write error envelope", logger.Err(err))
+	}
+}
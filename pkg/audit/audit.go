@@ -0,0 +1,243 @@
+// Package audit keeps append-only log of writes made by customers and managers.
+// Services record entries in the transaction of the write, so an entry exists
+// exactly when the write is committed. Logins and one-time codes are not
+// audited, they are covered by metrics and logs.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4"
+)
+
+// Realms of actors
+const (
+	RealmCustomer = "customer"
+	RealmManager  = "manager"
+)
+
+// Actor is account which made the request
+type Actor struct {
+	Realm string
+	ID    int64
+}
+
+type contextKey struct {
+	name string
+}
+
+var actorContextKey = &contextKey{"audit actor"}
+var ipContextKey = &contextKey{"audit ip"}
+
+// WithActor returns context of requests made by the actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// ActorFromContext returns actor of the request, false for anonymous requests
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorContextKey).(Actor)
+	return actor, ok && actor.ID != 0
+}
+
+// WithIP returns context of requests from the client address
+func WithIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ipContextKey, ip)
+}
+
+// IP returns client address of the request
+func IP(ctx context.Context) string {
+	ip, _ := ctx.Value(ipContextKey).(string)
+	return ip
+}
+
+// Querier is pool or transaction, entries are written by the transaction of the write
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Change of a field, nil is missing field
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Entry of the log, Before is nil for created targets and After is nil for removed ones
+type Entry struct {
+	ID         int64                  `json:"id"`
+	ActorRealm string                 `json:"actor_realm,omitempty"`
+	ActorID    int64                  `json:"actor_id,omitempty"`
+	Action     string                 `json:"action"`
+	Target     string                 `json:"target"`
+	TargetID   int64                  `json:"target_id,omitempty"`
+	Before     map[string]interface{} `json:"before,omitempty"`
+	After      map[string]interface{} `json:"after,omitempty"`
+	Changes    map[string]Change      `json:"changes,omitempty"`
+	IP         string                 `json:"ip,omitempty"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	Created    time.Time              `json:"created"`
+}
+
+// Record appends entry of the action on the target, before and after are
+// values of the target marshalled to JSON, sensitive fields are dropped
+func Record(ctx context.Context, q Querier, action string, target string, targetID int64, before interface{}, after interface{}) error {
+	ctx, span := tracing.Start(ctx, "audit.Record")
+	defer span.End()
+
+	entry, err := newEntry(ctx, Item{Action: action, Target: target, TargetID: targetID, Before: before, After: after})
+	if err != nil {
+		return err
+	}
+	err = q.QueryRow(ctx, `
+		INSERT INTO audit_log(actor_realm, actor_id, action, target, target_id, before_data, after_data, changes, ip, request_id)
+			VALUES($1, $2, $3, $4, $5, $6::jsonb, $7::jsonb, $8::jsonb, $9, $10) RETURNING id`,
+		entryValues(entry)...).Scan(&entry.ID)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// Item is an entry written by RecordAll
+type Item struct {
+	Action   string
+	Target   string
+	TargetID int64
+	Before   interface{}
+	After    interface{}
+}
+
+// Copier is transaction of bulk changes
+type Copier interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// RecordAll appends entries of bulk changes with one COPY
+func RecordAll(ctx context.Context, c Copier, items []Item) error {
+	ctx, span := tracing.Start(ctx, "audit.RecordAll")
+	defer span.End()
+
+	rows := make([][]interface{}, 0, len(items))
+	for _, item := range items {
+		entry, err := newEntry(ctx, item)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, entryValues(entry))
+	}
+	_, err := c.CopyFrom(ctx, pgx.Identifier{"audit_log"},
+		[]string{"actor_realm", "actor_id", "action", "target", "target_id", "before_data", "after_data", "changes", "ip", "request_id"},
+		pgx.CopyFromRows(rows))
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// newEntry returns entry of the item made by actor of the request
+func newEntry(ctx context.Context, item Item) (*Entry, error) {
+	entry := &Entry{
+		Action:    item.Action,
+		Target:    item.Target,
+		TargetID:  item.TargetID,
+		IP:        IP(ctx),
+		RequestID: logger.RequestID(ctx),
+	}
+	if actor, ok := ActorFromContext(ctx); ok {
+		entry.ActorRealm = actor.Realm
+		entry.ActorID = actor.ID
+	}
+	var err error
+	entry.Before, err = toMap(item.Before)
+	if err != nil {
+		return nil, err
+	}
+	entry.After, err = toMap(item.After)
+	if err != nil {
+		return nil, err
+	}
+	entry.Changes = Diff(entry.Before, entry.After)
+	return entry, nil
+}
+
+// entryValues returns columns of audit_log in order of the insert
+func entryValues(entry *Entry) []interface{} {
+	return []interface{}{
+		nullString(entry.ActorRealm), nullInt(entry.ActorID), entry.Action, entry.Target, nullInt(entry.TargetID),
+		nullJSON(entry.Before), nullJSON(entry.After), nullJSON(entry.Changes),
+		nullString(entry.IP), nullString(entry.RequestID),
+	}
+}
+
+// Diff returns changed fields of two values, fields of created and
+// removed targets are changes from and to nil
+func Diff(before map[string]interface{}, after map[string]interface{}) map[string]Change {
+	changes := map[string]Change{}
+	for key, value := range before {
+		if next, ok := after[key]; !ok || !reflect.DeepEqual(value, next) {
+			changes[key] = Change{Before: value, After: after[key]}
+		}
+	}
+	for key, value := range after {
+		if _, ok := before[key]; !ok {
+			changes[key] = Change{After: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// toMap converts value to JSON object, nil stays nil
+func toMap(v interface{}) (map[string]interface{}, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for key := range fields {
+		if logger.IsSensitive(key) {
+			delete(fields, key)
+		}
+	}
+	return fields, nil
+}
+
+func nullJSON(v interface{}) interface{} {
+	if reflect.ValueOf(v).Len() == 0 {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullInt(i int64) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// DefaultLimit is number of entries returned when filter has no limit
+	DefaultLimit = 100
+	// MaxLimit caps number of entries returned at once
+	MaxLimit = 500
+)
+
+// Filter of entries, zero fields match everything, entries are returned
+// newest first and BeforeID continues from the last entry of previous page
+type Filter struct {
+	ActorRealm string
+	ActorID    int64
+	Action     string
+	Target     string
+	TargetID   int64
+	From       time.Time
+	To         time.Time
+	BeforeID   int64
+	Limit      int
+}
+
+// ParseFilter reads filter from query of the request
+func ParseFilter(query url.Values) (*Filter, error) {
+	filter := &Filter{
+		ActorRealm: query.Get("actor_realm"),
+		Action:     query.Get("action"),
+		Target:     query.Get("target"),
+		Limit:      DefaultLimit,
+	}
+	details := make([]apperr.Detail, 0)
+	parseInt := func(name string, dst *int64) {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 1 {
+				details = append(details, apperr.Detail{Field: name, Rule: "min", Message: "must be positive integer"})
+				return
+			}
+			*dst = n
+		}
+	}
+	parseTime := func(name string, dst *time.Time) {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				details = append(details, apperr.Detail{Field: name, Rule: "datetime", Message: "must be RFC 3339 time"})
+				return
+			}
+			*dst = t
+		}
+	}
+	parseInt("actor_id", &filter.ActorID)
+	parseInt("target_id", &filter.TargetID)
+	parseInt("before_id", &filter.BeforeID)
+	parseTime("from", &filter.From)
+	parseTime("to", &filter.To)
+
+	var limit int64
+	parseInt("limit", &limit)
+	if limit > MaxLimit {
+		details = append(details, apperr.Detail{Field: "limit", Rule: "max", Message: "must be at most " + strconv.Itoa(MaxLimit)})
+	}
+	if limit > 0 {
+		filter.Limit = int(limit)
+	}
+
+	if len(details) != 0 {
+		return nil, apperr.ErrBadRequest.WithDetails(details...)
+	}
+	return filter, nil
+}
+
+// Find returns entries matching the filter
+func Find(ctx context.Context, pool *pgxpool.Pool, filter *Filter) ([]*Entry, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT id, COALESCE(actor_realm, ''), COALESCE(actor_id, 0), action, target, COALESCE(target_id, 0),
+				before_data, after_data, changes, COALESCE(ip, ''), COALESCE(request_id, ''), created
+			FROM audit_log
+			WHERE ($1::text = '' OR actor_realm = $1)
+				AND ($2::bigint = 0 OR actor_id = $2)
+				AND ($3::text = '' OR action = $3)
+				AND ($4::text = '' OR target = $4)
+				AND ($5::bigint = 0 OR target_id = $5)
+				AND ($6::timestamp IS NULL OR created >= $6)
+				AND ($7::timestamp IS NULL OR created < $7)
+				AND ($8::bigint = 0 OR id < $8)
+			ORDER BY id DESC LIMIT $9`,
+		filter.ActorRealm, filter.ActorID, filter.Action, filter.Target, filter.TargetID,
+		nullTime(filter.From), nullTime(filter.To), filter.BeforeID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Entry, 0)
+	for rows.Next() {
+		item := &Entry{}
+		var before, after, changes []byte
+		err = rows.Scan(&item.ID, &item.ActorRealm, &item.ActorID, &item.Action, &item.Target, &item.TargetID,
+			&before, &after, &changes, &item.IP, &item.RequestID, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		err = unmarshalNull(before, &item.Before)
+		if err == nil {
+			err = unmarshalNull(after, &item.After)
+		}
+		if err == nil {
+			err = unmarshalNull(changes, &item.Changes)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func unmarshalNull(data []byte, dst interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// nullTime keeps timestamps in UTC like CURRENT_TIMESTAMP of the database
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
@@ -0,0 +1,51 @@
+// Package barcode brings EAN and UPC codes read by scanners or typed by
+// people to one canonical form, so the same product is never stored twice.
+package barcode
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/darkside1809/gosql/pkg/validate"
+)
+
+var ErrInvalid = errors.New("barcode: not a valid EAN or UPC code")
+
+// Normalize removes spaces and dashes, e.g. "4 006381 333931", and returns
+// GTIN-13 for UPC-A and GTIN-14 codes padded with zeros, EAN-8 is kept as is.
+// Check digit must be valid.
+func Normalize(raw string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(raw) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-':
+		default:
+			return "", ErrInvalid
+		}
+	}
+
+	code := b.String()
+	switch {
+	case len(code) == 12:
+		// UPC-A is EAN-13 with leading zero
+		code = "0" + code
+	case len(code) == 14 && code[0] == '0':
+		code = code[1:]
+	}
+	if !validate.CheckDigit(code) {
+		return "", ErrInvalid
+	}
+	return code, nil
+}
+
+// Clean returns normalized code or raw value when it can't be normalized,
+// so validation reports the value client sent
+func Clean(raw string) string {
+	code, err := Normalize(raw)
+	if err != nil {
+		return raw
+	}
+	return code
+}
@@ -0,0 +1,42 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Commit and BuildTime are set at link time:
+// go build -ldflags "-X github.com/darkside1809/gosql/pkg/buildinfo.Commit=$(git rev-parse HEAD)
+// -X github.com/darkside1809/gosql/pkg/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Commit    string
+	BuildTime string
+)
+
+// Info describes running binary
+type Info struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module,omitempty"`
+}
+
+// Get returns build information, commit and build time missing in ldflags
+// are unknown
+func Get() Info {
+	info := Info{Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.Module = build.Main.Path
+	}
+	return fallback(info)
+}
+
+func fallback(info Info) Info {
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
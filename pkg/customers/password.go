@@ -0,0 +1,150 @@
+package customers
+
+import (
+	"context"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/notify"
+	"github.com/darkside1809/gosql/pkg/password"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// resetCodeTTL is lifetime of password reset code
+const resetCodeTTL = 15 * time.Minute
+
+// ChangePassword sets new password of the customer after checking current one
+func (s *Service) ChangePassword(ctx context.Context, id int64, current string, next string) (err error) {
+	ctx, span := tracing.Start(ctx, "customers.ChangePassword")
+	defer tracing.End(span, &err)
+
+	var hash, name, phone string
+	err = s.pool.QueryRow(ctx, `SELECT password, name, phone FROM customers WHERE id = $1`, id).Scan(&hash, &name, &phone)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(current))
+	if err != nil {
+		return ErrInvalidPassword
+	}
+	err = s.policy.Check(next, name, phone)
+	if err != nil {
+		return err
+	}
+	return s.setPassword(ctx, id, next, "customer.password_change")
+}
+
+// RequestPasswordReset sends one-time code to the phone, unknown phones are
+// ignored, so the response does not tell which phones are registered
+func (s *Service) RequestPasswordReset(ctx context.Context, phone string) (err error) {
+	ctx, span := tracing.Start(ctx, "customers.RequestPasswordReset")
+	defer tracing.End(span, &err)
+
+	var id int64
+	err = s.pool.QueryRow(ctx, `SELECT id FROM customers WHERE phone = $1`, phone).Scan(&id)
+	if err == pgx.ErrNoRows {
+		logger.FromContext(ctx).Info("password reset of unknown phone")
+		return nil
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+
+	code, err := password.NewCode(6)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = s.codes.Issue(ctx, password.RealmCustomer, password.PurposeReset, id, code, resetCodeTTL)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = s.notifier.Notify(ctx, &notify.Message{
+		To:      phone,
+		Subject: "Password reset",
+		Body:    "Your password reset code is " + code + ", it expires in 15 minutes.",
+	})
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
+
+// ResetPassword sets new password using code sent by RequestPasswordReset,
+// all tokens of the customer are revoked
+func (s *Service) ResetPassword(ctx context.Context, phone string, code string, next string) (err error) {
+	ctx, span := tracing.Start(ctx, "customers.ResetPassword")
+	defer tracing.End(span, &err)
+
+	var id int64
+	var name string
+	err = s.pool.QueryRow(ctx, `SELECT id, name FROM customers WHERE phone = $1`, phone).Scan(&id, &name)
+	if err == pgx.ErrNoRows {
+		return password.ErrInvalidCode
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+
+	err = s.policy.Check(next, name, phone)
+	if err != nil {
+		return err
+	}
+	err = s.codes.Consume(ctx, password.RealmCustomer, password.PurposeReset, id, code)
+	if err == password.ErrInvalidCode {
+		return err
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+
+	err = s.setPassword(ctx, id, next, "customer.password_reset")
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, `DELETE FROM customers_tokens WHERE customer_id = $1`, id)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
+
+// setPassword stores hash of the password, clears lock of the account and
+// records the action in audit log
+func (s *Service) setPassword(ctx context.Context, id int64, next string, action string) error {
+	hash, err := password.Hash(next)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE customers SET password = $2, failed_logins = 0, locked_until = NULL
+			WHERE id = $1`, id, hash)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	// password reset and invitation come from anonymous requests of the account itself
+	if _, ok := audit.ActorFromContext(ctx); !ok {
+		ctx = audit.WithActor(ctx, audit.Actor{Realm: audit.RealmCustomer, ID: id})
+	}
+	err = audit.Record(ctx, tx, action, "customer", id, nil, nil)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
@@ -3,49 +3,69 @@ package customers
 import (
 	"context"
 	"errors"
-	"log"
 	"time"
 	"crypto/rand"
 	"encoding/hex"
 
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/darkside1809/gosql/pkg/metrics"
+	"github.com/darkside1809/gosql/pkg/money"
+	"github.com/darkside1809/gosql/pkg/notify"
+	"github.com/darkside1809/gosql/pkg/outbox"
+	"github.com/darkside1809/gosql/pkg/password"
+	"github.com/darkside1809/gosql/pkg/ratelimit"
+	"github.com/darkside1809/gosql/pkg/sms"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var ErrNotFound = errors.New("item not found")
-var ErrInternal = errors.New("internal error")
-var ErrPhoneUsed = errors.New("phone already registered")
-var ErrTokenNotFound = errors.New("token not found")
-var ErrTokenExpired = errors.New("token expired")
-var ErrNoSuchUser = errors.New("no such user")
-var ErrInvalidPassword = errors.New("invalid password")
-var ErrNoRows = errors.New("no rows")
+var ErrNotFound = apperr.New(apperr.KindNotFound, "not_found", "item not found")
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+var ErrPhoneUsed = apperr.New(apperr.KindConflict, "phone_used", "phone already registered")
+var ErrTokenNotFound = apperr.New(apperr.KindUnauthorized, "token_not_found", "token not found")
+var ErrTokenExpired = apperr.New(apperr.KindUnauthorized, "token_expired", "token expired")
+var ErrNoSuchUser = apperr.New(apperr.KindUnauthorized, "invalid_credentials", "invalid login or password")
+var ErrInvalidPassword = apperr.New(apperr.KindUnauthorized, "invalid_credentials", "invalid login or password")
+var ErrNoRows = apperr.New(apperr.KindNotFound, "no_rows", "no rows")
+var ErrNotVerified = apperr.New(apperr.KindForbidden, "phone_not_verified", "phone is not verified")
+var ErrAccountLocked = apperr.New(apperr.KindTooManyRequests, "account_locked", "account is locked after repeated failed logins")
+
+var loginsTotal = metrics.Default.CounterVec("gosql_logins_total", "Login attempts by realm and result.", "realm", "result")
 
 type Service struct {
-	pool *pgxpool.Pool
+	pool     *pgxpool.Pool
+	policy   *password.Policy
+	notifier notify.Notifier
+	gateway  sms.Gateway
+	codes    *password.Codes
 }
 
-func NewService(pool *pgxpool.Pool) *Service {
-	return &Service{pool: pool}
+func NewService(pool *pgxpool.Pool, policy *password.Policy, notifier notify.Notifier, gateway sms.Gateway) *Service {
+	return &Service{pool: pool, policy: policy, notifier: notifier, gateway: gateway, codes: password.NewCodes(pool)}
 }
 
 type Customer struct {
-	ID      int64     `json:"id"`
-	Name    string    `json:"name"`
-	Phone   string    `json:"phone"`
+	ID      int64     `json:"id" validate:"min=0"`
+	Name    string    `json:"name" validate:"required,max=100"`
+	Phone   string    `json:"phone" validate:"required,phone"`
 	Active  bool      `json:"active"`
+	// Verified is set when customer confirmed phone with code sent by SMS
+	Verified bool      `json:"verified"`
 	Created time.Time `json:"created"`
 }
 
 type Registration struct {
-	Name     string `json:"name"`
-	Phone    string `json:"phone"`
-	Password string `json:"password"`
+	Name     string `json:"name" validate:"required,max=100"`
+	Phone    string `json:"phone" validate:"required,phone"`
+	Password string `json:"password" validate:"required,max=72"`
 }
 type Auth struct {
-	Login 	string `json:"login"`
-	Password string `json:"password"`
+	Login 	string `json:"login" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 type Token struct {
 	Token string `json:"token"`
@@ -53,38 +73,44 @@ type Token struct {
 type Products struct {
 	ID 	int64  `json:"id"`
 	Name 	string `json:"name"`
-	Price int 	 `json:"price"`
+	Price money.Money `json:"price"`
 	Qty 	int 	 `json:"qty"`
 }
 
 type Purchase struct {
 	ID 			int64 `json:"id"`
+	Number		int64 `json:"number"`
 	CustomerID	int	`json:"customer_id"`
 	ManagerID	int	`json:"manager_id"`
+	Created		time.Time `json:"created"`
 }
 // Get customers By Id
 func (s *Service) ByID(ctx context.Context, id int64) (*Customer, error) {
+	ctx, span := tracing.Start(ctx, "customers.ByID")
+	defer span.End()
 	item := &Customer{}
 
 	err := s.pool.QueryRow(ctx, `
-		SELECT id, name, phone, active, created 
+		SELECT id, name, phone, active, verified, created 
 			FROM customers WHERE id = $1
-	`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+	`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
 	}
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("customers.ByID", logger.Err(err))
 		return nil, ErrInternal
 	}
 	return item, nil
 }
 // Get All customers
 func (s *Service) All(ctx context.Context) ([]*Customer, error) {
+	ctx, span := tracing.Start(ctx, "customers.All")
+	defer span.End()
 	customers := []*Customer{}
 	
-	rows, err := s.pool.Query(ctx, `SELECT * FROM customers`)
+	rows, err := s.pool.Query(ctx, `SELECT id, name, phone, active, verified, created FROM customers`)
 	defer rows.Close()
 
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -98,9 +124,9 @@ func (s *Service) All(ctx context.Context) ([]*Customer, error) {
 
 	for rows.Next() {
 		item := &Customer{}
-		err := rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+		err := rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
 		if err != nil {
-			log.Print(err)
+			logger.FromContext(ctx).Error("customers.All", logger.Err(err))
 		}
 		customers = append(customers, item)
 	}
@@ -108,9 +134,11 @@ func (s *Service) All(ctx context.Context) ([]*Customer, error) {
 }
 // Get All active customers
 func (s *Service) AllActive(ctx context.Context) ([]*Customer, error) {
+	ctx, span := tracing.Start(ctx, "customers.AllActive")
+	defer span.End()
 	customers := []*Customer{}
 
-	rows, err := s.pool.Query(ctx, `SELECT * FROM customers WHERE active = true`)
+	rows, err := s.pool.Query(ctx, `SELECT id, name, phone, active, verified, created FROM customers WHERE active = true`)
 	defer rows.Close()
 
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -122,9 +150,9 @@ func (s *Service) AllActive(ctx context.Context) ([]*Customer, error) {
 
 	for rows.Next() {
 		item := &Customer{}
-		err := rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+		err := rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
 		if err != nil {
-			log.Print(err)
+			logger.FromContext(ctx).Error("customers.AllActive", logger.Err(err))
 		}
 		customers = append(customers, item)
 	}
@@ -132,92 +160,206 @@ func (s *Service) AllActive(ctx context.Context) ([]*Customer, error) {
 }
 // Save customers By id
 func (s *Service) Save(ctx context.Context, customer *Customer) (*Customer, error) {
+	ctx, span := tracing.Start(ctx, "customers.Save")
+	defer span.End()
 	item := &Customer{}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("customers.Save", logger.Err(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
 	
 	if customer.ID == 0 {
-		err := s.pool.QueryRow(ctx, `
-		INSERT INTO customers(name, phone) VALUES($1, $2) RETURNING id, name, phone, active, created
-		`, customer.Name, customer.Phone).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+		// empty password never matches bcrypt hash, customer sets it by password reset
+		err := tx.QueryRow(ctx, `
+		INSERT INTO customers(name, phone, password) VALUES($1, $2, '') RETURNING id, name, phone, active, verified, created
+		`, customer.Name, customer.Phone).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
 		if errors.Is(err, pgx.ErrNoRows) {
-			log.Print("No rows")
+			logger.FromContext(ctx).Debug("customers.Save: no rows")
 			return nil, ErrNotFound
 		}
 		if err != nil {
-			log.Print(err)
+			logger.FromContext(ctx).Error("customers.Save", logger.Err(err))
+			return nil, ErrInternal
+		}
+		err = audit.Record(ctx, tx, "customer.create", "customer", item.ID, nil, item)
+		if err != nil {
+			logger.FromContext(ctx).Error("customers.Save", logger.Err(err))
 			return nil, ErrInternal
 		}
 	}
 	
 	if customer.ID != 0 {
-		err := s.pool.QueryRow(ctx, `
-		UPDATE customers SET name = $2, phone = $3 WHERE id = $1 RETURNING id, name, phone, active, created
-		`, customer.ID, customer.Name, customer.Phone).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+		before, err := lockCustomer(ctx, tx, customer.ID)
+		if err != nil {
+			return nil, err
+		}
+		err = tx.QueryRow(ctx, `
+		UPDATE customers SET name = $2, phone = $3, verified = verified AND phone = $3 WHERE id = $1 RETURNING id, name, phone, active, verified, created
+		`, customer.ID, customer.Name, customer.Phone).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
 		
-		if errors.Is(err, pgx.ErrNoRows) {
-			log.Print("No rows")
-			return nil, ErrNotFound
+		if err != nil {
+			logger.FromContext(ctx).Error("customers.Save", logger.Err(err))
+			return nil, ErrInternal
 		}
+		err = audit.Record(ctx, tx, "customer.update", "customer", item.ID, before, item)
 		if err != nil {
-			log.Print(err)
+			logger.FromContext(ctx).Error("customers.Save", logger.Err(err))
 			return nil, ErrInternal
 		}
 	}
 
+	err = tx.Commit(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("customers.Save", logger.Err(err))
+		return nil, ErrInternal
+	}
 	return item, nil	
 }
 // Delete customer by id
 func (s *Service) RemoveByID(ctx context.Context, id int64) (*Customer, error) {
+	ctx, span := tracing.Start(ctx, "customers.RemoveByID")
+	defer span.End()
 	item := &Customer{}
 
-	err := s.pool.QueryRow(ctx, 
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("customers.RemoveByID", logger.Err(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, 
 		`DELETE FROM customers
-			WHERE id = $1 RETURNING *`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+			WHERE id = $1 RETURNING id, name, phone, active, verified, created`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
 	if err == pgx.ErrNoRows {
 		return nil, ErrNotFound
 	}
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("customers.RemoveByID", logger.Err(err))
+		return nil, ErrInternal
+	}
+	err = audit.Record(ctx, tx, "customer.delete", "customer", item.ID, item, nil)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("customers.RemoveByID", logger.Err(err))
 		return nil, ErrInternal
 	}
 	return item, nil
 }
 // Block and Unblock customer By his id
 func (s *Service) BlockAndUnblockByID(ctx context.Context, id int64, active bool) (*Customer, error) {
+	ctx, span := tracing.Start(ctx, "customers.BlockAndUnblockByID")
+	defer span.End()
 	item := &Customer{}
 
-	err := s.pool.QueryRow(ctx, 
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("customers.BlockAndUnblockByID", logger.Err(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockCustomer(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(ctx, 
 		`UPDATE customers SET active = $1 
-			WHERE id = $2 RETURNING *`, active, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+			WHERE id = $2 RETURNING id, name, phone, active, verified, created`, active, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
 
+	if err != nil {
+		logger.FromContext(ctx).Error("customers.BlockAndUnblockByID", logger.Err(err))
+		return nil, ErrInternal
+	}
+	action, event := "customer.block", outbox.EventCustomerBlocked
+	if active {
+		action, event = "customer.unblock", outbox.EventCustomerUnblocked
+	}
+	err = audit.Record(ctx, tx, action, "customer", id, before, item)
+	if err == nil {
+		err = outbox.Publish(ctx, tx, event, "customer", id, item)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("customers.BlockAndUnblockByID", logger.Err(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+// lockCustomer returns customer locked until end of the transaction, it is
+// state before the write for audit
+func lockCustomer(ctx context.Context, tx pgx.Tx, id int64) (*Customer, error) {
+	item := &Customer{}
+	err := tx.QueryRow(ctx, `
+		SELECT id, name, phone, active, verified, created
+			FROM customers WHERE id = $1 FOR UPDATE`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
 	if err == pgx.ErrNoRows {
 		return nil, ErrNotFound
 	}
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, ErrInternal.Wrap(err)
 	}
 	return item, nil
 }
 // Register user and add him to a database
 func (s *Service) Register(ctx context.Context, registration *Registration) (item *Customer, err error) {
+	ctx, span := tracing.Start(ctx, "customers.Register")
+	defer tracing.End(span, &err)
+	err = s.policy.Check(registration.Password, registration.Phone, registration.Name)
+	if err != nil {
+		return nil, err
+	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(registration.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, ErrInternal
+		return nil, ErrInternal.Wrap(err)
 	}
+	item = &Customer{}
 
-	err = s.pool.QueryRow(ctx, `
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
 		INSERT INTO customers(name, phone, password)
 			VALUES($1, $2, $3)
-			ON CONFLICT (phone) DO NOTHING RETURNING id, name, phone, active, created
+			ON CONFLICT (phone) DO NOTHING RETURNING id, name, phone, active, verified, created
 			`, registration.Name, registration.Phone, hash ).Scan(
-				&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created,
+				&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created,
 			)
 	if err == pgx.ErrNoRows {
-		return nil, ErrNotFound
+		return nil, ErrPhoneUsed
 	}
 
 	if err != nil {
-		return nil, ErrInternal
+		return nil, ErrInternal.Wrap(err)
+	}
+	// registration is made by the new customer
+	err = audit.Record(audit.WithActor(ctx, audit.Actor{Realm: audit.RealmCustomer, ID: item.ID}), tx, "customer.register", "customer", item.ID, nil, item)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = outbox.Publish(ctx, tx, outbox.EventCustomerRegistered, "customer", item.ID, item)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	// account exists already, customer asks to resend the code when sending fails
+	sendErr := s.sendVerification(ctx, item.ID, item.Phone)
+	if sendErr != nil {
+		logger.FromContext(ctx).Error("customers.Register: send verification", logger.Err(sendErr))
 	}
 	return item, nil
 }
@@ -226,22 +368,46 @@ func (s *Service) Register(ctx context.Context, registration *Registration) (ite
 // if password is not found, return ErrInvalidPassword,
 // if something else goes wrong, return ErrInternal.
 func (s *Service) Token(ctx context.Context, phone string, password string) (token string, err error) {
+	ctx, span := tracing.Start(ctx, "customers.Token")
+	defer tracing.End(span, &err)
 	var hash string
 	var id int64
+	var locked float64
+	var verified bool
 	err = s.pool.QueryRow(ctx, `
-		SELECT id, password FROM customers
-			WHERE phone = $1`, phone).Scan(&id, &hash)
+		SELECT id, password, verified, COALESCE(EXTRACT(EPOCH FROM locked_until - CURRENT_TIMESTAMP), 0)
+			FROM customers WHERE phone = $1`, phone).Scan(&id, &hash, &verified, &locked)
 	if err == pgx.ErrNoRows {
-		return "", ErrNotFound
+		loginsTotal.With("customer", "failure").Inc()
+		return "", ErrNoSuchUser
 	}
 
 	if err != nil {
-		return "", ErrInternal
+		loginsTotal.With("customer", "error").Inc()
+		return "", ErrInternal.Wrap(err)
+	}
+	if locked > 0 {
+		loginsTotal.With("customer", "locked").Inc()
+		return "", ErrAccountLocked.WithRetryAfter(time.Duration(locked * float64(time.Second)))
 	}
 
+	_, compareSpan := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	compareSpan.End()
+	if err != nil {
+		loginsTotal.With("customer", "failure").Inc()
+		return "", s.loginFailed(ctx, id)
+	}
+	// checked after password, so only the owner learns the phone is not verified
+	if !verified {
+		loginsTotal.With("customer", "unverified").Inc()
+		return "", ErrNotVerified
+	}
+
+	_, err = s.pool.Exec(ctx, `UPDATE customers SET failed_logins = 0, locked_until = NULL WHERE id = $1`, id)
 	if err != nil {
-		return "", ErrInvalidPassword
+		loginsTotal.With("customer", "error").Inc()
+		return "", ErrInternal.Wrap(err)
 	}
 	
 	buffer := make([]byte, 256)
@@ -253,18 +419,81 @@ func (s *Service) Token(ctx context.Context, phone string, password string) (tok
 	token = hex.EncodeToString(buffer)
 	_, err = s.pool.Exec(ctx, `
 		INSERT INTO customers_tokens(token, customer_id)
-			VALUES($1, &2)`, token, id)
+			VALUES($1, $2)`, token, id)
 	if err != nil {
-		return "", ErrInternal
+		loginsTotal.With("customer", "error").Inc()
+		return "", ErrInternal.Wrap(err)
 	}
+	loginsTotal.With("customer", "success").Inc()
 	return token, nil
 }
+// loginFailed records failed login of the customer and locks account
+// according to ratelimit.DefaultLockout, it returns error for the caller
+func (s *Service) loginFailed(ctx context.Context, id int64) error {
+	var failures int
+	err := s.pool.QueryRow(ctx, `
+		UPDATE customers SET failed_logins = failed_logins + 1
+			WHERE id = $1 RETURNING failed_logins`, id).Scan(&failures)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	lock := ratelimit.DefaultLockout.Duration(failures)
+	if lock == 0 {
+		return ErrInvalidPassword
+	}
+	_, err = s.pool.Exec(ctx, `
+		UPDATE customers SET locked_until = CURRENT_TIMESTAMP + make_interval(secs => $2)
+			WHERE id = $1`, id, lock.Seconds())
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	logger.FromContext(ctx).Warn("customer account locked", logger.F("customer_id", id), logger.F("failures", failures), logger.F("lock", lock))
+	return ErrAccountLocked.WithRetryAfter(lock)
+}
+
+// Unlock clears failed logins and lock of the customer
+func (s *Service) Unlock(ctx context.Context, id int64) (*Customer, error) {
+	ctx, span := tracing.Start(ctx, "customers.Unlock")
+	defer span.End()
+	item := &Customer{}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("customers.Unlock", logger.Err(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		UPDATE customers SET failed_logins = 0, locked_until = NULL
+			WHERE id = $1 RETURNING id, name, phone, active, verified, created`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("customers.Unlock", logger.Err(err))
+		return nil, ErrInternal
+	}
+	err = audit.Record(ctx, tx, "customer.unlock", "customer", id, nil, nil)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("customers.Unlock", logger.Err(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
 // Get products 
 func (s *Service) Products(ctx context.Context) ([]*Products, error) {
+	ctx, span := tracing.Start(ctx, "customers.Products")
+	defer span.End()
 	items := make([]*Products, 0)
+	// qty is stock available to customers, reserved stock is not offered
 	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, price, qty FROM products 
-			WHERE active = true ORDER BY id LIMIT 500`)
+		SELECT p.id, p.name, p.price, p.currency, p.qty - COALESCE(SUM(r.qty), 0)::bigint FROM products p
+			LEFT JOIN reservations r ON r.product_id = p.id AND r.status = 'active' AND r.expires > CURRENT_TIMESTAMP
+			WHERE p.active = true GROUP BY p.id ORDER BY p.id LIMIT 500`)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return items, err 
 	}
@@ -275,16 +504,16 @@ func (s *Service) Products(ctx context.Context) ([]*Products, error) {
 
 	for rows.Next() {
 		item := &Products{}
-		err = rows.Scan(&item.ID, &item.Price, &item.Qty)
+		err = rows.Scan(&item.ID, &item.Name, &item.Price.Amount, &item.Price.Currency, &item.Qty)
 		if err != nil {
-			log.Print(err)
+			logger.FromContext(ctx).Error("customers.Products", logger.Err(err))
 			return nil, err
 		}
 		items = append(items, item)
 	}
 	err = rows.Err()
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("customers.Products", logger.Err(err))
 		return nil, err
 	}
 
@@ -292,6 +521,8 @@ func (s *Service) Products(ctx context.Context) ([]*Products, error) {
 }
 // Find customer's id by his token
 func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "customers.IDByToken")
+	defer span.End()
 	var id int64
 	err := s.pool.QueryRow(ctx, `
 		SELECT customer_id FROM customers_tokens WHERE token = $1`, token).Scan(&id)
@@ -305,25 +536,27 @@ func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
 }
 // Get purchases of customers or managers 
 func (s *Service) Purchases(ctx context.Context, id int64) ([]*Purchase, error) {
+	ctx, span := tracing.Start(ctx, "customers.Purchases")
+	defer span.End()
 	items := make([]*Purchase, 0)
 	rows, err := s.pool.Query(ctx, `
-	 SELECT manager_id, customer_id, FROM sales 
+	 SELECT id, number, manager_id, customer_id, created FROM sales 
 	 	WHERE customer_id = $1 ORDER BY id LIMIT 500`, id)
 	
 	if errors.Is(err, pgx.ErrNoRows) {
 		return items, nil
 	}
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("customers.Purchases", logger.Err(err))
 		return nil, ErrInternal
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		item := &Purchase{}
-		err = rows.Scan(&item.ID, &item.ManagerID, &item.CustomerID)
+		err = rows.Scan(&item.ID, &item.Number, &item.ManagerID, &item.CustomerID, &item.Created)
 		if err != nil {
-			log.Print(err)
+			logger.FromContext(ctx).Error("customers.Purchases", logger.Err(err))
 			return nil, ErrInternal
 		}
 		items = append(items, item)
@@ -331,7 +564,7 @@ func (s *Service) Purchases(ctx context.Context, id int64) ([]*Purchase, error)
 
 	err = rows.Err()
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("customers.Purchases", logger.Err(err))
 		return nil, err
 	}
 	return items, nil
@@ -368,7 +601,7 @@ func (s *Service) Purchases(ctx context.Context, id int64) ([]*Purchase, error)
 // 	defer rows.Close()
 // 	for rows.Next() {
 // 		item := &Purchases{}
-// 		err = rows.Scan(&item.ID, &item.ManagerID, &item.CustomerID)
+// 		err = rows.Scan(&item.ID, &item.Number, &item.ManagerID, &item.CustomerID, &item.Created)
 // 		if err != nil {
 // 			log.Print(err)
 // 			return nil, err
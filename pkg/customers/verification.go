@@ -0,0 +1,134 @@
+package customers
+
+import (
+	"context"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/password"
+	"github.com/darkside1809/gosql/pkg/phone"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4"
+)
+
+// verificationCodeTTL is lifetime of code sent to verify phone
+const verificationCodeTTL = 10 * time.Minute
+
+// Verification confirms phone with code sent by SMS
+type Verification struct {
+	Phone string `json:"phone" validate:"required,phone"`
+	Code  string `json:"code" validate:"required,max=16"`
+}
+
+// VerificationRequest asks to send verification code again
+type VerificationRequest struct {
+	Phone string `json:"phone" validate:"required,phone"`
+}
+
+// Normalize converts phone to E.164 before validation
+func (v *Verification) Normalize() {
+	v.Phone = phone.Clean(v.Phone)
+}
+
+// Normalize converts phone to E.164 before validation
+func (v *VerificationRequest) Normalize() {
+	v.Phone = phone.Clean(v.Phone)
+}
+
+// Normalize converts phone to E.164 before validation
+func (r *Registration) Normalize() {
+	r.Phone = phone.Clean(r.Phone)
+}
+
+// Normalize converts phone to E.164 before validation
+func (c *Customer) Normalize() {
+	c.Phone = phone.Clean(c.Phone)
+}
+
+// sendVerification issues code and sends it by SMS
+func (s *Service) sendVerification(ctx context.Context, id int64, to string) error {
+	code, err := password.NewCode(6)
+	if err != nil {
+		return err
+	}
+	err = s.codes.Issue(ctx, password.RealmCustomer, password.PurposeVerify, id, code, verificationCodeTTL)
+	if err != nil {
+		return err
+	}
+	return s.gateway.Send(ctx, to, "Your verification code is "+code+", it expires in 10 minutes.")
+}
+
+// Verify marks phone of the customer verified when code matches
+func (s *Service) Verify(ctx context.Context, phone string, code string) (item *Customer, err error) {
+	ctx, span := tracing.Start(ctx, "customers.Verify")
+	defer tracing.End(span, &err)
+
+	var id int64
+	err = s.pool.QueryRow(ctx, `SELECT id FROM customers WHERE phone = $1 AND NOT verified`, phone).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, password.ErrInvalidCode
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	err = s.codes.Consume(ctx, password.RealmCustomer, password.PurposeVerify, id, code)
+	if err == password.ErrInvalidCode {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockCustomer(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	item = &Customer{}
+	err = tx.QueryRow(ctx, `
+		UPDATE customers SET verified = TRUE
+			WHERE id = $1 RETURNING id, name, phone, active, verified, created`, id).Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	ctx = audit.WithActor(ctx, audit.Actor{Realm: audit.RealmCustomer, ID: id})
+	err = audit.Record(ctx, tx, "customer.verify", "customer", id, before, item)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return item, nil
+}
+
+// ResendVerification sends new code to unverified phone, other phones are
+// ignored, so the response does not tell which phones are registered
+func (s *Service) ResendVerification(ctx context.Context, phone string) (err error) {
+	ctx, span := tracing.Start(ctx, "customers.ResendVerification")
+	defer tracing.End(span, &err)
+
+	var id int64
+	err = s.pool.QueryRow(ctx, `SELECT id FROM customers WHERE phone = $1 AND NOT verified`, phone).Scan(&id)
+	if err == pgx.ErrNoRows {
+		logger.FromContext(ctx).Info("verification of unknown or verified phone")
+		return nil
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+
+	err = s.sendVerification(ctx, id, phone)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Package exchange keeps exchange rates entered by administrators and turns
+// them into factors which convert amounts of sales into one currency for
+// consolidated reports. Rates are not fetched from anywhere, the table is
+// the only source, so reports can be repeated with the same numbers.
+package exchange
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/money"
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrNoRate = apperr.New(apperr.KindUnprocessable, "exchange_rate_missing", "no exchange rate to the currency")
+
+// numericOutOfRange is SQLSTATE of numbers which do not fit the column type
+const numericOutOfRange = "22003"
+
+// Rate tells that one unit of Currency costs Rate units of Base from the
+// effective time, e.g. USD to TJS at 10.95
+type Rate struct {
+	ID        int64     `json:"id"`
+	Currency  string    `json:"currency" validate:"required,currency"`
+	Base      string    `json:"base" validate:"required,currency"`
+	Rate      float64   `json:"rate"`
+	Effective time.Time `json:"effective" validate:"required"`
+	Created   time.Time `json:"created"`
+}
+
+// Normalize puts currency codes in upper case before validation
+func (r *Rate) Normalize() {
+	r.Currency = money.Code(r.Currency)
+	r.Base = money.Code(r.Base)
+}
+
+// Querier is a pool or a transaction
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// Factors multiply minor units of currencies into minor units of Target.
+// Currencies and Values are passed to queries as text arrays and joined with
+// unnest($1::text[], $2::text[]::numeric[]), amounts of the target have factor 1.
+type Factors struct {
+	Target     string
+	Currencies []string
+	Values     []string
+}
+
+// LoadFactors returns factors to the target currency from the latest rates
+// effective at the time. Rate of the target to a currency is used inverted
+// when it is newer than the direct one.
+func LoadFactors(ctx context.Context, db Querier, target string, at time.Time) (*Factors, error) {
+	rows, err := db.Query(ctx, `
+		SELECT DISTINCT ON (currency) currency, rate::text, inverse FROM (
+				SELECT currency, rate, effective, FALSE AS inverse FROM exchange_rates WHERE base = $1 AND effective <= $2
+				UNION ALL
+				SELECT base, rate, effective, TRUE FROM exchange_rates WHERE currency = $1 AND effective <= $2
+			) r
+			ORDER BY currency, effective DESC, inverse`, target, at.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	factors := &Factors{Target: target, Currencies: []string{target}, Values: []string{"1"}}
+	for rows.Next() {
+		var currency, rate string
+		var inverse bool
+		err = rows.Scan(&currency, &rate, &inverse)
+		if err != nil {
+			return nil, err
+		}
+		factor, ok := new(big.Rat).SetString(rate)
+		if !ok || factor.Sign() <= 0 {
+			return nil, errors.New("exchange: bad rate " + rate + " of " + currency)
+		}
+		if inverse {
+			factor.Inv(factor)
+		}
+		// rate is per unit, factor is per minor unit
+		shift := money.Digits(target) - money.Digits(currency)
+		scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+		if shift < 0 {
+			scale.Inv(scale)
+		}
+		factor.Mul(factor, scale)
+		factors.Currencies = append(factors.Currencies, currency)
+		factors.Values = append(factors.Values, factor.FloatString(16))
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return factors, nil
+}
+
+// Check returns ErrNoRate listing currencies which have no factor
+func (f *Factors) Check(currencies []string) error {
+	known := make(map[string]bool, len(f.Currencies))
+	for _, currency := range f.Currencies {
+		known[currency] = true
+	}
+	missing := make([]string, 0)
+	for _, currency := range currencies {
+		if !known[currency] {
+			missing = append(missing, currency)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	details := make([]apperr.Detail, 0, len(missing))
+	for _, currency := range missing {
+		details = append(details, apperr.Detail{Field: "currency", Rule: "exchange_rate", Message: "no rate of " + currency + " to " + f.Target})
+	}
+	return ErrNoRate.WithDetails(details...)
+}
+
+// IsOverflow reports whether err is out of range error of the server, it
+// happens when sums of amounts do not fit bigint
+func IsOverflow(err error) bool {
+	var state interface{ SQLState() string }
+	return errors.As(err, &state) && state.SQLState() == numericOutOfRange
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,105 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/darkside1809/gosql/pkg/validate"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+var ErrRateExists = apperr.New(apperr.KindConflict, "exchange_rate_exists", "currency has rate to the base effective at the time")
+
+// MaxRates caps number of rates returned at once
+const MaxRates = 500
+
+// Service manages exchange rates
+type Service struct {
+	pool *pgxpool.Pool
+}
+
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool}
+}
+
+// Rates returns latest rates first
+func (s *Service) Rates(ctx context.Context) (items []*Rate, err error) {
+	ctx, span := tracing.Start(ctx, "exchange.Rates")
+	defer tracing.End(span, &err)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, currency, base, rate, effective, created FROM exchange_rates
+			ORDER BY effective DESC, id DESC LIMIT $1`, MaxRates)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer rows.Close()
+
+	items = make([]*Rate, 0)
+	for rows.Next() {
+		item := &Rate{}
+		err = rows.Scan(&item.ID, &item.Currency, &item.Base, &item.Rate, &item.Effective, &item.Created)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return items, nil
+}
+
+// AddRate adds rate of the currency to the base, it converts amounts of
+// reports which end after its effective time
+func (s *Service) AddRate(ctx context.Context, item *Rate) (saved *Rate, err error) {
+	ctx, span := tracing.Start(ctx, "exchange.AddRate")
+	defer tracing.End(span, &err)
+
+	details := make([]apperr.Detail, 0)
+	if item.Rate <= 0 {
+		details = append(details, apperr.Detail{Field: "rate", Rule: "min", Message: "must be positive"})
+	}
+	if item.Currency == item.Base {
+		details = append(details, apperr.Detail{Field: "base", Rule: "ne", Message: "must differ from currency"})
+	}
+	if len(details) != 0 {
+		return nil, validate.ErrFailed.WithDetails(details...)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	saved = &Rate{}
+	// stored times are UTC
+	err = tx.QueryRow(ctx, `
+		INSERT INTO exchange_rates(currency, base, rate, effective) VALUES($1, $2, $3, $4)
+			ON CONFLICT (currency, base, effective) DO NOTHING
+			RETURNING id, currency, base, rate, effective, created`, item.Currency, item.Base, item.Rate, item.Effective.UTC()).Scan(
+		&saved.ID, &saved.Currency, &saved.Base, &saved.Rate, &saved.Effective, &saved.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRateExists
+	}
+	if IsOverflow(err) {
+		return nil, validate.ErrFailed.WithDetails(apperr.Detail{Field: "rate", Rule: "max", Message: "must have at most 10 integer and 10 fractional digits"})
+	}
+	if err == nil {
+		err = audit.Record(ctx, tx, "exchange_rate.create", "exchange_rate", saved.ID, nil, saved)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return saved, nil
+}
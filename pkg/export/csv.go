@@ -0,0 +1,73 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+type csvWriter struct {
+	out *csv.Writer
+	row []string
+}
+
+func newCSVWriter(out io.Writer) *csvWriter {
+	return &csvWriter{out: csv.NewWriter(out)}
+}
+
+func (w *csvWriter) Write(row []interface{}) error {
+	w.row = w.row[:0]
+	for _, cell := range row {
+		text := formatCell(cell)
+		if _, ok := cell.(string); ok {
+			text = escapeFormula(text)
+		}
+		w.row = append(w.row, text)
+	}
+	err := w.out.Write(w.row)
+	if err != nil {
+		return err
+	}
+	// rows are flushed as they come, so the response streams
+	w.out.Flush()
+	return w.out.Error()
+}
+
+func (w *csvWriter) Close() error {
+	w.out.Flush()
+	return w.out.Error()
+}
+
+// escapeFormula keeps spreadsheets from running text written by customers
+// as formula, such text is prefixed with apostrophe. Signed numbers, e.g.
+// phones in E.164 format, are not formulas and are kept as they are.
+func escapeFormula(text string) string {
+	if text == "" {
+		return text
+	}
+	switch text[0] {
+	case '+', '-':
+		if isNumber(text[1:]) {
+			return text
+		}
+		return "'" + text
+	case '=', '@', '\t', '\r':
+		return "'" + text
+	}
+	return text
+}
+
+// isNumber reports whether text is digits with at most one decimal point
+func isNumber(text string) bool {
+	digits, point := 0, false
+	for _, r := range text {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '.' && !point:
+			point = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
@@ -0,0 +1,71 @@
+// Package export streams customers, products and sales as CSV or XLSX
+// spreadsheets row by row, nothing but the current row is kept in memory.
+package export
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+)
+
+// Formats of spreadsheets
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Exported entities
+const (
+	EntityCustomers = "customers"
+	EntityProducts  = "products"
+	EntitySales     = "sales"
+)
+
+var ErrUnknownFormat = apperr.New(apperr.KindInvalid, "unknown_format", "format must be csv or xlsx")
+
+// Writer writes rows of a sheet, cells are string, int64, bool or time.Time,
+// nothing is complete until Close
+type Writer interface {
+	Write(row []interface{}) error
+	Close() error
+}
+
+// NewWriter returns writer of the format, sheet is name of the XLSX sheet
+func NewWriter(format string, out io.Writer, sheet string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(out), nil
+	case FormatXLSX:
+		return newXLSXWriter(out, sheet), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ContentType returns media type of the format
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// formatCell returns text of the cell, times are RFC 3339
+func formatCell(cell interface{}) string {
+	switch value := cell.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case int:
+		return strconv.Itoa(value)
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Time:
+		return value.Format(time.RFC3339)
+	}
+	return ""
+}
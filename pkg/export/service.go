@@ -0,0 +1,156 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/reports"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+var ErrUnknownEntity = apperr.New(apperr.KindNotFound, "unknown_entity", "entity can't be exported")
+
+// Filter of exported rows. Customers and products are active ones like in
+// the list endpoints unless IncludeInactive is set, sales are taken from
+// the range of reports and may be narrowed to a manager or customer.
+type Filter struct {
+	IncludeInactive bool
+	Range           *reports.Filter
+	ManagerID       int64
+	CustomerID      int64
+}
+
+// ParseFilter reads filter from query of the request
+func ParseFilter(query url.Values) (*Filter, error) {
+	filter := &Filter{}
+	details := make([]apperr.Detail, 0)
+
+	if value := query.Get("include_inactive"); value != "" {
+		include, err := strconv.ParseBool(value)
+		if err != nil {
+			details = append(details, apperr.Detail{Field: "include_inactive", Rule: "type", Message: "must be true or false"})
+		}
+		filter.IncludeInactive = include
+	}
+	parseInt := func(name string, dst *int64) {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 1 {
+				details = append(details, apperr.Detail{Field: name, Rule: "min", Message: "must be positive integer"})
+				return
+			}
+			*dst = n
+		}
+	}
+	parseInt("manager_id", &filter.ManagerID)
+	parseInt("customer_id", &filter.CustomerID)
+
+	rangeFilter, err := reports.ParseFilter(url.Values{"from": query["from"], "to": query["to"], "tz": query["tz"]})
+	var e *apperr.Error
+	if errors.As(err, &e) {
+		details = append(details, e.Details...)
+	}
+	filter.Range = rangeFilter
+
+	if len(details) != 0 {
+		return nil, apperr.ErrBadRequest.WithDetails(details...)
+	}
+	return filter, nil
+}
+
+// Service writes entities from the database into spreadsheets
+type Service struct {
+	pool *pgxpool.Pool
+}
+
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool}
+}
+
+// Export writes header and rows of the entity, rows are read from the
+// cursor one at a time
+func (s *Service) Export(ctx context.Context, entity string, filter *Filter, out Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "export.Export", tracing.WithAttributes(map[string]interface{}{"export.entity": entity}))
+	defer tracing.End(span, &err)
+
+	var header []interface{}
+	var rows pgx.Rows
+	switch entity {
+	case EntityCustomers:
+		header = []interface{}{"id", "name", "phone", "active", "verified", "created"}
+		rows, err = s.pool.Query(ctx, `
+			SELECT id, name, phone, active, verified, created
+				FROM customers WHERE active OR $1 ORDER BY id`, filter.IncludeInactive)
+	case EntityProducts:
+		header = []interface{}{"id", "sku", "barcode", "name", "price", "currency", "qty", "active", "created"}
+		rows, err = s.pool.Query(ctx, `
+			SELECT id, COALESCE(sku, ''), COALESCE(barcode, ''), name, price, currency, qty, active, created
+				FROM products WHERE active OR $1 ORDER BY id`, filter.IncludeInactive)
+	case EntitySales:
+		// one line per sale position
+		header = []interface{}{"sale_id", "number", "created", "manager_id", "manager", "department", "customer_id", "customer",
+			"position_id", "product_id", "product", "price", "currency", "qty", "tax_rate", "tax", "total"}
+		rows, err = s.pool.Query(ctx, `
+			SELECT s.id, s.number, s.created, m.id, m.name, COALESCE(m.department, ''), c.id, c.name,
+					sp.id, p.id, p.name, sp.price, sp.currency, sp.qty, sp.tax_rate::bigint, sp.tax, sp.total
+				FROM sales s
+				JOIN sale_positions sp ON sp.sale_id = s.id
+				JOIN managers m ON m.id = s.manager_id
+				JOIN customers c ON c.id = s.customer_id
+				JOIN products p ON p.id = sp.product_id
+				WHERE s.created >= $1 AND s.created < $2
+					AND ($3::bigint = 0 OR s.manager_id = $3)
+					AND ($4::bigint = 0 OR s.customer_id = $4)
+				ORDER BY s.id, sp.id`,
+			filter.Range.From.UTC(), filter.Range.To.UTC(), filter.ManagerID, filter.CustomerID)
+	default:
+		return ErrUnknownEntity
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	defer rows.Close()
+
+	wroteHeader := false
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return ErrInternal.Wrap(err)
+		}
+		if !wroteHeader {
+			err = out.Write(header)
+			if err != nil {
+				return err
+			}
+			wroteHeader = true
+		}
+		for i, value := range values {
+			// stored times are UTC, they are shown in timezone of the filter
+			if t, ok := value.(time.Time); ok {
+				values[i] = t.In(filter.Range.Location)
+			}
+		}
+		err = out.Write(values)
+		if err != nil {
+			return err
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	if !wroteHeader {
+		err = out.Write(header)
+		if err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
@@ -0,0 +1,142 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+)
+
+// Parts of the workbook besides the sheet, the sheet is written last so it
+// can be streamed into the archive
+const (
+	xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+	xlsxRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbookStart = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="`
+	xlsxWorkbookEnd = `" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxSheetStart  = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd    = `</sheetData></worksheet>`
+)
+
+// xlsxWriter writes workbook of one sheet, numbers are number cells and
+// everything else is inline string, so no shared strings table is kept
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	name    string
+	rows    int
+	err     error
+}
+
+func newXLSXWriter(out io.Writer, sheet string) *xlsxWriter {
+	return &xlsxWriter{archive: zip.NewWriter(out), name: sheet}
+}
+
+// start writes parts before the sheet, it is deferred until the first row
+// so nothing is sent when export fails before it
+func (w *xlsxWriter) start() error {
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/workbook.xml", xlsxWorkbookStart + escapeXML(w.name) + xlsxWorkbookEnd},
+	}
+	for _, part := range parts {
+		file, err := w.archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(file, part.content)
+		if err != nil {
+			return err
+		}
+	}
+	file, err := w.archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	w.sheet = bufio.NewWriter(file)
+	_, err = w.sheet.WriteString(xlsxSheetStart)
+	return err
+}
+
+func (w *xlsxWriter) Write(row []interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.sheet == nil {
+		w.err = w.start()
+		if w.err != nil {
+			return w.err
+		}
+	}
+	w.rows++
+	w.sheet.WriteString(`<row r="` + strconv.Itoa(w.rows) + `">`)
+	for _, cell := range row {
+		switch value := cell.(type) {
+		case int64, int:
+			w.sheet.WriteString(`<c t="n"><v>` + formatCell(value) + `</v></c>`)
+		case bool:
+			v := "0"
+			if value {
+				v = "1"
+			}
+			w.sheet.WriteString(`<c t="b"><v>` + v + `</v></c>`)
+		default:
+			w.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">` + escapeXML(formatCell(value)) + `</t></is></c>`)
+		}
+	}
+	_, w.err = w.sheet.WriteString(`</row>`)
+	if w.err == nil && w.rows%100 == 0 {
+		w.err = w.flush()
+	}
+	return w.err
+}
+
+// flush passes buffered rows through the archive to the output
+func (w *xlsxWriter) flush() error {
+	err := w.sheet.Flush()
+	if err != nil {
+		return err
+	}
+	return w.archive.Flush()
+}
+
+func (w *xlsxWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.sheet == nil {
+		w.err = w.start()
+		if w.err != nil {
+			return w.err
+		}
+	}
+	_, err := w.sheet.WriteString(xlsxSheetEnd)
+	if err == nil {
+		err = w.sheet.Flush()
+	}
+	if err == nil {
+		err = w.archive.Close()
+	}
+	return err
+}
+
+func escapeXML(text string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
@@ -0,0 +1,273 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level of the log record
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	}
+	return "error"
+}
+
+// ParseLevel converts name of the level, unknown names are info
+func ParseLevel(name string) Level {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	}
+	return LevelInfo
+}
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Redacted replaces values of sensitive fields
+const Redacted = "[REDACTED]"
+
+// sensitive parts of field names whose values are never written
+var sensitive = []string{"password", "token", "secret", "authorization", "otp", "reset_code"}
+
+// Field is a key value pair attached to the record
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err creates error field
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error", Value: nil}
+	}
+	return Field{Key: "error", Value: err.Error()}
+}
+
+// Logger writes leveled records with fields in text or JSON format
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  Level
+	json   bool
+	fields []Field
+}
+
+// New creates logger, format is FormatText or FormatJSON
+func New(out io.Writer, level Level, format string) *Logger {
+	return &Logger{mu: &sync.Mutex{}, out: out, level: level, json: format == FormatJSON}
+}
+
+var std = New(os.Stderr, LevelInfo, FormatText)
+
+// Default returns logger used when context has none
+func Default() *Logger {
+	return std
+}
+
+// SetDefault replaces default logger
+func SetDefault(l *Logger) {
+	std = l
+}
+
+// With returns logger which adds fields to every record
+func (l *Logger) With(fields ...Field) *Logger {
+	c := *l
+	c.fields = append(append([]Field{}, l.fields...), fields...)
+	return &c
+}
+
+// Enabled reports whether records of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, fields ...Field) { l.log(LevelDebug, msg, fields) }
+func (l *Logger) Info(msg string, fields ...Field)  { l.log(LevelInfo, msg, fields) }
+func (l *Logger) Warn(msg string, fields ...Field)  { l.log(LevelWarn, msg, fields) }
+func (l *Logger) Error(msg string, fields ...Field) { l.log(LevelError, msg, fields) }
+
+func (l *Logger) log(level Level, msg string, fields []Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	all := append(append([]Field{}, l.fields...), fields...)
+	for i := range all {
+		if IsSensitive(all[i].Key) {
+			all[i].Value = Redacted
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if l.json {
+		record := make(map[string]interface{}, len(all)+3)
+		for _, f := range all {
+			record[f.Key] = jsonValue(f.Value)
+		}
+		record["time"] = now
+		record["level"] = level.String()
+		record["msg"] = msg
+		data, err := json.Marshal(record)
+		if err != nil {
+			data, _ = json.Marshal(map[string]string{"time": now, "level": level.String(), "msg": msg, "error": err.Error()})
+		}
+		buf.Write(data)
+	} else {
+		buf.WriteString(now)
+		buf.WriteString(" ")
+		buf.WriteString(strings.ToUpper(level.String()))
+		buf.WriteString(" ")
+		buf.WriteString(msg)
+		for _, f := range all {
+			buf.WriteString(" ")
+			buf.WriteString(f.Key)
+			buf.WriteString("=")
+			buf.WriteString(textValue(f.Value))
+		}
+	}
+	buf.WriteString("\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.out.Write(buf.Bytes())
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case error:
+		return value.Error()
+	case time.Duration:
+		return value.Seconds()
+	case fmt.Stringer:
+		return value.String()
+	}
+	return v
+}
+
+func textValue(v interface{}) string {
+	var s string
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		s = value
+	case error:
+		s = value.Error()
+	case time.Duration:
+		return value.String()
+	default:
+		s = fmt.Sprint(value)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// IsSensitive reports whether values of the field must be redacted
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitive {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactValues returns copy of values, e.g. URL query, with sensitive entries replaced
+func RedactValues(values map[string][]string) map[string][]string {
+	redacted := make(map[string][]string, len(values))
+	for key, value := range values {
+		if IsSensitive(key) {
+			redacted[key] = []string{Redacted}
+			continue
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+type contextKey struct {
+	name string
+}
+
+var loggerContextKey = &contextKey{"logger"}
+var requestIDContextKey = &contextKey{"request id"}
+
+// WithContext stores logger in context
+func WithContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, l)
+}
+
+// FromContext returns logger stored in context or default one
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerContextKey).(*Logger); ok {
+			return l
+		}
+	}
+	return std
+}
+
+// WithRequestID stores id of the request in context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+// RequestID returns id of the request stored in context
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// NewRequestID generates random id for request without one
+func NewRequestID() string {
+	buffer := make([]byte, 16)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buffer)
+}
@@ -0,0 +1,20 @@
+package managers
+
+import (
+	"context"
+
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/tracing"
+)
+
+// AuditLog returns entries of audit log matching the filter, newest first
+func (s *Service) AuditLog(ctx context.Context, filter *audit.Filter) (items []*audit.Entry, err error) {
+	ctx, span := tracing.Start(ctx, "managers.AuditLog")
+	defer tracing.End(span, &err)
+
+	items, err = audit.Find(ctx, s.pool, filter)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return items, nil
+}
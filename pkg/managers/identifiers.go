@@ -0,0 +1,133 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/barcode"
+	"github.com/darkside1809/gosql/pkg/money"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrProductConflict = apperr.New(apperr.KindConflict, "product_conflict", "SKU or barcode belongs to another product")
+var ErrInvalidBarcode = apperr.New(apperr.KindInvalid, "invalid_barcode", "barcode must be EAN-8, UPC-A, EAN-13 or GTIN-14 with valid check digit")
+
+// productColumns are selected for Product in the order scanned by scanProduct,
+// products without SKU or barcode have empty strings, without tax class or
+// reorder threshold zero
+const productColumns = `id, COALESCE(sku, ''), COALESCE(barcode, ''), COALESCE(tax_class_id, 0), name, price, currency, qty, COALESCE(reorder_threshold, 0), active, created`
+
+// uniqueViolation is SQLSTATE of duplicate key
+const uniqueViolation = "23505"
+
+// scanProduct scans row of productColumns
+func scanProduct(row pgx.Row, item *Product) error {
+	return row.Scan(&item.ID, &item.SKU, &item.Barcode, &item.TaxClassID, &item.Name, &item.Price.Amount, &item.Price.Currency, &item.Qty, &item.ReorderThreshold, &item.Active, &item.Created)
+}
+
+// Normalize trims SKU, converts barcode to canonical GTIN and puts currency
+// in upper case before validation
+func (p *Product) Normalize() {
+	p.SKU = strings.TrimSpace(p.SKU)
+	p.Barcode = barcode.Clean(p.Barcode)
+	p.Price.Currency = money.Code(p.Price.Currency)
+}
+
+// Normalize trims SKU and puts currency of the position in upper case before validation
+func (p *SalesPosition) Normalize() {
+	p.SKU = strings.TrimSpace(p.SKU)
+	p.Price.Currency = money.Code(p.Price.Currency)
+}
+
+// Normalize trims SKUs of positions before validation
+func (s *Sale) Normalize() {
+	for _, position := range s.Positions {
+		if position != nil {
+			position.Normalize()
+		}
+	}
+}
+
+// ProductBySKU returns product with the stock keeping unit, inactive ones too
+func (s *Service) ProductBySKU(ctx context.Context, sku string) (item *Product, err error) {
+	ctx, span := tracing.Start(ctx, "managers.ProductBySKU")
+	defer tracing.End(span, &err)
+
+	item = &Product{}
+	err = scanProduct(s.pool.QueryRow(ctx, `SELECT `+productColumns+` FROM products WHERE sku = $1`, strings.TrimSpace(sku)), item)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return item, nil
+}
+
+// ProductByBarcode returns product with the barcode, UPC-A code finds
+// product stored with EAN-13 of the same digits
+func (s *Service) ProductByBarcode(ctx context.Context, code string) (item *Product, err error) {
+	ctx, span := tracing.Start(ctx, "managers.ProductByBarcode")
+	defer tracing.End(span, &err)
+
+	code, err = barcode.Normalize(code)
+	if err != nil {
+		return nil, ErrInvalidBarcode
+	}
+	item = &Product{}
+	err = scanProduct(s.pool.QueryRow(ctx, `SELECT `+productColumns+` FROM products WHERE barcode = $1`, code), item)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return item, nil
+}
+
+// checkIdentifiers returns ErrProductConflict listing SKU and barcode of the
+// product which are used by other products
+func checkIdentifiers(ctx context.Context, tx pgx.Tx, product *Product) error {
+	if product.SKU == "" && product.Barcode == "" {
+		return nil
+	}
+	var skuUsed, barcodeUsed bool
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE(bool_or(sku = $2), false), COALESCE(bool_or(barcode = $3), false)
+			FROM products
+			WHERE id <> $1 AND (sku = $2 OR barcode = $3)`,
+		product.ID, nullString(product.SKU), nullString(product.Barcode)).Scan(&skuUsed, &barcodeUsed)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	details := make([]apperr.Detail, 0)
+	if skuUsed {
+		details = append(details, apperr.Detail{Field: "sku", Rule: "unique", Message: "is used by another product"})
+	}
+	if barcodeUsed {
+		details = append(details, apperr.Detail{Field: "barcode", Rule: "unique", Message: "is used by another product"})
+	}
+	if len(details) != 0 {
+		return ErrProductConflict.WithDetails(details...)
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is duplicate key error of the server,
+// it happens when concurrent write takes SKU or barcode after checkIdentifiers
+func isUniqueViolation(err error) bool {
+	var state interface{ SQLState() string }
+	return errors.As(err, &state) && state.SQLState() == uniqueViolation
+}
+
+// nullString returns nil for empty string, so optional unique columns
+// store NULL instead of duplicate empty values
+func nullString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
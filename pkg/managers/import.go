@@ -0,0 +1,481 @@
+package managers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/barcode"
+	"github.com/darkside1809/gosql/pkg/money"
+	"github.com/darkside1809/gosql/pkg/outbox"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/darkside1809/gosql/pkg/validate"
+	"github.com/jackc/pgx/v4"
+)
+
+// Formats of product imports
+const (
+	ImportCSV       = "csv"
+	ImportJSONLines = "jsonl"
+)
+
+// MaxImportRows caps number of rows of one import
+const MaxImportRows = 100000
+
+// Statuses of imported rows
+const (
+	ImportCreated  = "created"
+	ImportUpdated  = "updated"
+	ImportRejected = "rejected"
+)
+
+var ErrImportFormat = apperr.New(apperr.KindInvalid, "import_format", "import must be CSV with header or JSON Lines")
+
+// ImportRow is a product matched by SKU, missing qty, active, barcode and
+// currency keep values of existing products and are 0, true, none and the
+// default currency of the service for new ones. Price is in minor units.
+type ImportRow struct {
+	SKU      string `json:"sku" validate:"required,sku"`
+	Barcode  string `json:"barcode" validate:"barcode"`
+	Name     string `json:"name" validate:"required,max=200"`
+	Price    *int   `json:"price" validate:"min=0"`
+	Currency string `json:"currency" validate:"currency"`
+	Qty      *int   `json:"qty" validate:"min=0"`
+	Active   *bool  `json:"active"`
+}
+
+// ImportResult of a row, Line is number of the line in the file
+type ImportResult struct {
+	Line   int             `json:"line"`
+	SKU    string          `json:"sku,omitempty"`
+	Status string          `json:"status"`
+	ID     int64           `json:"id,omitempty"`
+	Errors []apperr.Detail `json:"errors,omitempty"`
+}
+
+// ImportReport lists result of every row, nothing is written in dry run
+type ImportReport struct {
+	DryRun   bool            `json:"dry_run"`
+	Created  int             `json:"created"`
+	Updated  int             `json:"updated"`
+	Rejected int             `json:"rejected"`
+	Rows     []*ImportResult `json:"rows"`
+}
+
+type importLine struct {
+	result *ImportResult
+	row    *ImportRow
+}
+
+// ImportProducts upserts products read from CSV or JSON Lines by SKU in one
+// transaction, invalid rows are rejected and the rest is imported
+func (s *Service) ImportProducts(ctx context.Context, format string, r io.Reader, dryRun bool) (report *ImportReport, err error) {
+	ctx, span := tracing.Start(ctx, "managers.ImportProducts", tracing.WithAttributes(map[string]interface{}{"import.dry_run": dryRun}))
+	defer tracing.End(span, &err)
+
+	lines, err := parseImport(format, r)
+	if err != nil {
+		return nil, err
+	}
+	report = &ImportReport{DryRun: dryRun, Rows: make([]*ImportResult, 0, len(lines))}
+	valid := make(map[string]*importLine)
+	barcodes := make(map[string]*importLine)
+	rows := make([][]interface{}, 0, len(lines))
+	for _, line := range lines {
+		report.Rows = append(report.Rows, line.result)
+		if line.row == nil {
+			continue
+		}
+		if first, ok := valid[line.row.SKU]; ok {
+			line.reject(apperr.Detail{Field: "sku", Rule: "unique", Message: "duplicate of line " + strconv.Itoa(first.result.Line)})
+			continue
+		}
+		if first, ok := barcodes[line.row.Barcode]; ok && line.row.Barcode != "" {
+			line.reject(apperr.Detail{Field: "barcode", Rule: "unique", Message: "duplicate of line " + strconv.Itoa(first.result.Line)})
+			continue
+		}
+		valid[line.row.SKU] = line
+		barcodes[line.row.Barcode] = line
+		rows = append(rows, []interface{}{line.result.Line, line.row.SKU, nullString(line.row.Barcode), line.row.Name, int64(*line.row.Price), nullString(line.row.Currency), nullInt(line.row.Qty), nullBool(line.row.Active)})
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE import_products (
+			line   INTEGER NOT NULL,
+			sku     TEXT    NOT NULL,
+			barcode TEXT,
+			name    TEXT    NOT NULL,
+			price   BIGINT  NOT NULL,
+			currency TEXT,
+			qty     BIGINT,
+			active  BOOLEAN
+		) ON COMMIT DROP`)
+	if err == nil {
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"import_products"}, []string{"line", "sku", "barcode", "name", "price", "currency", "qty", "active"}, pgx.CopyFromRows(rows))
+	}
+	if err == nil {
+		err = rejectUsedBarcodes(ctx, tx, valid)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	if dryRun {
+		err = s.previewImport(ctx, tx, valid)
+	} else {
+		err = s.applyImport(ctx, tx, valid)
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+	}
+	if isUniqueViolation(err) {
+		// barcodes swapped between products of the file
+		return nil, ErrProductConflict.Wrap(err)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	for _, item := range report.Rows {
+		switch item.Status {
+		case ImportCreated:
+			report.Created++
+		case ImportUpdated:
+			report.Updated++
+		case ImportRejected:
+			report.Rejected++
+		}
+	}
+	return report, nil
+}
+
+// rejectUsedBarcodes rejects rows with barcode of a product with another SKU
+// and removes them from the import
+func rejectUsedBarcodes(ctx context.Context, tx pgx.Tx, valid map[string]*importLine) error {
+	rows, err := tx.Query(ctx, `
+		DELETE FROM import_products i USING products p
+			WHERE p.barcode = i.barcode AND p.sku IS DISTINCT FROM i.sku
+			RETURNING i.sku, p.id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sku string
+		var id int64
+		err = rows.Scan(&sku, &id)
+		if err != nil {
+			return err
+		}
+		valid[sku].reject(apperr.Detail{Field: "barcode", Rule: "unique", Message: "is used by product " + strconv.FormatInt(id, 10)})
+		delete(valid, sku)
+	}
+	return rows.Err()
+}
+
+// previewImport sets statuses rows would get without writing them
+func (s *Service) previewImport(ctx context.Context, tx pgx.Tx, valid map[string]*importLine) error {
+	rows, err := tx.Query(ctx, `
+		SELECT i.sku, COALESCE(p.id, 0) FROM import_products i LEFT JOIN products p ON p.sku = i.sku`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sku string
+		var id int64
+		err = rows.Scan(&sku, &id)
+		if err != nil {
+			return err
+		}
+		line := valid[sku]
+		line.result.Status = ImportCreated
+		if id != 0 {
+			line.result.Status = ImportUpdated
+			line.result.ID = id
+		}
+	}
+	return rows.Err()
+}
+
+// applyImport updates products with known SKU, creates the others and
+// records them in audit log and outbox
+func (s *Service) applyImport(ctx context.Context, tx pgx.Tx, valid map[string]*importLine) error {
+	items := make([]audit.Item, 0, len(valid))
+	messages := make([]outbox.Message, 0, len(valid))
+
+	rows, err := tx.Query(ctx, `
+		WITH before AS (
+			SELECT p.id, COALESCE(p.barcode, '') AS barcode, COALESCE(p.tax_class_id, 0) AS tax_class_id, p.name, p.price, p.currency, p.qty,
+					COALESCE(p.reorder_threshold, 0) AS reorder_threshold, p.active, p.created
+				FROM products p JOIN import_products i ON i.sku = p.sku
+				FOR UPDATE OF p
+		)
+		UPDATE products p SET name = i.name, price = i.price, qty = COALESCE(i.qty, p.qty), active = COALESCE(i.active, p.active),
+				barcode = COALESCE(i.barcode, p.barcode), currency = COALESCE(i.currency, p.currency)
+			FROM import_products i, before b
+			WHERE p.sku = i.sku AND b.id = p.id
+			RETURNING i.sku, b.barcode, b.tax_class_id, b.name, b.price, b.currency, b.qty, b.reorder_threshold, b.active, b.created,
+				p.id, COALESCE(p.barcode, ''), COALESCE(p.tax_class_id, 0), p.name, p.price, p.currency, p.qty, COALESCE(p.reorder_threshold, 0), p.active, p.created`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var sku string
+		before, after := &Product{}, &Product{}
+		err = rows.Scan(&sku, &before.Barcode, &before.TaxClassID, &before.Name, &before.Price.Amount, &before.Price.Currency, &before.Qty, &before.ReorderThreshold, &before.Active, &before.Created,
+			&after.ID, &after.Barcode, &after.TaxClassID, &after.Name, &after.Price.Amount, &after.Price.Currency, &after.Qty, &after.ReorderThreshold, &after.Active, &after.Created)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		before.ID, before.SKU, after.SKU = after.ID, sku, sku
+		valid[sku].result.Status = ImportUpdated
+		valid[sku].result.ID = after.ID
+		items = append(items, audit.Item{Action: "product.update", Target: "product", TargetID: after.ID, Before: before, After: after})
+		messages = append(messages, s.productMessages(before, after)...)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = tx.Query(ctx, `
+		INSERT INTO products(sku, barcode, name, price, currency, qty, active)
+			SELECT sku, barcode, name, price, COALESCE(currency, $1), COALESCE(qty, 0), COALESCE(active, TRUE) FROM import_products i
+				WHERE NOT EXISTS (SELECT 1 FROM products p WHERE p.sku = i.sku)
+				ORDER BY line
+			RETURNING `+productColumns, s.currency)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		after := &Product{}
+		err = scanProduct(rows, after)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		sku := after.SKU
+		valid[sku].result.Status = ImportCreated
+		valid[sku].result.ID = after.ID
+		items = append(items, audit.Item{Action: "product.create", Target: "product", TargetID: after.ID, After: after})
+		messages = append(messages, outbox.Message{Type: outbox.EventProductCreated, Aggregate: "product", AggregateID: after.ID, Payload: after})
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	err = audit.RecordAll(ctx, tx, items)
+	if err != nil {
+		return err
+	}
+	return outbox.PublishAll(ctx, tx, messages)
+}
+
+// productMessages returns events of product update, the same recordProduct publishes
+func (s *Service) productMessages(before *Product, after *Product) []outbox.Message {
+	messages := []outbox.Message{{
+		Type: outbox.EventProductUpdated, Aggregate: "product", AggregateID: after.ID,
+		Payload: map[string]interface{}{"before": before, "after": after},
+	}}
+	if before.Price != after.Price {
+		messages = append(messages, outbox.Message{
+			Type: outbox.EventProductPriceChanged, Aggregate: "product", AggregateID: after.ID,
+			Payload: map[string]interface{}{"product_id": after.ID, "name": after.Name, "old_price": before.Price, "price": after.Price},
+		})
+	}
+	if threshold := s.threshold(after.ReorderThreshold); s.fellBelowThreshold(threshold, before.Qty, after.Qty) {
+		messages = append(messages, outbox.Message{
+			Type: outbox.EventProductLowStock, Aggregate: "product", AggregateID: after.ID,
+			Payload: map[string]interface{}{"product_id": after.ID, "name": after.Name, "qty": after.Qty, "threshold": threshold},
+		})
+	}
+	return messages
+}
+
+func (l *importLine) reject(details ...apperr.Detail) {
+	l.row = nil
+	l.result.Status = ImportRejected
+	l.result.Errors = append(l.result.Errors, details...)
+}
+
+// parseImport reads rows of the file, malformed rows are rejected and
+// errors are returned only when the file can't be read at all
+func parseImport(format string, r io.Reader) ([]*importLine, error) {
+	switch format {
+	case ImportCSV:
+		return parseImportCSV(r)
+	case ImportJSONLines:
+		return parseImportJSONLines(r)
+	}
+	return nil, ErrImportFormat
+}
+
+func parseImportCSV(r io.Reader) ([]*importLine, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, ErrImportFormat.Wrap(err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch name {
+		case "sku", "barcode", "name", "price", "currency", "qty", "active":
+			columns[name] = i
+		default:
+			return nil, ErrImportFormat.WithDetails(apperr.Detail{Field: name, Rule: "unknown", Message: "unknown column, columns are sku, barcode, name, price, currency, qty and active"})
+		}
+	}
+	for _, name := range []string{"sku", "name", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, ErrImportFormat.WithDetails(apperr.Detail{Field: name, Rule: "required", Message: "column is required"})
+		}
+	}
+
+	lines := make([]*importLine, 0)
+	for number := 2; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if len(lines) == MaxImportRows {
+			return nil, ErrImportFormat.WithDetails(apperr.Detail{Message: "at most " + strconv.Itoa(MaxImportRows) + " rows are imported at once"})
+		}
+		line := &importLine{result: &ImportResult{Line: number}, row: &ImportRow{}}
+		lines = append(lines, line)
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, ErrImportFormat.Wrap(err)
+			}
+			line.reject(apperr.Detail{Rule: "csv", Message: err.Error()})
+			continue
+		}
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		line.row.SKU = cell("sku")
+		line.row.Barcode = cell("barcode")
+		line.row.Name = cell("name")
+		line.row.Currency = cell("currency")
+		line.result.SKU = line.row.SKU
+		details := make([]apperr.Detail, 0)
+		parseInt := func(name string) *int {
+			value := cell(name)
+			if value == "" {
+				return nil
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				details = append(details, apperr.Detail{Field: name, Rule: "type", Message: "must be integer"})
+				return nil
+			}
+			return &n
+		}
+		line.row.Price = parseInt("price")
+		line.row.Qty = parseInt("qty")
+		if value := cell("active"); value != "" {
+			active, err := strconv.ParseBool(value)
+			if err != nil {
+				details = append(details, apperr.Detail{Field: "active", Rule: "type", Message: "must be true or false"})
+			} else {
+				line.row.Active = &active
+			}
+		}
+		line.check(details)
+	}
+	return lines, nil
+}
+
+// maxImportLine limits length of a JSON line
+const maxImportLine = 64 * 1024
+
+func parseImportJSONLines(r io.Reader) ([]*importLine, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxImportLine)
+	lines := make([]*importLine, 0)
+	for number := 1; scanner.Scan(); number++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		if len(lines) == MaxImportRows {
+			return nil, ErrImportFormat.WithDetails(apperr.Detail{Message: "at most " + strconv.Itoa(MaxImportRows) + " rows are imported at once"})
+		}
+		line := &importLine{result: &ImportResult{Line: number}, row: &ImportRow{}}
+		lines = append(lines, line)
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(line.row)
+		if err != nil {
+			line.reject(apperr.Detail{Rule: "json", Message: err.Error()})
+			continue
+		}
+		line.result.SKU = line.row.SKU
+		line.check(nil)
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, ErrImportFormat.Wrap(err)
+	}
+	return lines, nil
+}
+
+// check validates parsed row, details are problems found while parsing
+func (l *importLine) check(details []apperr.Detail) {
+	l.row.Barcode = barcode.Clean(l.row.Barcode)
+	l.row.Currency = money.Code(l.row.Currency)
+	if l.row.Price == nil && !hasField(details, "price") {
+		details = append(details, apperr.Detail{Field: "price", Rule: "required", Message: "is required"})
+	}
+	var failed *apperr.Error
+	if err := validate.Struct(l.row); errors.As(err, &failed) {
+		details = append(details, failed.Details...)
+	}
+	if len(details) != 0 {
+		l.reject(details...)
+	}
+}
+
+func hasField(details []apperr.Detail, field string) bool {
+	for _, detail := range details {
+		if detail.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func nullInt(n *int) interface{} {
+	if n == nil {
+		return nil
+	}
+	return int64(*n)
+}
+
+func nullBool(b *bool) interface{} {
+	if b == nil {
+		return nil
+	}
+	return *b
+}
@@ -0,0 +1,9 @@
+package managers
+
+import "github.com/darkside1809/gosql/pkg/money"
+
+// SetCurrency sets ISO 4217 currency of prices sent without one and of
+// sales totals, it is money.DefaultCurrency by default
+func (s *Service) SetCurrency(currency string) {
+	s.currency = money.Code(currency)
+}
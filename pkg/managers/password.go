@@ -0,0 +1,225 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/notify"
+	"github.com/darkside1809/gosql/pkg/password"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// resetCodeTTL is lifetime of password reset code
+	resetCodeTTL = 15 * time.Minute
+	// invitationTTL is lifetime of invitation of new manager
+	invitationTTL = 72 * time.Hour
+)
+
+// Invitation is sent to new manager to set password
+type Invitation struct {
+	ManagerID int64     `json:"manager_id"`
+	Expire    time.Time `json:"expire"`
+}
+
+// invite issues invitation code and sends it to the phone of the manager
+func (s *Service) invite(ctx context.Context, id int64, phone string) (*Invitation, error) {
+	code, err := password.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.codes.Issue(ctx, password.RealmManager, password.PurposeInvite, id, code, invitationTTL)
+	if err != nil {
+		return nil, err
+	}
+	err = s.notifier.Notify(ctx, &notify.Message{
+		To:      phone,
+		Subject: "Invitation",
+		Body:    "You are invited as a manager, set your password with invitation code " + code + ", it expires in 72 hours.",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Invitation{ManagerID: id, Expire: time.Now().Add(invitationTTL)}, nil
+}
+
+// AcceptInvitation sets password of invited manager and returns token
+func (s *Service) AcceptInvitation(ctx context.Context, code string, next string) (token string, err error) {
+	ctx, span := tracing.Start(ctx, "managers.AcceptInvitation")
+	defer tracing.End(span, &err)
+
+	id, err := s.codes.FindToken(ctx, password.RealmManager, password.PurposeInvite, code)
+	if err == password.ErrInvalidCode {
+		return "", err
+	}
+	if err != nil {
+		return "", ErrInternal.Wrap(err)
+	}
+
+	var name, phone string
+	err = s.pool.QueryRow(ctx, `SELECT name, phone FROM managers WHERE id = $1`, id).Scan(&name, &phone)
+	if err == pgx.ErrNoRows {
+		return "", password.ErrInvalidCode
+	}
+	if err != nil {
+		return "", ErrInternal.Wrap(err)
+	}
+	// policy is checked before the code is used, so weak password can be retried
+	err = s.policy.Check(next, name, phone)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.codes.ConsumeToken(ctx, password.RealmManager, password.PurposeInvite, code)
+	if err == password.ErrInvalidCode {
+		return "", err
+	}
+	if err != nil {
+		return "", ErrInternal.Wrap(err)
+	}
+	err = s.setPassword(ctx, id, next, "manager.invitation_accept")
+	if err != nil {
+		return "", err
+	}
+	scope, err := s.tokenScope(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return s.newToken(ctx, id, scope)
+}
+
+// ChangePassword sets new password of the manager after checking current one
+func (s *Service) ChangePassword(ctx context.Context, id int64, current string, next string) (err error) {
+	ctx, span := tracing.Start(ctx, "managers.ChangePassword")
+	defer tracing.End(span, &err)
+
+	var hash, name, phone string
+	err = s.pool.QueryRow(ctx, `SELECT password, name, phone FROM managers WHERE id = $1`, id).Scan(&hash, &name, &phone)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(current))
+	if err != nil {
+		return ErrInvalidPassword
+	}
+	err = s.policy.Check(next, name, phone)
+	if err != nil {
+		return err
+	}
+	return s.setPassword(ctx, id, next, "manager.password_change")
+}
+
+// RequestPasswordReset sends one-time code to the phone, unknown phones are ignored
+func (s *Service) RequestPasswordReset(ctx context.Context, phone string) (err error) {
+	ctx, span := tracing.Start(ctx, "managers.RequestPasswordReset")
+	defer tracing.End(span, &err)
+
+	var id int64
+	err = s.pool.QueryRow(ctx, `SELECT id FROM managers WHERE phone = $1 AND active`, phone).Scan(&id)
+	if err == pgx.ErrNoRows {
+		logger.FromContext(ctx).Info("password reset of unknown phone")
+		return nil
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+
+	code, err := password.NewCode(6)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = s.codes.Issue(ctx, password.RealmManager, password.PurposeReset, id, code, resetCodeTTL)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = s.notifier.Notify(ctx, &notify.Message{
+		To:      phone,
+		Subject: "Password reset",
+		Body:    "Your password reset code is " + code + ", it expires in 15 minutes.",
+	})
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
+
+// ResetPassword sets new password using code sent by RequestPasswordReset,
+// all tokens of the manager are revoked
+func (s *Service) ResetPassword(ctx context.Context, phone string, code string, next string) (err error) {
+	ctx, span := tracing.Start(ctx, "managers.ResetPassword")
+	defer tracing.End(span, &err)
+
+	var id int64
+	var name string
+	err = s.pool.QueryRow(ctx, `SELECT id, name FROM managers WHERE phone = $1`, phone).Scan(&id, &name)
+	if err == pgx.ErrNoRows {
+		return password.ErrInvalidCode
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+
+	err = s.policy.Check(next, name, phone)
+	if err != nil {
+		return err
+	}
+	err = s.codes.Consume(ctx, password.RealmManager, password.PurposeReset, id, code)
+	if err == password.ErrInvalidCode {
+		return err
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+
+	err = s.setPassword(ctx, id, next, "manager.password_reset")
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, `DELETE FROM managers_tokens WHERE manager_id = $1`, id)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
+
+// setPassword stores hash of the password, clears lock of the account and
+// records the action in audit log
+func (s *Service) setPassword(ctx context.Context, id int64, next string, action string) error {
+	hash, err := password.Hash(next)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE managers SET password = $2, failed_logins = 0, locked_until = NULL
+			WHERE id = $1`, id, hash)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	// password reset and invitation come from anonymous requests of the account itself
+	if _, ok := audit.ActorFromContext(ctx); !ok {
+		ctx = audit.WithActor(ctx, audit.Actor{Realm: audit.RealmManager, ID: id})
+	}
+	err = audit.Record(ctx, tx, action, "manager", id, nil, nil)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
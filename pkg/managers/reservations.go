@@ -0,0 +1,51 @@
+package managers
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/reservations"
+	"github.com/darkside1809/gosql/pkg/validate"
+	"github.com/jackc/pgx/v4"
+)
+
+// claimReservation locks reservation of the i-th position for the customer
+// of the sale. Position takes product of the reservation and may sell less
+// than it holds, the rest becomes available when the reservation is converted.
+func (s *Service) claimReservation(ctx context.Context, tx pgx.Tx, sale *Sale, i int, position *SalesPosition) error {
+	field := "positions[" + strconv.Itoa(i) + "]."
+	reservation, err := reservations.Claim(ctx, tx, position.ReservationID, sale.CustomerID)
+	detail := apperr.Detail{
+		Field:   field + "reservation_id",
+		Message: "reservation " + strconv.FormatInt(position.ReservationID, 10) + " can not be sold",
+	}
+	switch {
+	case err == reservations.ErrNotFound:
+		return reservations.ErrNotFound.WithDetails(detail)
+	case err == reservations.ErrNotActive:
+		return reservations.ErrNotActive.WithDetails(detail)
+	case err == reservations.ErrOtherCustomer:
+		return reservations.ErrOtherCustomer.WithDetails(detail)
+	case err != nil:
+		return ErrInternal.Wrap(err)
+	}
+	if (position.ProductID != 0 && position.ProductID != reservation.ProductID) ||
+		(position.SKU != "" && position.SKU != reservation.SKU) {
+		return validate.ErrFailed.WithDetails(apperr.Detail{
+			Field:   field + "product_id",
+			Rule:    "reservation",
+			Message: "must be product of the reservation",
+		})
+	}
+	if position.Qty > reservation.Qty {
+		return validate.ErrFailed.WithDetails(apperr.Detail{
+			Field:   field + "qty",
+			Rule:    "max",
+			Message: "must be at most " + strconv.Itoa(reservation.Qty) + " reserved",
+		})
+	}
+	position.ProductID = reservation.ProductID
+	position.reserved = reservation.Qty
+	return nil
+}
@@ -6,32 +6,71 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
-	"log"
+	"math"
 	"time"
 	"strconv"
 
 	"github.com/darkside1809/gosql/cmd/app/middleware"
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/exchange"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/darkside1809/gosql/pkg/validate"
+	"github.com/darkside1809/gosql/pkg/metrics"
+	"github.com/darkside1809/gosql/pkg/money"
+	"github.com/darkside1809/gosql/pkg/notify"
+	"github.com/darkside1809/gosql/pkg/outbox"
+	"github.com/darkside1809/gosql/pkg/password"
+	"github.com/darkside1809/gosql/pkg/phone"
+	"github.com/darkside1809/gosql/pkg/ratelimit"
+	"github.com/darkside1809/gosql/pkg/reservations"
+	"github.com/darkside1809/gosql/pkg/taxes"
 	"github.com/darkside1809/gosql/pkg/customers"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var ErrNotFound = errors.New("item not found")
-var ErrInternal = errors.New("internal error")
-var ErrPhoneUsed = errors.New("phone already registered")
-var ErrTokenNotFound = errors.New("token not found")
-var ErrTokenExpired = errors.New("token expired")
-var ErrNoSuchUser = errors.New("no such user")
-var ErrInvalidPassword = errors.New("invalid password")
-var ErrNoRows = errors.New("no rows")
+var ErrNotFound = apperr.New(apperr.KindNotFound, "not_found", "item not found")
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+var ErrPhoneUsed = apperr.New(apperr.KindConflict, "phone_used", "phone already registered")
+var ErrTokenNotFound = apperr.New(apperr.KindUnauthorized, "token_not_found", "token not found")
+var ErrTokenExpired = apperr.New(apperr.KindUnauthorized, "token_expired", "token expired")
+var ErrNoSuchUser = apperr.New(apperr.KindUnauthorized, "invalid_credentials", "invalid login or password")
+var ErrInvalidPassword = apperr.New(apperr.KindUnauthorized, "invalid_credentials", "invalid login or password")
+var ErrNoRows = apperr.New(apperr.KindNotFound, "no_rows", "no rows")
+var ErrNotAdmin = apperr.New(apperr.KindForbidden, "not_admin", "administrator role required")
+var ErrOutOfStock = apperr.New(apperr.KindUnprocessable, "out_of_stock", "product is inactive or out of stock")
+var ErrAccountLocked = apperr.New(apperr.KindTooManyRequests, "account_locked", "account is locked after repeated failed logins")
+
+var loginsTotal = metrics.Default.CounterVec("gosql_logins_total", "Login attempts by realm and result.", "realm", "result")
+var salesTotal = metrics.Default.Counter("gosql_sales_total", "Sales made by managers.")
+var salesRevenue = metrics.Default.CounterVec("gosql_sales_revenue_total", "Sum of totals of sold positions including tax in minor units by currency.", "currency")
 
 type Service struct {
-	pool *pgxpool.Pool
+	pool     *pgxpool.Pool
+	policy   *password.Policy
+	notifier notify.Notifier
+	codes    *password.Codes
+	lowStock int
+	// pricesIncludeTax tells whether tax is contained in prices of products or added to them
+	pricesIncludeTax bool
+	// currency of prices without one and of sales totals
+	currency string
+}
+
+// DefaultLowStockThreshold is stock below which product.low_stock is published
+const DefaultLowStockThreshold = 10
+
+func NewService(pool *pgxpool.Pool, policy *password.Policy, notifier notify.Notifier) *Service {
+	return &Service{pool: pool, policy: policy, notifier: notifier, codes: password.NewCodes(pool), lowStock: DefaultLowStockThreshold, pricesIncludeTax: true, currency: money.DefaultCurrency}
 }
 
-func NewService(pool *pgxpool.Pool) *Service {
-	return &Service{pool: pool}
+// SetLowStockThreshold changes stock below which product.low_stock is
+// published for products without reorder threshold
+func (s *Service) SetLowStockThreshold(threshold int) {
+	s.lowStock = threshold
 }
 
 // Types
@@ -48,15 +87,29 @@ type Manager struct {
 	IsAdmin     bool      `json:"is_admin"`
 	Created     time.Time `json:"created"`
 }
+// Registration of new manager, password is set by the manager through invitation
 type Registration struct {
-	Name     string 	`json:"name"`
-	Phone    string 	`json:"phone"`
-	Password string 	`json:"password"`
+	Name     string 	`json:"name" validate:"required,max=100"`
+	Phone    string 	`json:"phone" validate:"required,phone"`
 	Roles		[]string	`json:"roles"`
 }
 type Auth struct {
-	Login 	string `json:"login"`
-	Password string `json:"password"`
+	Login 	string `json:"login" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+// Normalize converts phone to E.164 before validation
+func (c *Credentials) Normalize() {
+	c.Phone = phone.Clean(c.Phone)
+}
+
+// Normalize converts phone to E.164 before validation
+func (r *Registration) Normalize() {
+	r.Phone = phone.Clean(r.Phone)
+}
+
+type Credentials struct {
+	Phone    string `json:"phone" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 type Purchase struct {
 	ID 			int64 `json:"id"`
@@ -64,29 +117,54 @@ type Purchase struct {
 	ManagerID	int	`json:"manager_id"`
 }
 type Product struct {
-	ID      int64     `json:"id"`
-	Name    string    `json:"name"`
-	Price   int       `json:"price"`
-	Qty     int       `json:"qty"`
+	ID      int64     `json:"id" validate:"min=0"`
+	SKU     string    `json:"sku,omitempty" validate:"sku"`
+	Barcode string    `json:"barcode,omitempty" validate:"barcode"`
+	// TaxClassID is zero for products which are not taxed
+	TaxClassID int64  `json:"tax_class_id,omitempty" validate:"min=0"`
+	Name    string    `json:"name" validate:"required,max=200"`
+	// Price without currency is in the default one of the service
+	Price   money.Money `json:"price" validate:"min=0"`
+	Qty     int       `json:"qty" validate:"min=0"`
+	// ReorderThreshold is stock below which product is reordered, zero is
+	// the threshold of the service
+	ReorderThreshold int `json:"reorder_threshold,omitempty" validate:"min=0"`
 	Active  bool      `json:"active"`
 	Created time.Time `json:"created"`
 }
 type Sale struct {
 	ID         int64           `json:"id"`
+	Number     int64           `json:"number"`
 	ManagerID  int64           `json:"manager_id"`
-	CustomerID int64           `json:"customer_id"`
+	Tax        money.Money     `json:"tax"`
+	Total      money.Money     `json:"total"`
+	// Status is pending until payments of the sale cover Total
+	Status     string          `json:"status"`
+	CustomerID int64           `json:"customer_id" validate:"required,min=1"`
 	Created    time.Time       `json:"created"`
-	Positions  []*SalesPosition `json:"positions"`
+	Positions  []*SalesPosition `json:"positions" validate:"required,max=500"`
 }
+// SalesPosition refers to product by ProductID or SKU, one of them is required
+// unless the position sells stock held by reservation ReservationID
 type SalesPosition struct {
-	ID        int64 `json:"id"`
-	ProductID int64 `json:"product_id"`
-	Price     int   `json:"price"`
-	Qty       int   `json:"qty"`
+	ID        int64  `json:"id"`
+	ProductID int64  `json:"product_id,omitempty" validate:"min=0"`
+	SKU       string `json:"sku,omitempty" validate:"sku"`
+	ReservationID int64 `json:"reservation_id,omitempty" validate:"min=0"`
+	// Price without currency is in currency of the product, other one is rejected
+	Price     money.Money `json:"price" validate:"min=0"`
+	Qty       int    `json:"qty" validate:"required,min=1"`
+	// TaxRate in basis points, Tax and Total are set when position is sold
+	TaxRate   int    `json:"tax_rate"`
+	Tax       money.Money `json:"tax"`
+	Total     money.Money `json:"total"`
+	// reserved is quantity held for the position by its reservation
+	reserved  int
 }
+// SalesTotal of manager converted into default currency of the service
 type SalesTotal struct {
-	ManagerID int64 `json:"manager_id"`
-	Total     int   `json:"total"`
+	ManagerID int64       `json:"manager_id"`
+	Total     money.Money `json:"total"`
 }
 func (s *Service) NewNullString(str string) sql.NullString{
 	if len(str) == 0 {
@@ -98,6 +176,8 @@ func (s *Service) NewNullString(str string) sql.NullString{
 	}
 }
 func (s *Service) IsAdmin(ctx context.Context, id int64) (isAdmin bool) {
+	ctx, span := tracing.Start(ctx, "managers.IsAdmin")
+	defer span.End()
 	err := s.pool.QueryRow(ctx, `SELECT is_admin FROM managers  WHERE id = $1`, id).Scan(&isAdmin)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return false
@@ -108,90 +188,223 @@ func (s *Service) IsAdmin(ctx context.Context, id int64) (isAdmin bool) {
 	return
 }
 // Register user and add him to a database
-func (s *Service) Register(ctx context.Context, manager *Manager) (string, error) {
+// Register creates manager without password and sends invitation code
+// to the phone, the manager sets password with AcceptInvitation
+func (s *Service) Register(ctx context.Context, manager *Manager) (*Invitation, error) {
+	ctx, span := tracing.Start(ctx, "managers.Register")
+	defer span.End()
 	var id int64
 
-	err := s.pool.QueryRow(ctx, `
-		INSERT INTO managers(name, phone, is_admin)
-			VALUES($1, $2, $3) ON CONFLICT (phone) DO NOTHING RETURNING id
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.Register", logger.Err(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	// empty password never matches bcrypt hash, so Token fails until invitation is accepted
+	err = tx.QueryRow(ctx, `
+		INSERT INTO managers(name, phone, password, is_admin)
+			VALUES($1, $2, '', $3) ON CONFLICT (phone) DO NOTHING RETURNING id
 			`, manager.Name, manager.Phone, manager.IsAdmin).Scan(&id)
 	if errors.Is(err, pgx.ErrNoRows) {
-		log.Print("No rows")
-		return "", ErrNoRows
+		return nil, ErrPhoneUsed
 	}
 
 	if err != nil {
-		log.Print(err)
-		return "", ErrInternal
+		logger.FromContext(ctx).Error("managers.Register", logger.Err(err))
+		return nil, ErrInternal
 	}
-
-	buffer := make([]byte, 256)
-	n, err := rand.Read(buffer)
-	if n != len(buffer) || err != nil {
-		return "", ErrInternal
+	err = audit.Record(ctx, tx, "manager.create", "manager", id, nil, map[string]interface{}{
+		"id": id, "name": manager.Name, "phone": manager.Phone, "is_admin": manager.IsAdmin,
+	})
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.Register", logger.Err(err))
+		return nil, ErrInternal
 	}
 
-	token := hex.EncodeToString(buffer)
-	_, err = s.pool.Exec(ctx, `
-		INSERT INTO managers_tokens(token, manager_id) VALUES($1, $2)`, token, id)
+	invitation, err := s.invite(ctx, id, manager.Phone)
 	if err != nil {
-		log.Print(err)
-		return "", ErrInternal
+		logger.FromContext(ctx).Error("managers.Register", logger.Err(err))
+		return nil, ErrInternal
 	}
-	return token, nil
+	return invitation, nil
 }
 // Token create token for user,
 // if user is not found, return ErrNoSuchUser,
 // if password is not found, return ErrInvalidPassword,
 // if something else goes wrong, return ErrInternal.
-func (s *Service) Token(ctx context.Context, phone string, password string) (token string, err error) {
+// Managers with two-factor authentication get challenge instead of token,
+// it is exchanged for token by VerifyTOTP.
+func (s *Service) Token(ctx context.Context, phone string, password string) (login *Login, err error) {
+	ctx, span := tracing.Start(ctx, "managers.Token")
+	defer tracing.End(span, &err)
 	var hash string
 	var id int64
 
-	err = s.pool.QueryRow(ctx, `SELECT id, password FROM managers WHERE phone = $1`, phone).Scan(&id, &hash)
+	var locked float64
+	var totpEnabled bool
+	err = s.pool.QueryRow(ctx, `
+		SELECT id, password, COALESCE(EXTRACT(EPOCH FROM locked_until - CURRENT_TIMESTAMP), 0), totp_enabled
+			FROM managers WHERE phone = $1`, phone).Scan(&id, &hash, &locked, &totpEnabled)
 	if err == pgx.ErrNoRows {
-		return "", ErrInvalidPassword
+		loginsTotal.With("manager", "failure").Inc()
+		return nil, ErrNoSuchUser
 	}
 	if err != nil {
-		return "", ErrInternal
+		loginsTotal.With("manager", "error").Inc()
+		return nil, ErrInternal
+	}
+	if locked > 0 {
+		loginsTotal.With("manager", "locked").Inc()
+		return nil, ErrAccountLocked.WithRetryAfter(time.Duration(locked * float64(time.Second)))
 	}
 
+	_, compareSpan := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	compareSpan.End()
+	if err != nil {
+		loginsTotal.With("manager", "failure").Inc()
+		return nil, s.loginFailed(ctx, id)
+	}
+	// failed logins are kept until the code is checked, so they limit guesses of codes too
+	if totpEnabled {
+		loginsTotal.With("manager", "challenge").Inc()
+		return s.challenge(ctx, id)
+	}
+
+	_, err = s.pool.Exec(ctx, `UPDATE managers SET failed_logins = 0, locked_until = NULL WHERE id = $1`, id)
+	if err != nil {
+		loginsTotal.With("manager", "error").Inc()
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	scope, err := s.tokenScope(ctx, id)
+	if err != nil {
+		loginsTotal.With("manager", "error").Inc()
+		return nil, err
+	}
+	token, err := s.newToken(ctx, id, scope)
 	if err != nil {
-		return "", ErrInvalidPassword
+		loginsTotal.With("manager", "error").Inc()
+		return nil, err
 	}
+	loginsTotal.With("manager", "success").Inc()
+	return &Login{Token: token, Scope: scope}, nil
+}
 
+// newToken creates token of the manager with the scope
+func (s *Service) newToken(ctx context.Context, id int64, scope string) (string, error) {
 	buffer := make([]byte, 256)
 	n, err := rand.Read(buffer)
 	if n != len(buffer) || err != nil {
 		return "", ErrInternal
 	}
 
-	token = hex.EncodeToString(buffer)
-
+	token := hex.EncodeToString(buffer)
 	_, err = s.pool.Exec(ctx, `
-		INSERT INTO managers_tokens(token, manager_id) VALUES($1, $2)`, token, id)
+		INSERT INTO managers_tokens(token, manager_id, scope) VALUES($1, $2, $3)`, token, id, scope)
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.newToken", logger.Err(err))
 		return "", ErrInternal
 	}
 	return token, nil
 }
-func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
-	var id int64
+// loginFailed records failed login of the manager and locks account
+// according to ratelimit.DefaultLockout, it returns error for the caller
+func (s *Service) loginFailed(ctx context.Context, id int64) error {
+	var failures int
 	err := s.pool.QueryRow(ctx, `
-	 SELECT manager_id FROM managers_tokens WHERE token = $1
-	 `, token).Scan(&id)
+		UPDATE managers SET failed_logins = failed_logins + 1
+			WHERE id = $1 RETURNING failed_logins`, id).Scan(&failures)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	lock := ratelimit.DefaultLockout.Duration(failures)
+	if lock == 0 {
+		return ErrInvalidPassword
+	}
+	_, err = s.pool.Exec(ctx, `
+		UPDATE managers SET locked_until = CURRENT_TIMESTAMP + make_interval(secs => $2)
+			WHERE id = $1`, id, lock.Seconds())
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	logger.FromContext(ctx).Warn("manager account locked", logger.F("manager_id", id), logger.F("failures", failures), logger.F("lock", lock))
+	return ErrAccountLocked.WithRetryAfter(lock)
+}
 
-	if err == pgx.ErrNoRows {
-		return 0, nil
+// Unlock clears failed logins and lock of the manager
+func (s *Service) Unlock(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "managers.Unlock")
+	defer span.End()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.Unlock", logger.Err(err))
+		return ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE managers SET failed_logins = 0, locked_until = NULL WHERE id = $1`, id)
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.Unlock", logger.Err(err))
+		return ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
 	}
+	err = audit.Record(ctx, tx, "manager.unlock", "manager", id, nil, nil)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.Unlock", logger.Err(err))
+		return ErrInternal
+	}
+	return nil
+}
+// IDByToken returns manager of the token, tokens limited to TOTP enrollment are rejected
+func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "managers.IDByToken")
+	defer span.End()
+	id, scope, err := s.tokenManager(ctx, token)
 	if err != nil {
-		return 0, ErrInternal
+		return 0, err
+	}
+	if id != 0 && scope != ScopeFull {
+		return 0, ErrTOTPEnrollmentRequired
 	}
 	return id, nil
 }
+
+// IDByEnrollmentToken returns manager of the token of any scope, it authenticates TOTP enrollment
+func (s *Service) IDByEnrollmentToken(ctx context.Context, token string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "managers.IDByEnrollmentToken")
+	defer span.End()
+	id, _, err := s.tokenManager(ctx, token)
+	return id, err
+}
+
+func (s *Service) tokenManager(ctx context.Context, token string) (id int64, scope string, err error) {
+	err = s.pool.QueryRow(ctx, `
+	 SELECT manager_id, scope FROM managers_tokens WHERE token = $1
+	 `, token).Scan(&id, &scope)
+
+	if err == pgx.ErrNoRows {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", ErrInternal
+	}
+	return id, scope, nil
+}
 func (s *Service) Purchases(ctx context.Context, id int64) ([]*Purchase, error) {
+	ctx, span := tracing.Start(ctx, "managers.Purchases")
+	defer span.End()
 	items := make([]*Purchase, 0)
 	rows, err := s.pool.Query(ctx, `
 		SELECT id, manager_id, Manager_id FROM sales 
@@ -200,7 +413,7 @@ func (s *Service) Purchases(ctx context.Context, id int64) ([]*Purchase, error)
 		return items, nil
 	}
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.Purchases", logger.Err(err))
 		return nil, ErrInternal
 	}
 	defer rows.Close()
@@ -209,7 +422,7 @@ func (s *Service) Purchases(ctx context.Context, id int64) ([]*Purchase, error)
 		item := &Purchase{}
 		err = rows.Scan(&item.ID, &item.ManagerID, &item.ManagerID)
 		if err != nil {
-			log.Print(err)
+			logger.FromContext(ctx).Error("managers.Purchases", logger.Err(err))
 			return nil, err
 		}
 		items = append(items, item)
@@ -217,178 +430,456 @@ func (s *Service) Purchases(ctx context.Context, id int64) ([]*Purchase, error)
 
 	err = rows.Err()
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.Purchases", logger.Err(err))
 		return nil, err
 	}
 	return items, nil
 }
 func (s *Service) Products(ctx context.Context) ([]*Product, error) {
+	ctx, span := tracing.Start(ctx, "managers.Products")
+	defer span.End()
 	items := make([]*Product, 0)
 	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, price, qty FROM products 
+		SELECT `+productColumns+` FROM products 
 			WHERE active ORDER BY id LIMIT 500 
 	`)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return items, nil
 	}
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.Products", logger.Err(err))
 		return nil, ErrInternal
 	}
 	defer rows.Close()
 	for rows.Next() {
 		item := &Product{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty)
+		err = scanProduct(rows, item)
 		if err != nil {
-			log.Print(err)
+			logger.FromContext(ctx).Error("managers.Products", logger.Err(err))
 			return nil, err
 		}
 		items = append(items, item)
 	}
 	err = rows.Err()
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.Products", logger.Err(err))
 		return nil, err
 	}
 
 	return items, nil
 }
 func (s *Service) SaveProduct(ctx context.Context, product *Product) (*Product, error) {
-	var err error
+	ctx, span := tracing.Start(ctx, "managers.SaveProduct")
+	defer span.End()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.SaveProduct", logger.Err(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	var before *Product
+	if product.Price.Currency == "" {
+		product.Price.Currency = s.currency
+	}
+	err = checkIdentifiers(ctx, tx, product)
+	if err == nil {
+		err = checkTaxClass(ctx, tx, product.TaxClassID)
+	}
+	if err != nil {
+		return nil, err
+	}
 	if product.ID == 0 {
-		err = s.pool.QueryRow(ctx, `
-			INSERT INTO products(name, qty, price) 
-				VALUES ($1, $2, $3) 
-				RETURNING id, name, qty, price active, created;`, product.Name, product.Qty, product.Price).
-			Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Active, &product.Created)
+		err = scanProduct(tx.QueryRow(ctx, `
+			INSERT INTO products(name, qty, price, sku, barcode, tax_class_id, currency, reorder_threshold) 
+				VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0)) 
+				RETURNING `+productColumns, product.Name, product.Qty, product.Price.Amount, nullString(product.SKU), nullString(product.Barcode), nullID(product.TaxClassID), product.Price.Currency, product.ReorderThreshold),
+			product)
 
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrNoRows
 		}
-	} 
-	if product.ID != 0 {
-		err = s.pool.QueryRow(ctx, `
-			UPDATE products SET name = $1, qty = $2, price = $3  
-				WHERE id = $4 
-				RETURNING id, name, qty, price, active, created`, product.Name, product.Qty, product.Price, product.ID).
-			Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Active, &product.Created)
-
-		if errors.Is(err, pgx.ErrNoRows) {
+	} else {
+		before, err = lockProduct(ctx, tx, product.ID)
+		if err == ErrNotFound {
 			return nil, ErrNoRows
 		}
+		if err != nil {
+			return nil, err
+		}
+		err = scanProduct(tx.QueryRow(ctx, `
+			UPDATE products SET name = $1, qty = $2, price = $3, sku = $5, barcode = $6, tax_class_id = $7, currency = $8, reorder_threshold = NULLIF($9, 0)  
+				WHERE id = $4 
+				RETURNING `+productColumns, product.Name, product.Qty, product.Price.Amount, product.ID, nullString(product.SKU), nullString(product.Barcode), nullID(product.TaxClassID), product.Price.Currency, product.ReorderThreshold),
+			product)
+	}
+	if isUniqueViolation(err) {
+		return nil, ErrProductConflict
+	}
+	if err == nil {
+		err = s.recordProduct(ctx, tx, before, product)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
 	}
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.SaveProduct", logger.Err(err))
 		return nil, ErrInternal
 	}
 	return product, nil
 }
 func (s *Service) ChangeProducts(ctx context.Context, product *Product) (*Product, error) {
+	ctx, span := tracing.Start(ctx, "managers.ChangeProducts")
+	defer span.End()
 	item := &Product{}
 
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var before *Product
+	if product.Price.Currency == "" {
+		product.Price.Currency = s.currency
+	}
+	err = checkIdentifiers(ctx, tx, product)
+	if err == nil {
+		err = checkTaxClass(ctx, tx, product.TaxClassID)
+	}
+	if err != nil {
+		return nil, err
+	}
 	if product.ID == 0 {
-		err := s.pool.QueryRow(ctx, `
-			INSERT INTO products(name, qty, price) 
-				VALUES($1, $2, $3) RETURNING id, name, price, qty
-		`, product.Name, product.Qty, product.Price).Scan(
-			&item.ID, &item.Name, &item.Price, &item.Qty)
+		err := scanProduct(tx.QueryRow(ctx, `
+			INSERT INTO products(name, qty, price, sku, barcode, tax_class_id, currency, reorder_threshold) 
+				VALUES($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0)) RETURNING `+productColumns,
+			product.Name, product.Qty, product.Price.Amount, nullString(product.SKU), nullString(product.Barcode), nullID(product.TaxClassID), product.Price.Currency, product.ReorderThreshold), item)
 
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrNoRows
 		}
+		if isUniqueViolation(err) {
+			return nil, ErrProductConflict
+		}
 		if err != nil {
 			return nil, ErrInternal
 		}
 	}
 
 	if product.ID != 0 {
-		err := s.pool.QueryRow(ctx, `
-			UPDATE products SET name = $2, qty = $3, price = $4 
-				WHERE id = $1 RETURNING id, name, price, qty
-		`, product.ID, product.Name, product.Qty, product.Price).Scan(
-			&item.ID, &item.Name, &item.Price, &item.Qty)
-
-		if errors.Is(err, pgx.ErrNoRows) {
+		before, err = lockProduct(ctx, tx, product.ID)
+		if err == ErrNotFound {
 			return nil, ErrNoRows
 		}
+		if err != nil {
+			return nil, err
+		}
+		err := scanProduct(tx.QueryRow(ctx, `
+			UPDATE products SET name = $2, qty = $3, price = $4, sku = $5, barcode = $6, tax_class_id = $7, currency = $8, reorder_threshold = NULLIF($9, 0) 
+				WHERE id = $1 RETURNING `+productColumns,
+			product.ID, product.Name, product.Qty, product.Price.Amount, nullString(product.SKU), nullString(product.Barcode), nullID(product.TaxClassID), product.Price.Currency, product.ReorderThreshold), item)
+
+		if isUniqueViolation(err) {
+			return nil, ErrProductConflict
+		}
 		if err != nil {
 			return nil, ErrInternal
 		}
 	}
+
+	err = s.recordProduct(ctx, tx, before, item)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
 	return item, nil
 }
 
-func (s *Service) GetSales(ctx context.Context, id int64) (total int, err error) {
-	err = s.pool.QueryRow(ctx, `
-		SELECT COALESE(SUM(sp.qty * sp.price),0) total
-			FROM managers m
-		LEFT JOIN sales s on s.manager_id = $1
-		LEFT JOIN sales_positions sp on sp.sale_id = s.id
-		GROUP BY m.id
-		LIMIT 1`, id).Scan(&total)
+// lockProduct returns product locked until end of the transaction, it is
+// state before the write for audit
+func lockProduct(ctx context.Context, tx pgx.Tx, id int64) (*Product, error) {
+	item := &Product{}
+	err := scanProduct(tx.QueryRow(ctx, `
+		SELECT `+productColumns+` FROM products WHERE id = $1 FOR UPDATE`, id), item)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return item, nil
+}
 
-	if errors.Is(err, pgx.ErrNoRows) {
-		return 0, ErrNoRows
+// recordProduct records creation of the product when before is nil, update
+// otherwise, in audit log and outbox
+func (s *Service) recordProduct(ctx context.Context, tx pgx.Tx, before *Product, after *Product) error {
+	if before == nil {
+		err := audit.Record(ctx, tx, "product.create", "product", after.ID, nil, after)
+		if err != nil {
+			return err
+		}
+		return outbox.Publish(ctx, tx, outbox.EventProductCreated, "product", after.ID, after)
+	}
+	err := audit.Record(ctx, tx, "product.update", "product", after.ID, before, after)
+	if err != nil {
+		return err
 	}
+	err = outbox.Publish(ctx, tx, outbox.EventProductUpdated, "product", after.ID, map[string]interface{}{
+		"before": before,
+		"after":  after,
+	})
 	if err != nil {
-		log.Print(err)
-		return 0, ErrInternal
+		return err
+	}
+	if before.Price != after.Price {
+		err = outbox.Publish(ctx, tx, outbox.EventProductPriceChanged, "product", after.ID, map[string]interface{}{
+			"product_id": after.ID,
+			"name":       after.Name,
+			"old_price":  before.Price,
+			"price":      after.Price,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.publishLowStock(ctx, tx, after.ID, after.Name, after.ReorderThreshold, before.Qty, after.Qty)
+}
+
+// threshold returns low stock threshold of product with the reorder
+// threshold, zero is threshold of the service
+func (s *Service) threshold(reorder int) int {
+	if reorder > 0 {
+		return reorder
+	}
+	return s.lowStock
+}
+
+// fellBelowThreshold tells whether stock crossed low stock threshold
+func (s *Service) fellBelowThreshold(threshold int, before int, after int) bool {
+	return before >= threshold && after < threshold
+}
+
+// publishLowStock publishes product.low_stock when stock falls below threshold
+// of the product, it isn't repeated while stock stays below it
+func (s *Service) publishLowStock(ctx context.Context, tx pgx.Tx, id int64, name string, reorder int, before int, after int) error {
+	threshold := s.threshold(reorder)
+	if !s.fellBelowThreshold(threshold, before, after) {
+		return nil
+	}
+	return outbox.Publish(ctx, tx, outbox.EventProductLowStock, "product", id, map[string]interface{}{
+		"product_id": id,
+		"name":       name,
+		"qty":        after,
+		"threshold":  threshold,
+	})
+}
+
+// GetSales returns total of sales of the manager converted into currency of
+// the service at current exchange rates
+func (s *Service) GetSales(ctx context.Context, id int64) (total *SalesTotal, err error) {
+	ctx, span := tracing.Start(ctx, "managers.GetSales")
+	defer tracing.End(span, &err)
+
+	factors, err := exchange.LoadFactors(ctx, s.pool, s.currency, time.Now())
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	total = &SalesTotal{ManagerID: id, Total: money.New(0, s.currency)}
+	var currencies []string
+	err = s.pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(ROUND(sp.total * f.factor)), 0)::bigint,
+				COALESCE(array_agg(DISTINCT sp.currency) FILTER (WHERE f.factor IS NULL), '{}')
+			FROM sales s
+			JOIN sale_positions sp ON sp.sale_id = s.id
+			LEFT JOIN unnest($2::text[], $3::text[]::numeric[]) AS f(currency, factor) ON f.currency = sp.currency
+			WHERE s.manager_id = $1`, id, factors.Currencies, factors.Values).Scan(&total.Total.Amount, &currencies)
+	if exchange.IsOverflow(err) {
+		return nil, money.ErrOverflow
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = factors.Check(currencies)
+	if err != nil {
+		return nil, err
 	}
 	return total, nil
 }
-func (s *Service) MakeSalePosition(ctx context.Context, position *SalesPosition) bool {
+// MakeSalePosition takes quantity of the position from stock of the product,
+// product row stays locked until the transaction ends. Product of the
+// position given by SKU gets its id, price without currency gets currency
+// of the product. Stock held by reservations is not sold, except quantity
+// reserved for the position itself. Returns ErrOutOfStock when product can
+// not be sold.
+func (s *Service) MakeSalePosition(ctx context.Context, tx pgx.Tx, position *SalesPosition) (err error) {
+	ctx, span := tracing.Start(ctx, "managers.MakeSalePosition")
+	defer tracing.End(span, &err)
 	active := false
 	qty := 0
-	err := s.pool.QueryRow(ctx, `
-		SELECT qty, active FROM products WHERE id = $1`, position.ProductID).
-		Scan(&qty, &active)
+	reorder := 0
+	name := ""
+	currency := ""
+	// rate in effect at start of the transaction, when the sale is created
+	err = tx.QueryRow(ctx, `
+		SELECT p.id, p.name, p.qty, COALESCE(p.reorder_threshold, 0), p.active, p.currency, COALESCE(r.rate, 0) FROM products p
+			LEFT JOIN LATERAL (
+				SELECT rate FROM tax_rates WHERE class_id = p.tax_class_id AND effective <= CURRENT_TIMESTAMP
+					ORDER BY effective DESC LIMIT 1
+			) r ON TRUE
+			WHERE CASE WHEN $1::bigint <> 0 THEN p.id = $1 ELSE p.sku = $2 END
+			FOR UPDATE OF p`, position.ProductID, position.SKU).
+		Scan(&position.ProductID, &name, &qty, &reorder, &active, &currency, &position.TaxRate)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrOutOfStock
+	}
 	if err != nil {
-		return false
+		return ErrInternal.Wrap(err)
 	}
-	if qty < position.Qty || !active {
-		return false
+	held, err := reservations.Held(ctx, tx, position.ProductID)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	if qty-held+position.reserved < position.Qty || !active {
+		return ErrOutOfStock
 	}
+	if position.Price.Currency == "" {
+		position.Price.Currency = currency
+	}
+	if position.Price.Currency != currency {
+		return money.ErrCurrencyMismatch
+	}
+	amount, err := position.Price.Mul(int64(position.Qty))
+	// taxes are computed in int64 with rate multiplied first
+	if err != nil || amount.Amount > math.MaxInt64/(2*taxes.MaxRate) {
+		return money.ErrOverflow
+	}
+	tax, total := taxes.Compute(amount.Amount, position.TaxRate, s.pricesIncludeTax)
+	position.Tax, position.Total = money.New(tax, currency), money.New(total, currency)
 
-	_, err = s.pool.Exec(ctx, `
+	_, err = tx.Exec(ctx, `
 		UPDATE products SET qty = $1 WHERE id = $2`, qty-position.Qty, position.ProductID)
 	if err != nil {
-		log.Print(err)
-		return false
+		return ErrInternal.Wrap(err)
 	}
-
-	return true
+	err = s.publishLowStock(ctx, tx, position.ProductID, name, reorder, qty, qty-position.Qty)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
 }
+// MakeSale stores sale with its positions and takes them from stock in one
+// transaction together with audit entry and sale.created event. Reservations
+// of positions are converted into the sale in the same transaction.
 func (s *Service) MakeSale(ctx context.Context, sale *Sale) (*Sale, error) {
-	sqlQuery := "INSERT INTO sales_positions (sale_id, product_id, qty, price) VALUES "
-	sqlQuery2 := `INSERT INTO sales(manager_id,customer_id) 
-		VALUES ($1,$2) RETURNING id, created;`
+	ctx, span := tracing.Start(ctx, "managers.MakeSale")
+	defer span.End()
+
+	for i, position := range sale.Positions {
+		if position.ProductID == 0 && position.SKU == "" && position.ReservationID == 0 {
+			return nil, validate.ErrFailed.WithDetails(apperr.Detail{
+				Field:   "positions[" + strconv.Itoa(i) + "].product_id",
+				Rule:    "required",
+				Message: "product_id, sku or reservation_id is required",
+			})
+		}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.MakeSale", logger.Err(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
 
-	err := s.pool.QueryRow(ctx, sqlQuery2, sale.ManagerID, sale.CustomerID).Scan(&sale.ID, &sale.Created)
+	// invoice number is taken in the transaction, so sales are numbered without gaps
+	err = tx.QueryRow(ctx, `
+		WITH invoice AS (UPDATE invoice_numbers SET last = last + 1 RETURNING last)
+		INSERT INTO sales(manager_id, customer_id, number) 
+			SELECT $1, $2, last FROM invoice RETURNING id, number, status, created;`, sale.ManagerID, sale.CustomerID).Scan(&sale.ID, &sale.Number, &sale.Status, &sale.Created)
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.MakeSale", logger.Err(err))
 		return nil, ErrInternal
 	}
-	for _, position := range sale.Positions {
-		if !s.MakeSalePosition(ctx, position) {
-			log.Print("Invalid position")
+	for i, position := range sale.Positions {
+		if position.ReservationID != 0 {
+			err = s.claimReservation(ctx, tx, sale, i, position)
+			if err != nil {
+				return nil, err
+			}
+		}
+		product := strconv.FormatInt(position.ProductID, 10)
+		if position.ProductID == 0 {
+			product = position.SKU
+		}
+		err = s.MakeSalePosition(ctx, tx, position)
+		if err == nil {
+			// positions of a sale share currency, so its totals are sums
+			sale.Tax, err = sale.Tax.Add(position.Tax)
+		}
+		if err == nil {
+			sale.Total, err = sale.Total.Add(position.Total)
+		}
+		switch {
+		case err == ErrOutOfStock:
+			return nil, ErrOutOfStock.WithDetails(apperr.Detail{
+				Field:   "positions.product_id",
+				Message: "product " + product + " is not available",
+			})
+		case err == money.ErrCurrencyMismatch:
+			return nil, money.ErrCurrencyMismatch.WithDetails(apperr.Detail{
+				Field:   "positions[" + strconv.Itoa(i) + "].price.currency",
+				Rule:    "currency",
+				Message: "must be currency of product " + product + " and of other positions",
+			})
+		case err == money.ErrOverflow:
+			return nil, money.ErrOverflow.WithDetails(apperr.Detail{
+				Field:   "positions[" + strconv.Itoa(i) + "].qty",
+				Rule:    "max",
+				Message: "amount of the position is too large",
+			})
+		case err != nil:
+			logger.FromContext(ctx).Error("managers.MakeSale", logger.Err(err))
+			return nil, ErrInternal
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO sale_positions(sale_id, product_id, price, currency, qty, tax_rate, tax, total)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+			sale.ID, position.ProductID, position.Price.Amount, position.Price.Currency, position.Qty, position.TaxRate, position.Tax.Amount, position.Total.Amount).Scan(&position.ID)
+		if err == nil && position.ReservationID != 0 {
+			err = reservations.Convert(ctx, tx, position.ReservationID, sale.ID)
+		}
+		if err != nil {
+			logger.FromContext(ctx).Error("managers.MakeSale", logger.Err(err))
 			return nil, ErrInternal
 		}
-		sqlQuery += "(" + strconv.FormatInt(sale.ID, 10) + "," + strconv.FormatInt(position.ProductID, 10) + "," + strconv.Itoa(position.Price) + "," + strconv.Itoa(position.Qty) + "),"
 	}
 
-	sqlQuery = sqlQuery[0 : len(sqlQuery)-1]
-	_, err = s.pool.Exec(ctx, sqlQuery)
+	err = audit.Record(ctx, tx, "sale.create", "sale", sale.ID, nil, sale)
+	if err == nil {
+		err = outbox.Publish(ctx, tx, outbox.EventSaleCreated, "sale", sale.ID, sale)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.MakeSale", logger.Err(err))
 		return nil, ErrInternal
 	}
+
+	salesTotal.Inc()
+	salesRevenue.With(sale.Total.Currency).Add(float64(sale.Total.Amount))
 	return sale, nil
 }
 
 func (s *Service) ManagerRole(ctx context.Context, roles ...string) bool {
+	ctx, span := tracing.Start(ctx, "managers.ManagerRole")
+	defer span.End()
 	id, err := middleware.Authentication(ctx)
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.ManagerRole", logger.Err(err))
 		return false
 	}
 
@@ -409,27 +900,73 @@ func (s *Service) ManagerRole(ctx context.Context, roles ...string) bool {
 }
 // Remove product by id
 func (s *Service) RemoveProductByID(ctx context.Context, id int64) (err error) {
-	_, err = s.pool.Exec(ctx, `DELETE FROM products WHERE id = $1`, id)
+	ctx, span := tracing.Start(ctx, "managers.RemoveProductByID")
+	defer tracing.End(span, &err)
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.RemoveProductByID", logger.Err(err))
+		return ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	before := &Product{}
+	err = scanProduct(tx.QueryRow(ctx, `
+		DELETE FROM products WHERE id = $1 RETURNING `+productColumns, id), before)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err == nil {
+		err = audit.Record(ctx, tx, "product.delete", "product", id, before, nil)
+	}
+	if err == nil {
+		err = outbox.Publish(ctx, tx, outbox.EventProductDeleted, "product", id, before)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.RemoveProductByID", logger.Err(err))
 		return ErrInternal
 	}
 	return nil
 }
 // Remove customer by id
 func (s *Service) RemoveCustomerByID(ctx context.Context, id int64) (err error) {
-	_, err = s.pool.Exec(ctx, `DELETE FROM customers WHERE id = $1`, id)
+	ctx, span := tracing.Start(ctx, "managers.RemoveCustomerByID")
+	defer tracing.End(span, &err)
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.RemoveCustomerByID", logger.Err(err))
+		return ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	before := &customers.Customer{}
+	err = tx.QueryRow(ctx, `
+		DELETE FROM customers WHERE id = $1 RETURNING id, name, phone, active, verified, created`, id).Scan(
+		&before.ID, &before.Name, &before.Phone, &before.Active, &before.Verified, &before.Created)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err == nil {
+		err = audit.Record(ctx, tx, "customer.delete", "customer", id, before, nil)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.RemoveCustomerByID", logger.Err(err))
 		return ErrInternal
 	}
 	return nil
 }
 // Get customers for managers stat
 func (s *Service) GetCustomers(ctx context.Context) ([]*customers.Customer, error) {
+	ctx, span := tracing.Start(ctx, "managers.GetCustomers")
+	defer span.End()
 	items := make([]*customers.Customer, 0)
 	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, phone, active, created 
+		SELECT id, name, phone, active, verified, created 
 			FROM customers WHERE active = true ORDER BY id LIMIT 500`)
 	if err == pgx.ErrNoRows {
 		return items, nil
@@ -441,9 +978,9 @@ func (s *Service) GetCustomers(ctx context.Context) ([]*customers.Customer, erro
 
 	for rows.Next() {
 		item := &customers.Customer{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
 		if err != nil {
-			log.Print(err)
+			logger.FromContext(ctx).Error("managers.GetCustomers", logger.Err(err))
 			return nil, err
 		}
 		items = append(items, item)
@@ -452,18 +989,40 @@ func (s *Service) GetCustomers(ctx context.Context) ([]*customers.Customer, erro
 }
 // Change customer by manager
 func (s *Service) ChangeCustomer(ctx context.Context, item *customers.Customer) (*customers.Customer, error) {
-	err := s.pool.QueryRow(ctx, `
-		UPDATE customers 
-			SET name = $1, phone = $2, active = $3 WHERE id = $4
-			RETURNING name, phone, active`, item.Name, item.Phone, item.Active, item.ID).Scan(
-			&item.Name, &item.Phone, &item.Active)
+	ctx, span := tracing.Start(ctx, "managers.ChangeCustomer")
+	defer span.End()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.ChangeCustomer", logger.Err(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
 
+	before := &customers.Customer{}
+	err = tx.QueryRow(ctx, `
+		SELECT id, name, phone, active, verified, created FROM customers WHERE id = $1 FOR UPDATE`, item.ID).Scan(
+		&before.ID, &before.Name, &before.Phone, &before.Active, &before.Verified, &before.Created)
 	if errors.Is(err, pgx.ErrNoRows) {
-		log.Print("No rows")
-		return nil, ErrNoRows
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("managers.ChangeCustomer", logger.Err(err))
+		return nil, ErrInternal
+	}
+	// new phone has to be verified again
+	err = tx.QueryRow(ctx, `
+		UPDATE customers 
+			SET name = $1, phone = $2, active = $3, verified = verified AND phone = $2 WHERE id = $4
+			RETURNING name, phone, active, verified, created`, item.Name, item.Phone, item.Active, item.ID).Scan(
+			&item.Name, &item.Phone, &item.Active, &item.Verified, &item.Created)
+	if err == nil {
+		err = audit.Record(ctx, tx, "customer.update", "customer", item.ID, before, item)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
 	}
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("managers.ChangeCustomer", logger.Err(err))
 		return nil, ErrInternal
 	}			
 	return item, nil
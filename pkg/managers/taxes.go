@@ -0,0 +1,40 @@
+package managers
+
+import (
+	"context"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrUnknownTaxClass = apperr.New(apperr.KindUnprocessable, "unknown_tax_class", "tax class does not exist")
+
+// SetPricesIncludeTax tells whether prices of products contain tax, it is
+// added to them otherwise. Prices include tax by default.
+func (s *Service) SetPricesIncludeTax(inclusive bool) {
+	s.pricesIncludeTax = inclusive
+}
+
+// checkTaxClass returns ErrUnknownTaxClass unless id is zero or tax class exists
+func checkTaxClass(ctx context.Context, tx pgx.Tx, id int64) error {
+	if id == 0 {
+		return nil
+	}
+	exists := false
+	err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM tax_classes WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	if !exists {
+		return ErrUnknownTaxClass.WithDetails(apperr.Detail{Field: "tax_class_id", Rule: "exists", Message: "tax class does not exist"})
+	}
+	return nil
+}
+
+// nullID returns nil for zero id, so optional references store NULL
+func nullID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,465 @@
+package managers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/password"
+	"github.com/darkside1809/gosql/pkg/totp"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrInvalidTOTP = apperr.New(apperr.KindUnprocessable, "invalid_totp", "authentication code is invalid")
+var ErrTOTPEnabled = apperr.New(apperr.KindConflict, "totp_enabled", "two-factor authentication is already enabled")
+var ErrTOTPNotEnabled = apperr.New(apperr.KindConflict, "totp_not_enabled", "two-factor authentication is not enabled")
+var ErrTOTPNotEnrolled = apperr.New(apperr.KindConflict, "totp_not_enrolled", "two-factor authentication enrollment is not started")
+var ErrTOTPRequired = apperr.New(apperr.KindForbidden, "totp_required", "security policy requires two-factor authentication of administrators")
+var ErrTOTPEnrollmentRequired = apperr.New(apperr.KindForbidden, "totp_enrollment_required", "enroll two-factor authentication to use the token")
+
+// Scopes of manager tokens
+const (
+	ScopeFull = "full"
+	// ScopeEnrollment allows only TOTP enrollment, it is issued to administrators
+	// without two-factor authentication when security policy requires it
+	ScopeEnrollment = "totp_enrollment"
+)
+
+const (
+	// totpIssuer is shown by authenticator apps next to the account
+	totpIssuer = "gosql"
+	// challengeTTL is time between password and code steps of login
+	challengeTTL = 5 * time.Minute
+	// recoveryCodes is number of recovery codes issued at once
+	recoveryCodes = 10
+	// settingRequireAdminTOTP is key of the policy in settings table
+	settingRequireAdminTOTP = "require_admin_totp"
+)
+
+// Login is result of the password step: token, or challenge to send with
+// authentication code when two-factor authentication is enabled
+type Login struct {
+	Token     string `json:"token,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Challenge string `json:"challenge,omitempty"`
+}
+
+// Enrollment is secret of authenticator app, URI is shown as QR code
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodes replace authentication code once each, they are shown only once
+type RecoveryCodes struct {
+	Codes []string `json:"codes"`
+}
+
+// SecurityPolicy is changed by administrators
+type SecurityPolicy struct {
+	RequireAdminTOTP bool `json:"require_admin_totp"`
+}
+
+// TOTPCode confirms enrollment, regeneration of recovery codes and disabling
+type TOTPCode struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+// TOTPVerification is second step of login
+type TOTPVerification struct {
+	Challenge string `json:"challenge" validate:"required"`
+	Code      string `json:"code" validate:"required,max=32"`
+}
+
+// challenge starts second step of login of manager with two-factor authentication
+func (s *Service) challenge(ctx context.Context, id int64) (*Login, error) {
+	code, err := password.NewToken()
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = s.codes.Issue(ctx, password.RealmManager, password.PurposeTOTP, id, code, challengeTTL)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return &Login{Challenge: code}, nil
+}
+
+// VerifyTOTP finishes login started by Token, code is authentication code or
+// recovery code, wrong codes count as failed logins
+func (s *Service) VerifyTOTP(ctx context.Context, challenge string, code string) (login *Login, err error) {
+	ctx, span := tracing.Start(ctx, "managers.VerifyTOTP")
+	defer tracing.End(span, &err)
+
+	id, err := s.codes.FindToken(ctx, password.RealmManager, password.PurposeTOTP, challenge)
+	if err == password.ErrInvalidCode {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	var locked float64
+	err = s.pool.QueryRow(ctx, `
+		SELECT COALESCE(EXTRACT(EPOCH FROM locked_until - CURRENT_TIMESTAMP), 0)
+			FROM managers WHERE id = $1`, id).Scan(&locked)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	if locked > 0 {
+		loginsTotal.With("manager", "locked").Inc()
+		return nil, ErrAccountLocked.WithRetryAfter(time.Duration(locked * float64(time.Second)))
+	}
+
+	err = s.checkCode(ctx, id, code)
+	if err == ErrInvalidTOTP {
+		loginsTotal.With("manager", "failure").Inc()
+		err = s.loginFailed(ctx, id)
+		if err == ErrInvalidPassword {
+			return nil, ErrInvalidTOTP
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.codes.ConsumeToken(ctx, password.RealmManager, password.PurposeTOTP, challenge)
+	if err == password.ErrInvalidCode {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	_, err = s.pool.Exec(ctx, `UPDATE managers SET failed_logins = 0, locked_until = NULL WHERE id = $1`, id)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	token, err := s.newToken(ctx, id, ScopeFull)
+	if err != nil {
+		return nil, err
+	}
+	loginsTotal.With("manager", "success").Inc()
+	return &Login{Token: token, Scope: ScopeFull}, nil
+}
+
+// checkCode accepts authentication code of enabled two-factor authentication
+// or unused recovery code, every code works once
+func (s *Service) checkCode(ctx context.Context, id int64, code string) error {
+	var secret string
+	var enabled bool
+	err := s.pool.QueryRow(ctx, `
+		SELECT COALESCE(totp_secret, ''), totp_enabled FROM managers WHERE id = $1`, id).Scan(&secret, &enabled)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	if !enabled {
+		return ErrTOTPNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != totp.Digits {
+		return s.useRecoveryCode(ctx, id, code)
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTOTP
+	}
+	// code of the same or earlier step was used already, it may be replayed
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE managers SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2`, id, step)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidTOTP
+	}
+	return nil
+}
+
+func (s *Service) useRecoveryCode(ctx context.Context, id int64, code string) error {
+	code = strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE managers_recovery_codes SET used = CURRENT_TIMESTAMP
+			WHERE manager_id = $1 AND code_hash = $2 AND used IS NULL`, id, password.HashCode(code))
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidTOTP
+	}
+	logger.FromContext(ctx).Info("manager used recovery code", logger.F("manager_id", id))
+	return nil
+}
+
+// EnrollTOTP creates secret of the manager, two-factor authentication is
+// enabled after ConfirmTOTP, enrollment may be started again until then
+func (s *Service) EnrollTOTP(ctx context.Context, id int64) (enrollment *Enrollment, err error) {
+	ctx, span := tracing.Start(ctx, "managers.EnrollTOTP")
+	defer tracing.End(span, &err)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	var phone string
+	var enabled bool
+	err = s.pool.QueryRow(ctx, `
+		UPDATE managers SET totp_secret = CASE WHEN totp_enabled THEN totp_secret ELSE $2 END
+			WHERE id = $1 RETURNING phone, totp_enabled`, id, secret).Scan(&phone, &enabled)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	if enabled {
+		return nil, ErrTOTPEnabled
+	}
+	err = audit.Record(ctx, s.pool, "manager.totp_enroll", "manager", id, nil, nil)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return &Enrollment{Secret: secret, URI: totp.URI(totpIssuer, phone, secret)}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication with code of the enrolled
+// secret, it returns recovery codes and gives full scope to enrollment tokens
+func (s *Service) ConfirmTOTP(ctx context.Context, id int64, code string) (codes *RecoveryCodes, err error) {
+	ctx, span := tracing.Start(ctx, "managers.ConfirmTOTP")
+	defer tracing.End(span, &err)
+
+	var secret string
+	var enabled bool
+	err = s.pool.QueryRow(ctx, `
+		SELECT COALESCE(totp_secret, ''), totp_enabled FROM managers WHERE id = $1`, id).Scan(&secret, &enabled)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	if enabled {
+		return nil, ErrTOTPEnabled
+	}
+	if secret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTOTP
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE managers SET totp_enabled = TRUE, totp_last_step = $3
+			WHERE id = $1 AND totp_secret = $2 AND NOT totp_enabled`, id, secret, step)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	if tag.RowsAffected() == 0 {
+		// enrollment was started again or confirmed by another request
+		return nil, ErrInvalidTOTP
+	}
+	_, err = tx.Exec(ctx, `UPDATE managers_tokens SET scope = $2 WHERE manager_id = $1`, id, ScopeFull)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	codes, err = replaceRecoveryCodes(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = audit.Record(ctx, tx, "manager.totp_enable", "manager", id, nil, nil)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces recovery codes after checking code
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, id int64, code string) (codes *RecoveryCodes, err error) {
+	ctx, span := tracing.Start(ctx, "managers.RegenerateRecoveryCodes")
+	defer tracing.End(span, &err)
+
+	err = s.checkCode(ctx, id, code)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	codes, err = replaceRecoveryCodes(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = audit.Record(ctx, tx, "manager.recovery_codes_regenerate", "manager", id, nil, nil)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns off two-factor authentication after checking code,
+// administrators can't disable it when security policy requires it
+func (s *Service) DisableTOTP(ctx context.Context, id int64, code string) (err error) {
+	ctx, span := tracing.Start(ctx, "managers.DisableTOTP")
+	defer tracing.End(span, &err)
+
+	policy, err := s.SecurityPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if policy.RequireAdminTOTP && s.IsAdmin(ctx, id) {
+		return ErrTOTPRequired
+	}
+
+	err = s.checkCode(ctx, id, code)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE managers SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = 0 WHERE id = $1`, id)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM managers_recovery_codes WHERE manager_id = $1`, id)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = audit.Record(ctx, tx, "manager.totp_disable", "manager", id, nil, nil)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
+
+// replaceRecoveryCodes deletes recovery codes of the manager and stores hashes of new ones
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, id int64) (*RecoveryCodes, error) {
+	_, err := tx.Exec(ctx, `DELETE FROM managers_recovery_codes WHERE manager_id = $1`, id)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	codes := &RecoveryCodes{Codes: make([]string, 0, recoveryCodes)}
+	buffer := make([]byte, 5)
+	for i := 0; i < recoveryCodes; i++ {
+		_, err = rand.Read(buffer)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		code := hex.EncodeToString(buffer)
+		_, err = tx.Exec(ctx, `
+			INSERT INTO managers_recovery_codes(manager_id, code_hash) VALUES($1, $2)`, id, password.HashCode(code))
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		codes.Codes = append(codes.Codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// tokenScope returns scope of new token of the manager according to security policy
+func (s *Service) tokenScope(ctx context.Context, id int64) (string, error) {
+	policy, err := s.SecurityPolicy(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !policy.RequireAdminTOTP {
+		return ScopeFull, nil
+	}
+	var admin, enabled bool
+	err = s.pool.QueryRow(ctx, `SELECT is_admin, totp_enabled FROM managers WHERE id = $1`, id).Scan(&admin, &enabled)
+	if err != nil {
+		return "", ErrInternal.Wrap(err)
+	}
+	if admin && !enabled {
+		return ScopeEnrollment, nil
+	}
+	return ScopeFull, nil
+}
+
+// SecurityPolicy returns current security policy
+func (s *Service) SecurityPolicy(ctx context.Context) (*SecurityPolicy, error) {
+	var value string
+	err := s.pool.QueryRow(ctx, `SELECT value FROM settings WHERE key = $1`, settingRequireAdminTOTP).Scan(&value)
+	if err == pgx.ErrNoRows {
+		return &SecurityPolicy{}, nil
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	required, _ := strconv.ParseBool(value)
+	return &SecurityPolicy{RequireAdminTOTP: required}, nil
+}
+
+// SetSecurityPolicy changes security policy, administrators without two-factor
+// authentication get enrollment tokens on next login
+func (s *Service) SetSecurityPolicy(ctx context.Context, policy *SecurityPolicy) (err error) {
+	ctx, span := tracing.Start(ctx, "managers.SetSecurityPolicy")
+	defer tracing.End(span, &err)
+
+	before, err := s.SecurityPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO settings(key, value) VALUES($1, $2)
+			ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated = CURRENT_TIMESTAMP`,
+		settingRequireAdminTOTP, strconv.FormatBool(policy.RequireAdminTOTP))
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = audit.Record(ctx, tx, "settings.update", "security_policy", 0, before, policy)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are latency buckets in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry keeps metrics and writes them in Prometheus text format
+type Registry struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type metric interface {
+	write(w io.Writer, name string)
+	kind() string
+}
+
+type entry struct {
+	help   string
+	metric metric
+}
+
+// NewRegistry creates empty registry
+func NewRegistry() *Registry {
+	return &Registry{entries: map[string]*entry{}}
+}
+
+// Default is the registry used by services and served at /metrics
+var Default = NewRegistry()
+
+// register returns metric already registered under the name or stores the new one
+func (r *Registry) register(name string, help string, m metric) metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.entries[name]; ok {
+		if existing.metric.kind() != m.kind() {
+			panic("metrics: " + name + " registered as " + existing.metric.kind())
+		}
+		return existing.metric
+	}
+	r.entries[name] = &entry{help: help, metric: m}
+	return m
+}
+
+// CounterVec returns counter with labels, same name returns the same counter
+func (r *Registry) CounterVec(name string, help string, labels ...string) *CounterVec {
+	return r.register(name, help, &CounterVec{labels: labels, values: map[string]*Counter{}}).(*CounterVec)
+}
+
+// Counter returns counter without labels
+func (r *Registry) Counter(name string, help string) *Counter {
+	return r.CounterVec(name, help).With()
+}
+
+// HistogramVec returns histogram with labels
+func (r *Registry) HistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	return r.register(name, help, &HistogramVec{labels: labels, buckets: buckets, values: map[string]*Histogram{}}).(*HistogramVec)
+}
+
+// GaugeFunc registers gauge whose value is read on every scrape
+func (r *Registry) GaugeFunc(name string, help string, fn func() float64) {
+	r.register(name, help, &funcMetric{typ: "gauge", fn: fn})
+}
+
+// CounterFunc registers counter whose value is read on every scrape
+func (r *Registry) CounterFunc(name string, help string, fn func() float64) {
+	r.register(name, help, &funcMetric{typ: "counter", fn: fn})
+}
+
+// WriteTo writes all metrics sorted by name
+func (r *Registry) WriteTo(out io.Writer) (int64, error) {
+	r.mu.Lock()
+	entries := make(map[string]*entry, len(r.entries))
+	names := make([]string, 0, len(r.entries))
+	for name, e := range r.entries {
+		entries[name] = e
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	counter := &countingWriter{w: out}
+	w := bufio.NewWriter(counter)
+	for _, name := range names {
+		e := entries[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, e.help, name, e.metric.kind())
+		e.metric.write(w, name)
+	}
+	err := w.Flush()
+	return counter.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases counter, negative values are ignored
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.value += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) get() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// CounterVec is a family of counters split by label values
+type CounterVec struct {
+	mu     sync.Mutex
+	labels []string
+	values map[string]*Counter
+}
+
+// With returns counter of label values given in the order of label names
+func (v *CounterVec) With(values ...string) *Counter {
+	key := labelKey(v.labels, values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.values[key]
+	if !ok {
+		c = &Counter{}
+		v.values[key] = c
+	}
+	return c
+}
+
+func (v *CounterVec) kind() string {
+	return "counter"
+}
+
+func (v *CounterVec) write(w io.Writer, name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range sortedKeys(v.values) {
+		fmt.Fprintf(w, "%s%s %s\n", name, key, format(v.values[key].get()))
+	}
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// ObserveDuration observes time passed since start in seconds
+func (h *Histogram) ObserveDuration(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// HistogramVec is a family of histograms split by label values
+type HistogramVec struct {
+	mu      sync.Mutex
+	labels  []string
+	buckets []float64
+	values  map[string]*Histogram
+}
+
+// With returns histogram of label values given in the order of label names
+func (v *HistogramVec) With(values ...string) *Histogram {
+	key := labelKey(v.labels, values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.values[key]
+	if !ok {
+		h = &Histogram{buckets: v.buckets, counts: make([]uint64, len(v.buckets))}
+		v.values[key] = h
+	}
+	return h
+}
+
+func (v *HistogramVec) kind() string {
+	return "histogram"
+}
+
+func (v *HistogramVec) write(w io.Writer, name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range sortedKeys(v.values) {
+		h := v.values[key]
+		h.mu.Lock()
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(key, "le", format(bound)), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(key, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, key, format(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, key, h.count)
+		h.mu.Unlock()
+	}
+}
+
+type funcMetric struct {
+	typ string
+	fn  func() float64
+}
+
+func (f *funcMetric) kind() string {
+	return f.typ
+}
+
+func (f *funcMetric) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, format(f.fn()))
+}
+
+func labelKey(names []string, values []string) string {
+	if len(names) != len(values) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(names), len(values)))
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func withLabel(key string, name string, value string) string {
+	pair := name + "=" + strconv.Quote(value)
+	if key == "" {
+		return "{" + pair + "}"
+	}
+	return key[:len(key)-1] + "," + pair + "}"
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := make([]string, 0)
+	switch values := m.(type) {
+	case map[string]*Counter:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	case map[string]*Histogram:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func format(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
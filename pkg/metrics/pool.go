@@ -0,0 +1,28 @@
+package metrics
+
+import "github.com/jackc/pgx/v4/pgxpool"
+
+// RegisterPool exposes statistics of the database pool
+func RegisterPool(r *Registry, pool *pgxpool.Pool) {
+	r.GaugeFunc("gosql_db_pool_acquired_connections", "Connections currently in use.", func() float64 {
+		return float64(pool.Stat().AcquiredConns())
+	})
+	r.GaugeFunc("gosql_db_pool_idle_connections", "Idle connections in the pool.", func() float64 {
+		return float64(pool.Stat().IdleConns())
+	})
+	r.GaugeFunc("gosql_db_pool_total_connections", "All connections in the pool.", func() float64 {
+		return float64(pool.Stat().TotalConns())
+	})
+	r.GaugeFunc("gosql_db_pool_max_connections", "Maximum size of the pool.", func() float64 {
+		return float64(pool.Stat().MaxConns())
+	})
+	r.CounterFunc("gosql_db_pool_acquires_total", "Successful acquires from the pool.", func() float64 {
+		return float64(pool.Stat().AcquireCount())
+	})
+	r.CounterFunc("gosql_db_pool_empty_acquires_total", "Acquires which waited because the pool was empty.", func() float64 {
+		return float64(pool.Stat().EmptyAcquireCount())
+	})
+	r.CounterFunc("gosql_db_pool_acquire_wait_seconds_total", "Total time spent acquiring connections.", func() float64 {
+		return pool.Stat().AcquireDuration().Seconds()
+	})
+}
@@ -0,0 +1,121 @@
+// Package money keeps amounts as integer minor units together with ISO 4217
+// currency code, so amounts are never rounded by floats and amounts of
+// different currencies are never added up.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+)
+
+var ErrOverflow = apperr.New(apperr.KindUnprocessable, "amount_overflow", "amount is too large")
+var ErrCurrencyMismatch = apperr.New(apperr.KindUnprocessable, "currency_mismatch", "amounts are in different currencies")
+
+// DefaultCurrency is currency of prices without one, Tajik somoni
+const DefaultCurrency = "TJS"
+
+// Money is amount in minor units of the currency, e.g. 1050 USD is $10.50
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency" validate:"currency"`
+}
+
+// New returns amount of the currency
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Minor returns amount in minor units, min and max rules of validate use it
+func (m Money) Minor() int64 {
+	return m.Amount
+}
+
+// Add returns sum of amounts of the same currency. Zero amount without
+// currency takes currency of the other one, so sums start from Money{}.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency == "" && m.Amount == 0 {
+		m.Currency = other.Currency
+	}
+	if other.Currency != m.Currency && !(other.Currency == "" && other.Amount == 0) {
+		return Money{}, ErrCurrencyMismatch
+	}
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, ErrOverflow
+	}
+	m.Amount += other.Amount
+	return m, nil
+}
+
+// Mul returns amount multiplied by n, e.g. price by quantity
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Currency: m.Currency}, nil
+	}
+	product := m.Amount * n
+	if product/n != m.Amount || (m.Amount == -1 && n == math.MinInt64) || (n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// String returns amount as decimal of the currency, e.g. 10.50 USD
+func (m Money) String() string {
+	return strings.TrimSpace(Format(m.Amount, m.Currency) + " " + m.Currency)
+}
+
+// UnmarshalJSON reads object with amount and currency. Plain number is
+// read as amount without currency, as prices were sent before currencies.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) != 0 && data[0] != '{' && !bytes.Equal(data, []byte("null")) {
+		*m = Money{}
+		return json.Unmarshal(data, &m.Amount)
+	}
+	type plain Money
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+// Code returns currency code in upper case without spaces
+func Code(currency string) string {
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
+
+// digits of minor units of currencies which have other than two
+var digits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Digits returns number of decimal digits of minor units of the currency
+func Digits(currency string) int {
+	if n, ok := digits[currency]; ok {
+		return n
+	}
+	return 2
+}
+
+// Format returns minor units as decimal of the currency, e.g. 1050 USD is 10.50
+func Format(amount int64, currency string) string {
+	n := Digits(currency)
+	sign := ""
+	// negate in uint64, so the smallest int64 is formatted too
+	abs := uint64(amount)
+	if amount < 0 {
+		sign, abs = "-", -abs
+	}
+	text := strconv.FormatUint(abs, 10)
+	if n == 0 {
+		return sign + text
+	}
+	if len(text) <= n {
+		text = strings.Repeat("0", n-len(text)+1) + text
+	}
+	return sign + text[:len(text)-n] + "." + text[len(text)-n:]
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/logger"
+)
+
+// Message is sent to a customer or a manager, To is a phone number
+type Message struct {
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Created time.Time `json:"created"`
+}
+
+// Notifier delivers messages, production deployments plug in SMS or mail
+// gateways, log and file notifiers are for local use
+type Notifier interface {
+	Notify(ctx context.Context, message *Message) error
+}
+
+// LogNotifier writes messages to the log of the request
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, message *Message) error {
+	logger.FromContext(ctx).Info("notification",
+		logger.F("to", message.To),
+		logger.F("subject", message.Subject),
+		logger.F("body", message.Body),
+	)
+	return nil
+}
+
+// FileNotifier appends messages to file as JSON lines
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier creates notifier writing to file at path
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Notify(ctx context.Context, message *Message) error {
+	if message.Created.IsZero() {
+		message.Created = time.Now()
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	file, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,379 @@
+package openapi
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/validate"
+)
+
+// Document is the root of OpenAPI 3 specification
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem keeps operations of a single path by lower case method
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Route describes one registered route, Request and Response are sample values
+// of Go types whose schemas are generated by reflection
+type Route struct {
+	Method     string
+	Path       string
+	Summary    string
+	Tag        string
+	Security   string
+	Deprecated bool
+	Query      []*Parameter
+	Request    interface{}
+	Response   interface{}
+	Status     int
+	// ContentType of the response, application/json by default
+	ContentType string
+	// RequestContentTypes of the body, application/json by default
+	RequestContentTypes []string
+}
+
+// Builder collects routes and schemas of the document
+type Builder struct {
+	doc       *Document
+	errorType interface{}
+}
+
+// NewBuilder creates builder, errorType is a sample of error envelope added to every operation
+func NewBuilder(title string, version string, errorType interface{}) *Builder {
+	return &Builder{
+		doc: &Document{
+			OpenAPI: "3.0.3",
+			Info:    Info{Title: title, Version: version},
+			Paths:   map[string]*PathItem{},
+			Components: Components{
+				Schemas:         map[string]*Schema{},
+				SecuritySchemes: map[string]*SecurityScheme{},
+			},
+		},
+		errorType: errorType,
+	}
+}
+
+// SecurityScheme registers API key passed in header
+func (b *Builder) SecurityScheme(name string, header string, description string) {
+	b.doc.Components.SecuritySchemes[name] = &SecurityScheme{Type: "apiKey", In: "header", Name: header, Description: description}
+}
+
+// Add puts route into the document
+func (b *Builder) Add(route Route) {
+	path := Path(route.Path)
+	item, ok := b.doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		b.doc.Paths[path] = item
+	}
+
+	op := &Operation{
+		Summary:    route.Summary,
+		Deprecated: route.Deprecated,
+		Parameters: append(pathParameters(path), route.Query...),
+		Responses:  map[string]*Response{},
+	}
+	if route.Tag != "" {
+		op.Tags = []string{route.Tag}
+	}
+	if route.Security != "" {
+		op.Security = []map[string][]string{{route.Security: {}}}
+	}
+	if route.Request != nil {
+		contentTypes := route.RequestContentTypes
+		if len(contentTypes) == 0 {
+			contentTypes = []string{"application/json"}
+		}
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{}}
+		for _, contentType := range contentTypes {
+			op.RequestBody.Content[contentType] = &MediaType{Schema: b.SchemaOf(route.Request)}
+		}
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = 200
+	}
+	response := &Response{Description: "OK"}
+	if route.Response != nil {
+		contentType := route.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		response.Content = map[string]*MediaType{contentType: {Schema: b.SchemaOf(route.Response)}}
+	}
+	op.Responses[strconv.Itoa(status)] = response
+	if b.errorType != nil {
+		op.Responses["default"] = &Response{
+			Description: "Error",
+			Content:     map[string]*MediaType{"application/json": {Schema: b.SchemaOf(b.errorType)}},
+		}
+	}
+
+	(*item)[strings.ToLower(route.Method)] = op
+}
+
+// Has reports whether the document describes method of the path
+func (b *Builder) Has(method string, path string) bool {
+	item, ok := b.doc.Paths[Path(path)]
+	if !ok {
+		return false
+	}
+	_, ok = (*item)[strings.ToLower(method)]
+	return ok
+}
+
+// Document returns built specification
+func (b *Builder) Document() *Document {
+	return b.doc
+}
+
+var muxVariable = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// Path converts gorilla/mux template to OpenAPI path, dropping variable patterns
+func Path(template string) string {
+	return muxVariable.ReplaceAllString(template, "{$1}")
+}
+
+func pathParameters(path string) []*Parameter {
+	params := make([]*Parameter, 0)
+	for _, match := range muxVariable.FindAllStringSubmatch(path, -1) {
+		schema := &Schema{Type: "string"}
+		if match[1] == "id" || strings.HasSuffix(match[1], "ID") {
+			schema = &Schema{Type: "integer", Format: "int64"}
+		}
+		params = append(params, &Parameter{Name: match[1], In: "path", Required: true, Schema: schema})
+	}
+	return params
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf returns schema of the sample value, named structs are put
+// into components and referenced
+func (b *Builder) SchemaOf(v interface{}) *Schema {
+	if s, ok := v.(*Schema); ok {
+		return s
+	}
+	return b.schema(reflect.TypeOf(v))
+}
+
+func (b *Builder) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() == reflect.String:
+		return &Schema{Type: "string"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 || t.Kind() == reflect.Int {
+			return &Schema{Type: "integer", Format: "int64"}
+		}
+		return &Schema{Type: "integer", Format: "int32"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		name := schemaName(t)
+		if _, ok := b.doc.Components.Schemas[name]; !ok {
+			// placeholder stops recursion on self referencing types
+			b.doc.Components.Schemas[name] = &Schema{}
+			*b.doc.Components.Schemas[name] = *b.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+func schemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	if pkg == "" {
+		return t.Name()
+	}
+	return pkg + "." + t.Name()
+}
+
+func (b *Builder) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		prop := b.schema(field.Type)
+		if constrain(prop, field.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// constrain copies validate rules into schema and reports whether field is required
+func constrain(s *Schema, tag string) (required bool) {
+	if tag == "" || s.Ref != "" {
+		return tag != "" && strings.Contains(","+tag+",", ",required,")
+	}
+	for _, part := range strings.Split(tag, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		arg := ""
+		if len(kv) == 2 {
+			arg = kv[1]
+		}
+		switch kv[0] {
+		case "required":
+			required = true
+			if s.Type == "string" && s.MinLength == nil {
+				s.MinLength = intPtr(1)
+			}
+			if s.Type == "array" && s.MinItems == nil {
+				s.MinItems = intPtr(1)
+			}
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			switch s.Type {
+			case "string":
+				if kv[0] == "min" {
+					s.MinLength = intPtr(int(n))
+				} else {
+					s.MaxLength = intPtr(int(n))
+				}
+			case "array":
+				if kv[0] == "min" {
+					s.MinItems = intPtr(int(n))
+				} else {
+					s.MaxItems = intPtr(int(n))
+				}
+			default:
+				if kv[0] == "min" {
+					s.Minimum = &n
+				} else {
+					s.Maximum = &n
+				}
+			}
+		case "phone":
+			s.Pattern = validate.E164.String()
+		case "oneof":
+			s.Enum = strings.Fields(arg)
+		case "url":
+			s.Format = "uri"
+		case "sku":
+			s.Pattern = validate.SKU.String()
+		case "barcode":
+			s.Pattern = validate.Barcode.String()
+		case "currency":
+			s.Pattern = validate.Currency.String()
+		}
+	}
+	return required
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,287 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/metrics"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Headers of webhook requests
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+var deliveriesTotal = metrics.Default.CounterVec("gosql_webhook_deliveries_total", "Webhook delivery attempts by result.", "result")
+
+// DispatcherConfig tunes delivery of events
+type DispatcherConfig struct {
+	// Interval between polls of the outbox
+	Interval time.Duration
+	// Batch is number of events and deliveries taken by one poll
+	Batch int
+	// Concurrency is number of requests sent at once
+	Concurrency int
+	// Timeout of a webhook request
+	Timeout time.Duration
+	// MaxAttempts after which delivery is dead
+	MaxAttempts int
+	// BaseBackoff is delay after first failure, it doubles on every next one up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// DefaultDispatcherConfig retries for about a day before delivery is dead
+var DefaultDispatcherConfig = DispatcherConfig{
+	Interval:    2 * time.Second,
+	Batch:       50,
+	Concurrency: 4,
+	Timeout:     10 * time.Second,
+	MaxAttempts: 12,
+	BaseBackoff: 10 * time.Second,
+	MaxBackoff:  6 * time.Hour,
+}
+
+// Backoff returns delay before next attempt after failures in a row, half of
+// the delay is random, so endpoints coming back are not hit by every delivery at once
+func (c DispatcherConfig) Backoff(failures int) time.Duration {
+	d := c.BaseBackoff
+	for i := 1; i < failures && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Sign returns signature of the body sent at the time, receivers compute
+// it with their secret and compare, header value is "t=<unix>,v1=<hex>"
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher fans events out to subscriptions and delivers them,
+// several instances may run at once, rows are claimed with SKIP LOCKED
+type Dispatcher struct {
+	pool   *pgxpool.Pool
+	client *http.Client
+	config DispatcherConfig
+}
+
+func NewDispatcher(pool *pgxpool.Pool, config DispatcherConfig) *Dispatcher {
+	return &Dispatcher{pool: pool, client: &http.Client{Timeout: config.Timeout}, config: config}
+}
+
+// Run polls the outbox until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		err := d.Poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Default().Error("outbox.Dispatcher", logger.Err(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fans out new events and sends due deliveries once
+func (d *Dispatcher) Poll(ctx context.Context) error {
+	err := d.fanOut(ctx)
+	if err != nil {
+		return err
+	}
+	deliveries, err := d.claim(ctx)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, d.config.Concurrency)
+	for _, item := range deliveries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item *claimed) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d.deliver(ctx, item)
+		}(item)
+	}
+	wg.Wait()
+	return nil
+}
+
+// fanOut creates deliveries of new events for matching active subscriptions
+func (d *Dispatcher) fanOut(ctx context.Context) error {
+	_, err := d.pool.Exec(ctx, `
+		WITH events AS (
+			SELECT id, type FROM outbox_events
+				WHERE dispatched IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+		), deliveries AS (
+			INSERT INTO webhook_deliveries(event_id, subscription_id)
+				SELECT e.id, s.id FROM events e
+					JOIN webhook_subscriptions s ON s.active
+						AND (cardinality(s.event_types) = 0 OR e.type = ANY(s.event_types))
+				ON CONFLICT (event_id, subscription_id) DO NOTHING
+		)
+		UPDATE outbox_events SET dispatched = CURRENT_TIMESTAMP WHERE id IN (SELECT id FROM events)`, d.config.Batch)
+	return err
+}
+
+type claimed struct {
+	id       int64
+	attempts int
+	url      string
+	secret   string
+	event    *Event
+}
+
+// claim takes due deliveries and moves their next attempt past the request
+// timeout, so other dispatchers skip them while they are sent
+func (d *Dispatcher) claim(ctx context.Context) ([]*claimed, error) {
+	lease := d.config.Timeout + d.config.Interval
+	rows, err := d.pool.Query(ctx, `
+		UPDATE webhook_deliveries dl
+			SET attempts = dl.attempts + 1, next_attempt = CURRENT_TIMESTAMP + make_interval(secs => $2)
+			FROM outbox_events e, webhook_subscriptions s
+			WHERE dl.id IN (
+				SELECT id FROM webhook_deliveries
+					WHERE status = 'pending' AND next_attempt <= CURRENT_TIMESTAMP
+					ORDER BY next_attempt LIMIT $1 FOR UPDATE SKIP LOCKED
+			) AND e.id = dl.event_id AND s.id = dl.subscription_id
+			RETURNING dl.id, dl.attempts, s.url, s.secret,
+				e.id, e.type, e.aggregate, e.aggregate_id, e.payload, COALESCE(e.request_id, ''), e.created`,
+		d.config.Batch, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*claimed, 0)
+	for rows.Next() {
+		item := &claimed{event: &Event{}}
+		var payload []byte
+		err = rows.Scan(&item.id, &item.attempts, &item.url, &item.secret,
+			&item.event.ID, &item.event.Type, &item.event.Aggregate, &item.event.AggregateID, &payload,
+			&item.event.RequestID, &item.event.Created)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(payload, &item.event.Payload)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// deliver sends the delivery and stores result
+func (d *Dispatcher) deliver(ctx context.Context, item *claimed) {
+	ctx, span := tracing.Start(ctx, "outbox.deliver", tracing.WithKind(tracing.KindClient), tracing.WithAttributes(map[string]interface{}{
+		"webhook.delivery_id": item.id,
+		"webhook.event_type":  item.event.Type,
+		"webhook.attempt":     item.attempts,
+	}))
+	defer span.End()
+
+	status, err := d.send(ctx, item)
+	log := logger.Default().With(logger.F("delivery_id", item.id), logger.F("event_id", item.event.ID), logger.F("attempt", item.attempts))
+	if err == nil {
+		deliveriesTotal.With("delivered").Inc()
+		_, err = d.pool.Exec(ctx, `
+			UPDATE webhook_deliveries SET status = 'delivered', delivered = CURRENT_TIMESTAMP,
+					last_status = $2, last_error = NULL
+				WHERE id = $1`, item.id, status)
+		if err != nil {
+			log.Error("outbox.deliver", logger.Err(err))
+		}
+		return
+	}
+	span.RecordError(err)
+
+	var lastStatus interface{}
+	if status != 0 {
+		lastStatus = status
+	}
+	if item.attempts >= d.config.MaxAttempts {
+		deliveriesTotal.With("dead").Inc()
+		log.Warn("webhook delivery is dead", logger.Err(err))
+		_, err = d.pool.Exec(ctx, `
+			UPDATE webhook_deliveries SET status = 'dead', last_status = $2, last_error = $3 WHERE id = $1`,
+			item.id, lastStatus, err.Error())
+	} else {
+		deliveriesTotal.With("failed").Inc()
+		log.Info("webhook delivery failed", logger.Err(err))
+		_, err = d.pool.Exec(ctx, `
+			UPDATE webhook_deliveries
+				SET next_attempt = CURRENT_TIMESTAMP + make_interval(secs => $4), last_status = $2, last_error = $3
+				WHERE id = $1`,
+			item.id, lastStatus, err.Error(), d.config.Backoff(item.attempts).Seconds())
+	}
+	if err != nil {
+		log.Error("outbox.deliver", logger.Err(err))
+	}
+}
+
+// maxErrorBody limits part of failed response kept in last_error
+const maxErrorBody = 512
+
+// send posts event to the endpoint, responses other than 2xx are errors
+func (d *Dispatcher) send(ctx context.Context, item *claimed) (int, error) {
+	body, err := json.Marshal(item.event)
+	if err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, item.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "gosql-webhooks")
+	request.Header.Set(EventHeader, item.event.Type)
+	request.Header.Set(DeliveryHeader, strconv.FormatInt(item.id, 10))
+	request.Header.Set(SignatureHeader, Sign(item.secret, time.Now(), body))
+	tracing.Inject(ctx, request.Header)
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	excerpt, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, errors.New(response.Status + ": " + string(excerpt))
+	}
+	return response.StatusCode, nil
+}
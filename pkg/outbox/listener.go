@@ -0,0 +1,202 @@
+package outbox
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/metrics"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// NotifyChannel is channel the trigger of outbox_events notifies with id of committed event
+const NotifyChannel = "outbox_events"
+
+// subscriberBuffer is number of events waiting for slow subscriber,
+// subscriber is dropped when it is full and resumes by id of the last event
+const subscriberBuffer = 64
+
+// Listener receives notifications of committed events over one connection
+// of the pool and broadcasts them to subscribers of this process
+type Listener struct {
+	pool *pgxpool.Pool
+
+	mu          sync.Mutex
+	subscribers map[*Subscriber]struct{}
+	lastID      int64
+}
+
+// Subscriber receives events of the types until C is closed, it is closed
+// by Close or when subscriber falls behind
+type Subscriber struct {
+	C <-chan *Event
+
+	events   chan *Event
+	types    map[string]bool
+	listener *Listener
+	closed   bool
+}
+
+func NewListener(pool *pgxpool.Pool) *Listener {
+	listener := &Listener{pool: pool, subscribers: map[*Subscriber]struct{}{}}
+	metrics.Default.GaugeFunc("gosql_event_stream_subscribers", "Subscribers of live events.", func() float64 {
+		listener.mu.Lock()
+		defer listener.mu.Unlock()
+		return float64(len(listener.subscribers))
+	})
+	return listener
+}
+
+// Subscribe starts receiving events of the types
+func (l *Listener) Subscribe(types []string) *Subscriber {
+	events := make(chan *Event, subscriberBuffer)
+	subscriber := &Subscriber{C: events, events: events, types: map[string]bool{}, listener: l}
+	for _, eventType := range types {
+		subscriber.types[eventType] = true
+	}
+	l.mu.Lock()
+	l.subscribers[subscriber] = struct{}{}
+	l.mu.Unlock()
+	return subscriber
+}
+
+// Close stops receiving events
+func (s *Subscriber) Close() {
+	s.listener.mu.Lock()
+	defer s.listener.mu.Unlock()
+	s.listener.drop(s)
+}
+
+// drop removes subscriber, mu is held by caller
+func (l *Listener) drop(s *Subscriber) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(l.subscribers, s)
+	close(s.events)
+}
+
+// Run listens until ctx is done, connection is restored after failures
+// and events committed meanwhile are loaded by id
+func (l *Listener) Run(ctx context.Context) {
+	delay := time.Second
+	for {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Default().Error("outbox.Listener", logger.Err(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay < 30*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// LISTEN stays on the session, connection is not returned to the pool
+		conn.Conn().Close(context.Background())
+		conn.Release()
+	}()
+
+	_, err = conn.Exec(ctx, "LISTEN "+NotifyChannel)
+	if err != nil {
+		return err
+	}
+	err = l.catchUp(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		id, err := strconv.ParseInt(notification.Payload, 10, 64)
+		if err != nil {
+			continue
+		}
+		if !l.hasSubscribers() {
+			l.seen(id)
+			continue
+		}
+		items, err := queryEvents(ctx, l.pool, `
+			SELECT id, type, aggregate, aggregate_id, payload, COALESCE(request_id, ''), created
+				FROM outbox_events WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		l.broadcast(items)
+	}
+}
+
+// catchUp broadcasts events committed while there was no connection
+func (l *Listener) catchUp(ctx context.Context) error {
+	l.mu.Lock()
+	lastID := l.lastID
+	l.mu.Unlock()
+	if lastID == 0 {
+		err := l.pool.QueryRow(ctx, `SELECT COALESCE(MAX(id), 0) FROM outbox_events`).Scan(&lastID)
+		if err != nil {
+			return err
+		}
+		l.seen(lastID)
+		return nil
+	}
+	items, err := queryEvents(ctx, l.pool, `
+		SELECT id, type, aggregate, aggregate_id, payload, COALESCE(request_id, ''), created
+			FROM outbox_events WHERE id > $1 ORDER BY id LIMIT 1000`, lastID)
+	if err != nil {
+		return err
+	}
+	l.broadcast(items)
+	return nil
+}
+
+func (l *Listener) hasSubscribers() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.subscribers) != 0
+}
+
+func (l *Listener) seen(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if id > l.lastID {
+		l.lastID = id
+	}
+}
+
+// broadcast sends events to subscribers of their types, subscribers
+// which can't take them are dropped instead of blocking the others
+func (l *Listener) broadcast(items []*Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, item := range items {
+		if item.ID > l.lastID {
+			l.lastID = item.ID
+		}
+		for subscriber := range l.subscribers {
+			if !subscriber.types[item.Type] {
+				continue
+			}
+			select {
+			case subscriber.events <- item:
+			default:
+				l.drop(subscriber)
+			}
+		}
+	}
+}
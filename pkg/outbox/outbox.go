@@ -0,0 +1,112 @@
+// Package outbox keeps domain events written in the transaction of the change
+// and delivers them to webhook subscriptions. Events are never lost when the
+// transaction commits and never sent when it rolls back.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/jackc/pgx/v4"
+)
+
+// Types of events
+const (
+	EventSaleCreated        = "sale.created"
+	EventCustomerRegistered = "customer.registered"
+	EventCustomerBlocked    = "customer.blocked"
+	EventCustomerUnblocked  = "customer.unblocked"
+	EventProductCreated     = "product.created"
+	EventProductUpdated     = "product.updated"
+	EventProductDeleted     = "product.deleted"
+	// EventProductPriceChanged follows product.updated when price differs
+	EventProductPriceChanged = "product.price_changed"
+	// EventProductLowStock is published when stock falls below threshold
+	EventProductLowStock = "product.low_stock"
+	// EventSalePaid is published when captured payments cover total of a sale
+	EventSalePaid = "sale.paid"
+	// EventSaleRefunded is published when every payment of a sale is refunded
+	EventSaleRefunded = "sale.refunded"
+)
+
+// EventTypes lists every type subscriptions may filter by
+var EventTypes = []string{
+	EventSaleCreated,
+	EventCustomerRegistered,
+	EventCustomerBlocked,
+	EventCustomerUnblocked,
+	EventProductCreated,
+	EventProductUpdated,
+	EventProductDeleted,
+	EventProductPriceChanged,
+	EventProductLowStock,
+	EventSalePaid,
+	EventSaleRefunded,
+}
+
+// Event is body of webhook request
+type Event struct {
+	ID          int64                  `json:"id"`
+	Type        string                 `json:"type"`
+	Aggregate   string                 `json:"aggregate"`
+	AggregateID int64                  `json:"aggregate_id"`
+	Payload     map[string]interface{} `json:"payload"`
+	RequestID   string                 `json:"request_id,omitempty"`
+	Created     time.Time              `json:"created"`
+}
+
+// Querier is transaction of the change
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Publish writes event about the aggregate, payload is marshalled to JSON
+func Publish(ctx context.Context, q Querier, eventType string, aggregate string, aggregateID int64, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var requestID interface{}
+	if id := logger.RequestID(ctx); id != "" {
+		requestID = id
+	}
+	var id int64
+	return q.QueryRow(ctx, `
+		INSERT INTO outbox_events(type, aggregate, aggregate_id, payload, request_id)
+			VALUES($1, $2, $3, $4::jsonb, $5) RETURNING id`,
+		eventType, aggregate, aggregateID, string(data), requestID).Scan(&id)
+}
+
+// Message is an event published by PublishAll
+type Message struct {
+	Type        string
+	Aggregate   string
+	AggregateID int64
+	Payload     interface{}
+}
+
+// Copier is transaction of bulk changes
+type Copier interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// PublishAll writes events of bulk changes with one COPY
+func PublishAll(ctx context.Context, c Copier, messages []Message) error {
+	var requestID interface{}
+	if id := logger.RequestID(ctx); id != "" {
+		requestID = id
+	}
+	rows := make([][]interface{}, 0, len(messages))
+	for _, message := range messages {
+		data, err := json.Marshal(message.Payload)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{message.Type, message.Aggregate, message.AggregateID, string(data), requestID})
+	}
+	_, err := c.CopyFrom(ctx, pgx.Identifier{"outbox_events"},
+		[]string{"type", "aggregate", "aggregate_id", "payload", "request_id"}, pgx.CopyFromRows(rows))
+	return err
+}
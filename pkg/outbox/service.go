@@ -0,0 +1,357 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var ErrNotFound = apperr.New(apperr.KindNotFound, "not_found", "item not found")
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+var ErrUnknownEventType = apperr.New(apperr.KindUnprocessable, "unknown_event_type", "unknown event type")
+
+// Statuses of deliveries
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	// StatusDead is set after the last failed attempt, replay sends it again
+	StatusDead = "dead"
+)
+
+// Subscription of webhook endpoint to events, empty EventTypes is every event.
+// Secret signs requests, it is returned only when subscription is created.
+type Subscription struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url" validate:"required,url,max=2000"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types" validate:"max=20"`
+	Active     bool      `json:"active"`
+	Created    time.Time `json:"created"`
+}
+
+// Delivery of event to subscription
+type Delivery struct {
+	ID             int64      `json:"id"`
+	EventID        int64      `json:"event_id"`
+	SubscriptionID int64      `json:"subscription_id"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttempt    time.Time  `json:"next_attempt"`
+	LastStatus     int        `json:"last_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	Delivered      *time.Time `json:"delivered,omitempty"`
+	Created        time.Time  `json:"created"`
+}
+
+// Replay asks to send event again, zero SubscriptionID is every matching subscription
+type Replay struct {
+	SubscriptionID int64 `json:"subscription_id" validate:"min=0"`
+}
+
+// ReplayResult tells how many deliveries were scheduled
+type ReplayResult struct {
+	Scheduled int64 `json:"scheduled"`
+}
+
+// Service manages subscriptions and events
+type Service struct {
+	pool *pgxpool.Pool
+}
+
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool}
+}
+
+// Subscriptions returns every subscription without secrets
+func (s *Service) Subscriptions(ctx context.Context) (items []*Subscription, err error) {
+	ctx, span := tracing.Start(ctx, "outbox.Subscriptions")
+	defer tracing.End(span, &err)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, url, event_types, active, created FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer rows.Close()
+
+	items = make([]*Subscription, 0)
+	for rows.Next() {
+		item := &Subscription{}
+		err = rows.Scan(&item.ID, &item.URL, &item.EventTypes, &item.Active, &item.Created)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return items, nil
+}
+
+// SaveSubscription creates subscription when ID is zero and updates it otherwise,
+// secret is generated for new subscriptions without one and never changed
+func (s *Service) SaveSubscription(ctx context.Context, item *Subscription) (saved *Subscription, err error) {
+	ctx, span := tracing.Start(ctx, "outbox.SaveSubscription")
+	defer tracing.End(span, &err)
+
+	err = checkEventTypes(item.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+	if item.EventTypes == nil {
+		item.EventTypes = []string{}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	saved = &Subscription{}
+	if item.ID == 0 {
+		secret := item.Secret
+		if secret == "" {
+			buffer := make([]byte, 32)
+			_, err = rand.Read(buffer)
+			if err != nil {
+				return nil, ErrInternal.Wrap(err)
+			}
+			secret = hex.EncodeToString(buffer)
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO webhook_subscriptions(url, secret, event_types, active) VALUES($1, $2, $3, $4)
+				RETURNING id, url, secret, event_types, active, created`, item.URL, secret, item.EventTypes, item.Active).Scan(
+			&saved.ID, &saved.URL, &saved.Secret, &saved.EventTypes, &saved.Active, &saved.Created)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		err = audit.Record(ctx, tx, "webhook.create", "webhook", saved.ID, nil, saved)
+	} else {
+		before := &Subscription{}
+		err = tx.QueryRow(ctx, `
+			SELECT id, url, event_types, active, created FROM webhook_subscriptions WHERE id = $1 FOR UPDATE`, item.ID).Scan(
+			&before.ID, &before.URL, &before.EventTypes, &before.Active, &before.Created)
+		if err == pgx.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		err = tx.QueryRow(ctx, `
+			UPDATE webhook_subscriptions SET url = $2, event_types = $3, active = $4 WHERE id = $1
+				RETURNING id, url, event_types, active, created`, item.ID, item.URL, item.EventTypes, item.Active).Scan(
+			&saved.ID, &saved.URL, &saved.EventTypes, &saved.Active, &saved.Created)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		err = audit.Record(ctx, tx, "webhook.update", "webhook", saved.ID, before, saved)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return saved, nil
+}
+
+// RemoveSubscription deletes subscription together with its deliveries
+func (s *Service) RemoveSubscription(ctx context.Context, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "outbox.RemoveSubscription")
+	defer tracing.End(span, &err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	before := &Subscription{}
+	err = tx.QueryRow(ctx, `
+		DELETE FROM webhook_subscriptions WHERE id = $1 RETURNING id, url, event_types, active, created`, id).Scan(
+		&before.ID, &before.URL, &before.EventTypes, &before.Active, &before.Created)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = audit.Record(ctx, tx, "webhook.delete", "webhook", id, before, nil)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
+
+// Deliveries returns last deliveries of the subscription, empty status is every status
+func (s *Service) Deliveries(ctx context.Context, subscriptionID int64, status string) (items []*Delivery, err error) {
+	ctx, span := tracing.Start(ctx, "outbox.Deliveries")
+	defer tracing.End(span, &err)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, event_id, subscription_id, status, attempts, next_attempt,
+				COALESCE(last_status, 0), COALESCE(last_error, ''), delivered, created
+			FROM webhook_deliveries
+			WHERE subscription_id = $1 AND ($2::text = '' OR status = $2)
+			ORDER BY id DESC LIMIT 500`, subscriptionID, status)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer rows.Close()
+
+	items = make([]*Delivery, 0)
+	for rows.Next() {
+		item := &Delivery{}
+		err = rows.Scan(&item.ID, &item.EventID, &item.SubscriptionID, &item.Status, &item.Attempts, &item.NextAttempt,
+			&item.LastStatus, &item.LastError, &item.Delivered, &item.Created)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return items, nil
+}
+
+// Events returns events newest first, empty eventType is every type,
+// beforeID continues from the last event of previous page
+func (s *Service) Events(ctx context.Context, eventType string, beforeID int64) (items []*Event, err error) {
+	ctx, span := tracing.Start(ctx, "outbox.Events")
+	defer tracing.End(span, &err)
+
+	items, err = queryEvents(ctx, s.pool, `
+		SELECT id, type, aggregate, aggregate_id, payload, COALESCE(request_id, ''), created
+			FROM outbox_events
+			WHERE ($1::text = '' OR type = $1) AND ($2::bigint = 0 OR id < $2)
+			ORDER BY id DESC LIMIT 100`, eventType, beforeID)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return items, nil
+}
+
+// EventsAfter returns events of the types following afterID oldest first,
+// it resumes streams from the last event client has seen
+func (s *Service) EventsAfter(ctx context.Context, afterID int64, types []string, limit int) (items []*Event, err error) {
+	ctx, span := tracing.Start(ctx, "outbox.EventsAfter")
+	defer tracing.End(span, &err)
+
+	items, err = queryEvents(ctx, s.pool, `
+		SELECT id, type, aggregate, aggregate_id, payload, COALESCE(request_id, ''), created
+			FROM outbox_events
+			WHERE id > $1 AND type = ANY($2)
+			ORDER BY id LIMIT $3`, afterID, types, limit)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return items, nil
+}
+
+// Replay schedules event to matching active subscriptions again, deliveries
+// which exist already, including dead ones, start over
+func (s *Service) Replay(ctx context.Context, eventID int64, replay *Replay) (result *ReplayResult, err error) {
+	ctx, span := tracing.Start(ctx, "outbox.Replay")
+	defer tracing.End(span, &err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var eventType string
+	err = tx.QueryRow(ctx, `SELECT type FROM outbox_events WHERE id = $1`, eventID).Scan(&eventType)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO webhook_deliveries(event_id, subscription_id)
+			SELECT $1, id FROM webhook_subscriptions
+				WHERE active AND ($2::bigint = 0 OR id = $2)
+					AND (cardinality(event_types) = 0 OR $3 = ANY(event_types))
+			ON CONFLICT (event_id, subscription_id) DO UPDATE
+				SET status = 'pending', attempts = 0, next_attempt = CURRENT_TIMESTAMP,
+					last_status = NULL, last_error = NULL, delivered = NULL`,
+		eventID, replay.SubscriptionID, eventType)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	result = &ReplayResult{Scheduled: tag.RowsAffected()}
+	err = audit.Record(ctx, tx, "event.replay", "event", eventID, nil, replay)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return result, nil
+}
+
+func checkEventTypes(types []string) error {
+	details := make([]apperr.Detail, 0)
+	for _, eventType := range types {
+		known := false
+		for _, item := range EventTypes {
+			if item == eventType {
+				known = true
+				break
+			}
+		}
+		if !known {
+			details = append(details, apperr.Detail{Field: "event_types", Rule: "oneof", Message: eventType + " is not a known event type"})
+		}
+	}
+	if len(details) != 0 {
+		return ErrUnknownEventType.WithDetails(details...)
+	}
+	return nil
+}
+
+// queryEvents scans events selected by the query
+func queryEvents(ctx context.Context, pool *pgxpool.Pool, sql string, args ...interface{}) ([]*Event, error) {
+	rows, err := pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Event, 0)
+	for rows.Next() {
+		item := &Event{}
+		var payload []byte
+		err = rows.Scan(&item.ID, &item.Type, &item.Aggregate, &item.AggregateID, &payload, &item.RequestID, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(payload, &item.Payload)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,128 @@
+package password
+
+import (
+	"context"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var ErrInvalidCode = apperr.New(apperr.KindUnprocessable, "invalid_code", "code is invalid or expired")
+
+// Realms of accounts codes belong to
+const (
+	RealmCustomer = "customer"
+	RealmManager  = "manager"
+)
+
+// Purposes of codes
+const (
+	PurposeReset  = "reset"
+	PurposeInvite = "invite"
+	PurposeVerify = "verify"
+	// PurposeTOTP is challenge between password and TOTP steps of login
+	PurposeTOTP = "totp"
+)
+
+// MaxAttempts is number of guesses after which code stops working
+const MaxAttempts = 5
+
+// Codes keeps hashes of one-time codes in password_codes table
+type Codes struct {
+	pool *pgxpool.Pool
+}
+
+// NewCodes creates codes store
+func NewCodes(pool *pgxpool.Pool) *Codes {
+	return &Codes{pool: pool}
+}
+
+// Issue stores code of the account, unused codes of the same purpose stop working
+func (c *Codes) Issue(ctx context.Context, realm string, purpose string, userID int64, code string, ttl time.Duration) error {
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE password_codes SET used = CURRENT_TIMESTAMP
+			WHERE realm = $1 AND purpose = $2 AND user_id = $3 AND used IS NULL`, realm, purpose, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO password_codes(realm, purpose, user_id, code_hash, expire)
+			VALUES($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(secs => $5))`,
+		realm, purpose, userID, HashCode(code), ttl.Seconds())
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Consume checks code of the account and marks it used, every check counts
+// as attempt, so short numeric codes can't be brute-forced
+func (c *Codes) Consume(ctx context.Context, realm string, purpose string, userID int64, code string) error {
+	var id int64
+	var hash string
+	var attempts int
+	err := c.pool.QueryRow(ctx, `
+		UPDATE password_codes SET attempts = attempts + 1
+			WHERE id = (
+				SELECT id FROM password_codes
+					WHERE realm = $1 AND purpose = $2 AND user_id = $3
+						AND used IS NULL AND expire > CURRENT_TIMESTAMP
+					ORDER BY id DESC LIMIT 1
+			) RETURNING id, code_hash, attempts`, realm, purpose, userID).Scan(&id, &hash, &attempts)
+	if err == pgx.ErrNoRows {
+		return ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+	if attempts > MaxAttempts || !EqualCode(code, hash) {
+		return ErrInvalidCode
+	}
+	return c.markUsed(ctx, id)
+}
+
+// FindToken returns account of long random code, e.g. invitation, without using it
+func (c *Codes) FindToken(ctx context.Context, realm string, purpose string, code string) (int64, error) {
+	_, userID, err := c.findToken(ctx, realm, purpose, code)
+	return userID, err
+}
+
+// ConsumeToken finds account by long random code and marks code used
+func (c *Codes) ConsumeToken(ctx context.Context, realm string, purpose string, code string) (int64, error) {
+	id, userID, err := c.findToken(ctx, realm, purpose, code)
+	if err != nil {
+		return 0, err
+	}
+	return userID, c.markUsed(ctx, id)
+}
+
+func (c *Codes) findToken(ctx context.Context, realm string, purpose string, code string) (id int64, userID int64, err error) {
+	err = c.pool.QueryRow(ctx, `
+		SELECT id, user_id FROM password_codes
+			WHERE realm = $1 AND purpose = $2 AND code_hash = $3
+				AND used IS NULL AND expire > CURRENT_TIMESTAMP`, realm, purpose, HashCode(code)).Scan(&id, &userID)
+	if err == pgx.ErrNoRows {
+		return 0, 0, ErrInvalidCode
+	}
+	return id, userID, err
+}
+
+func (c *Codes) markUsed(ctx context.Context, id int64) error {
+	tag, err := c.pool.Exec(ctx, `UPDATE password_codes SET used = CURRENT_TIMESTAMP WHERE id = $1 AND used IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		// another request consumed it first
+		return ErrInvalidCode
+	}
+	return nil
+}
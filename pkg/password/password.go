@@ -0,0 +1,157 @@
+package password
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/phone"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrWeak = apperr.New(apperr.KindUnprocessable, "weak_password", "password does not satisfy policy")
+
+// maxLength is the limit of bcrypt, longer passwords are silently truncated by it
+const maxLength = 72
+
+// Policy decides which passwords are accepted
+type Policy struct {
+	MinLength int
+	// breached keeps known leaked passwords in lower case
+	breached map[string]struct{}
+}
+
+// NewPolicy creates policy, breachList is path of file with one leaked
+// password per line, empty path disables the check
+func NewPolicy(minLength int, breachList string) (*Policy, error) {
+	policy := &Policy{MinLength: minLength, breached: map[string]struct{}{}}
+	if breachList == "" {
+		return policy, nil
+	}
+
+	file, err := os.Open(breachList)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		policy.breached[strings.ToLower(line)] = struct{}{}
+	}
+	return policy, scanner.Err()
+}
+
+// Check returns ErrWeak with details when password is rejected,
+// personal values, e.g. phone or name, must not be used as password
+func (p *Policy) Check(password string, personal ...string) error {
+	details := make([]apperr.Detail, 0)
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		details = append(details, apperr.Detail{Field: "password", Rule: "min_length", Message: "must be at least " + strconv.Itoa(p.MinLength) + " characters"})
+	}
+	if len(password) > maxLength {
+		details = append(details, apperr.Detail{Field: "password", Rule: "max_length", Message: "must be at most " + strconv.Itoa(maxLength) + " bytes"})
+	}
+	lower := strings.ToLower(password)
+	if _, ok := p.breached[lower]; ok {
+		details = append(details, apperr.Detail{Field: "password", Rule: "breached", Message: "appears in a list of leaked passwords"})
+	}
+	for _, value := range personal {
+		if value != "" && strings.ToLower(value) == lower {
+			details = append(details, apperr.Detail{Field: "password", Rule: "personal", Message: "must not be equal to name or phone"})
+			break
+		}
+	}
+	if len(details) != 0 {
+		return ErrWeak.WithDetails(details...)
+	}
+	return nil
+}
+
+// Hash returns bcrypt hash of the password
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// NewCode generates numeric one-time code of provided length, e.g. for SMS
+func NewCode(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	code := n.String()
+	return strings.Repeat("0", digits-len(code)) + code, nil
+}
+
+// NewToken generates long random code sent in links, e.g. invitations
+func NewToken() (string, error) {
+	buffer := make([]byte, 32)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// HashCode returns hash of one-time code stored instead of the code
+func HashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// EqualCode compares code with stored hash in constant time
+func EqualCode(code string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashCode(code)), []byte(hash)) == 1
+}
+
+// Change is request of authenticated user to change password
+type Change struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+// ResetRequest asks to send reset code to the phone
+type ResetRequest struct {
+	Phone string `json:"phone" validate:"required,phone"`
+}
+
+// Normalize converts phone to E.164 before validation
+func (r *ResetRequest) Normalize() {
+	r.Phone = phone.Clean(r.Phone)
+}
+
+// Reset sets new password using code sent to the phone
+type Reset struct {
+	Phone    string `json:"phone" validate:"required,phone"`
+	Code     string `json:"code" validate:"required,max=64"`
+	Password string `json:"password" validate:"required"`
+}
+
+// Normalize converts phone to E.164 before validation
+func (r *Reset) Normalize() {
+	r.Phone = phone.Clean(r.Phone)
+}
+
+// InvitationAccept sets password of invited manager
+type InvitationAccept struct {
+	Code     string `json:"code" validate:"required,max=128"`
+	Password string `json:"password" validate:"required"`
+}
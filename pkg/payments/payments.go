@@ -0,0 +1,189 @@
+// Package payments records payments of sales and drives status of sales by
+// them. Sale is paid when captured payments cover its total, possibly split
+// between several payments and methods, partially refunded when some of
+// captured amount is returned and refunded when all of it is. Cash is taken
+// by managers, card and transfer payments go through the Provider.
+//
+// Provider is never called inside a transaction. Payment is recorded as
+// pending with its idempotency key first, the provider is called with the
+// key and its answer is recorded by a second transaction. Payment left
+// pending or capturing by a failure is finished by paying again with the
+// same key or by capturing it, refund left in progress by refunding again.
+package payments
+
+import (
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/money"
+	"github.com/jackc/pgx/v4"
+)
+
+// Methods of payments
+const (
+	MethodCash     = "cash"
+	MethodCard     = "card"
+	MethodTransfer = "transfer"
+)
+
+// Statuses of payments
+const (
+	StatusPending    = "pending"
+	StatusAuthorized = "authorized"
+	StatusCapturing  = "capturing"
+	StatusCaptured   = "captured"
+	StatusRefunded   = "refunded"
+	StatusDeclined   = "declined"
+)
+
+// Statuses of sales
+const (
+	SalePending           = "pending"
+	SalePaid              = "paid"
+	SalePartiallyRefunded = "partially_refunded"
+	SaleRefunded          = "refunded"
+)
+
+var ErrNotFound = apperr.New(apperr.KindNotFound, "payment_not_found", "payment not found")
+var ErrSaleNotFound = apperr.New(apperr.KindNotFound, "sale_not_found", "sale not found")
+var ErrSaleNotPending = apperr.New(apperr.KindConflict, "sale_not_pending", "sale is already paid or refunded")
+var ErrExceedsDue = apperr.New(apperr.KindUnprocessable, "payment_exceeds_due", "amount is more than due of the sale")
+var ErrDeclined = apperr.New(apperr.KindUnprocessable, "payment_declined", "payment is declined by the provider")
+var ErrNotAuthorized = apperr.New(apperr.KindConflict, "payment_not_authorized", "only authorized payments are captured")
+var ErrKeyReused = apperr.New(apperr.KindConflict, "idempotency_key_reused", "idempotency key belongs to another payment")
+var ErrRefundInProgress = apperr.New(apperr.KindConflict, "refund_in_progress", "another refund of the payment is in progress")
+var ErrNotCaptured = apperr.New(apperr.KindConflict, "payment_not_captured", "only captured payments are refunded")
+var ErrExceedsPayment = apperr.New(apperr.KindUnprocessable, "refund_exceeds_payment", "amount is more than captured and not refunded")
+var ErrNoProvider = apperr.New(apperr.KindUnprocessable, "payment_method_unavailable", "card and transfer payments are not available without payment provider")
+var ErrProvider = apperr.New(apperr.KindInternal, "payment_provider_failed", "payment provider failed")
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+
+// Payment of the sale. Amount without currency is in currency of the sale.
+// AuthorizeOnly card and transfer payments are captured later, the others
+// are captured at once. Payments with the same IdempotencyKey are the same
+// payment, the key is generated when client sends none.
+type Payment struct {
+	ID             int64       `json:"id"`
+	SaleID         int64       `json:"sale_id"`
+	ManagerID      int64       `json:"manager_id"`
+	IdempotencyKey string      `json:"idempotency_key,omitempty" validate:"max=100"`
+	Method         string      `json:"method" validate:"required,oneof=cash card transfer"`
+	Amount         money.Money `json:"amount" validate:"min=1"`
+	AuthorizeOnly  bool        `json:"authorize_only,omitempty"`
+	Status         string      `json:"status"`
+	Refunded       money.Money `json:"refunded"`
+	// Refunding is amount of refund sent to the provider and not confirmed yet
+	Refunding money.Money `json:"refunding"`
+	Reference string      `json:"reference,omitempty"`
+	// Error of the provider which declined the payment
+	Error   string    `json:"error,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	// refundKey is idempotency key of refund in progress
+	refundKey string
+}
+
+// Normalize puts currency in upper case before validation
+func (p *Payment) Normalize() {
+	p.Amount.Currency = money.Code(p.Amount.Currency)
+}
+
+// Refund of a captured payment, zero amount is everything not refunded yet
+type Refund struct {
+	Amount money.Money `json:"amount" validate:"min=0"`
+}
+
+// Normalize puts currency in upper case before validation
+func (r *Refund) Normalize() {
+	r.Amount.Currency = money.Code(r.Amount.Currency)
+}
+
+// Summary of payments of the sale. Captured includes refunded amounts,
+// Authorized includes payments not answered by the provider yet, Due is
+// what is left to pay of pending sale after captured and not refunded and
+// authorized payments.
+type Summary struct {
+	SaleID     int64       `json:"sale_id"`
+	Status     string      `json:"status"`
+	Total      money.Money `json:"total"`
+	Authorized money.Money `json:"authorized"`
+	Captured   money.Money `json:"captured"`
+	Refunded   money.Money `json:"refunded"`
+	Due        money.Money `json:"due"`
+	Payments   []*Payment  `json:"payments"`
+}
+
+// status returns status of the sale driven by its payments. Pending sale is
+// paid when captured and not refunded amount covers its total, refunds of a
+// sale paid in part are paid again. Paid sale is refunded in part or in full
+// when that amount goes below its total or down to zero.
+func (s *Summary) status() string {
+	kept := s.Captured.Amount - s.Refunded.Amount
+	if s.Status == SalePending {
+		if s.Captured.Amount > 0 && kept >= s.Total.Amount {
+			return SalePaid
+		}
+		return SalePending
+	}
+	switch {
+	case kept <= 0:
+		return SaleRefunded
+	case kept < s.Total.Amount:
+		return SalePartiallyRefunded
+	}
+	return SalePaid
+}
+
+// admit checks amount of a new payment of the sale, empty currency is set
+// to currency of the sale
+func (s *Summary) admit(amount *money.Money) error {
+	if s.Status != SalePending {
+		return ErrSaleNotPending
+	}
+	if amount.Currency == "" {
+		amount.Currency = s.Total.Currency
+	}
+	if amount.Currency != s.Total.Currency {
+		return money.ErrCurrencyMismatch.WithDetails(apperr.Detail{Field: "amount.currency", Rule: "currency", Message: "must be " + s.Total.Currency + " of the sale"})
+	}
+	if amount.Amount > s.Due.Amount {
+		return ErrExceedsDue.WithDetails(apperr.Detail{Field: "amount", Rule: "max", Message: "due is " + s.Due.String()})
+	}
+	return nil
+}
+
+// sum adds up amounts of payments, they are in currency of the sale
+func (s *Summary) sum() {
+	currency := s.Total.Currency
+	s.Authorized, s.Captured, s.Refunded = money.New(0, currency), money.New(0, currency), money.New(0, currency)
+	for _, item := range s.Payments {
+		switch item.Status {
+		case StatusPending, StatusAuthorized, StatusCapturing:
+			s.Authorized.Amount += item.Amount.Amount
+		case StatusCaptured, StatusRefunded:
+			s.Captured.Amount += item.Amount.Amount
+			s.Refunded.Amount += item.Refunded.Amount
+		}
+	}
+	s.Due = money.New(0, currency)
+	if s.Status != SalePending {
+		return
+	}
+	if due := s.Total.Amount - (s.Captured.Amount - s.Refunded.Amount) - s.Authorized.Amount; due > 0 {
+		s.Due.Amount = due
+	}
+}
+
+// columns are selected for Payment in the order scanned by scan
+const columns = `id, sale_id, manager_id, idempotency_key, method, amount, currency, authorize_only, status, refunded, refunding,
+	COALESCE(refund_key, ''), COALESCE(reference, ''), COALESCE(error, ''), created, updated`
+
+// scan scans row of columns
+func scan(row pgx.Row, item *Payment) error {
+	err := row.Scan(&item.ID, &item.SaleID, &item.ManagerID, &item.IdempotencyKey, &item.Method, &item.Amount.Amount, &item.Amount.Currency,
+		&item.AuthorizeOnly, &item.Status, &item.Refunded.Amount, &item.Refunding.Amount, &item.refundKey, &item.Reference, &item.Error,
+		&item.Created, &item.Updated)
+	item.Refunded.Currency = item.Amount.Currency
+	item.Refunding.Currency = item.Amount.Currency
+	return err
+}
@@ -0,0 +1,173 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/darkside1809/gosql/pkg/money"
+)
+
+// payment of the sale in TJS with refunded amount
+func payment(method string, status string, amount int64, refunded int64) *Payment {
+	return &Payment{Method: method, Status: status, Amount: money.New(amount, "TJS"), Refunded: money.New(refunded, "TJS")}
+}
+
+// summary of the sale of the total with payments, summed as load does
+func summary(status string, total int64, items ...*Payment) *Summary {
+	s := &Summary{SaleID: 1, Status: status, Total: money.New(total, "TJS"), Payments: items}
+	s.sum()
+	return s
+}
+
+func TestSumSplitPayments(t *testing.T) {
+	s := summary(SalePending, 100_00,
+		payment(MethodCash, StatusCaptured, 30_00, 0),
+		payment(MethodCard, StatusCaptured, 50_00, 0),
+		payment(MethodCard, StatusDeclined, 20_00, 0),
+		payment(MethodTransfer, StatusPending, 15_00, 0),
+	)
+	if s.Captured.Amount != 80_00 || s.Authorized.Amount != 15_00 || s.Due.Amount != 5_00 {
+		t.Errorf("captured %d authorized %d due %d, want 8000 1500 500", s.Captured.Amount, s.Authorized.Amount, s.Due.Amount)
+	}
+	for _, status := range []string{StatusAuthorized, StatusCapturing} {
+		s.Payments[3].Status = status
+		s.sum()
+		if s.Authorized.Amount != 15_00 {
+			t.Errorf("%s payment: authorized %d, want 1500", status, s.Authorized.Amount)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		previous string
+		payments []*Payment
+		status   string
+		due      int64
+	}{
+		{"nothing paid", SalePending, nil, SalePending, 100_00},
+		{"part paid", SalePending, []*Payment{
+			payment(MethodCash, StatusCaptured, 40_00, 0),
+			payment(MethodCard, StatusAuthorized, 20_00, 0),
+		}, SalePending, 40_00},
+		{"split payments cover total", SalePending, []*Payment{
+			payment(MethodCash, StatusCaptured, 30_00, 0),
+			payment(MethodCard, StatusCaptured, 50_00, 0),
+			payment(MethodTransfer, StatusCaptured, 20_00, 0),
+		}, SalePaid, 0},
+		{"part paid and refunded", SalePending, []*Payment{
+			payment(MethodCard, StatusRefunded, 50_00, 50_00),
+		}, SalePending, 100_00},
+		{"paid after refund of part", SalePending, []*Payment{
+			payment(MethodCard, StatusRefunded, 50_00, 50_00),
+			payment(MethodCash, StatusCaptured, 100_00, 0),
+		}, SalePaid, 0},
+		{"paid sale refunded in part", SalePaid, []*Payment{
+			payment(MethodCard, StatusCaptured, 60_00, 10_00),
+			payment(MethodCash, StatusCaptured, 40_00, 0),
+		}, SalePartiallyRefunded, 0},
+		{"paid sale refunded by one payment", SalePartiallyRefunded, []*Payment{
+			payment(MethodCard, StatusRefunded, 60_00, 60_00),
+			payment(MethodCash, StatusCaptured, 40_00, 0),
+		}, SalePartiallyRefunded, 0},
+		{"paid sale refunded in full", SalePartiallyRefunded, []*Payment{
+			payment(MethodCard, StatusRefunded, 60_00, 60_00),
+			payment(MethodCash, StatusRefunded, 40_00, 40_00),
+		}, SaleRefunded, 0},
+	} {
+		s := summary(test.previous, 100_00, test.payments...)
+		if status := s.status(); status != test.status || s.Due.Amount != test.due {
+			t.Errorf("%s: status %s due %d, want %s %d", test.name, status, s.Due.Amount, test.status, test.due)
+		}
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	s := summary(SalePending, 100_00,
+		payment(MethodCard, StatusCaptured, 80_00, 0),
+		payment(MethodCard, StatusDeclined, 20_00, 0),
+	)
+	amount := money.New(20_01, "")
+	if err := s.admit(&amount); !errors.Is(err, ErrExceedsDue) {
+		t.Errorf("paying over due: got %v, want %v", err, ErrExceedsDue)
+	}
+	amount = money.New(20_00, "")
+	if err := s.admit(&amount); err != nil || amount.Currency != "TJS" {
+		t.Errorf("paying due: got %v in %q, want currency of the sale", err, amount.Currency)
+	}
+	amount = money.New(5_00, "USD")
+	if err := s.admit(&amount); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("paying in another currency: got %v, want %v", err, money.ErrCurrencyMismatch)
+	}
+
+	// payment not answered by the provider yet holds its amount
+	s = summary(SalePending, 100_00,
+		payment(MethodCard, StatusCaptured, 80_00, 0),
+		payment(MethodCard, StatusPending, 15_00, 0),
+	)
+	amount = money.New(5_01, "")
+	if err := s.admit(&amount); !errors.Is(err, ErrExceedsDue) {
+		t.Errorf("paying over due with pending payment: got %v, want %v", err, ErrExceedsDue)
+	}
+
+	// refund of sale paid in part is paid again
+	s = summary(SalePending, 100_00, payment(MethodCard, StatusCaptured, 50_00, 50_00))
+	amount = money.New(100_00, "")
+	if err := s.admit(&amount); err != nil {
+		t.Errorf("paying sale refunded in part: %v", err)
+	}
+
+	s = summary(SalePaid, 100_00, payment(MethodCash, StatusCaptured, 100_00, 0))
+	amount = money.New(1, "")
+	if err := s.admit(&amount); !errors.Is(err, ErrSaleNotPending) {
+		t.Errorf("paying paid sale: got %v, want %v", err, ErrSaleNotPending)
+	}
+}
+
+func TestFakeProviderDeclines(t *testing.T) {
+	provider := NewFakeProvider()
+	_, err := provider.Authorize(context.Background(), &Request{Key: "key", Method: MethodCard, Amount: money.New(10_00+FakeDeclined, "TJS")})
+	if !errors.Is(err, ErrDeclined) {
+		t.Errorf("got %v, want %v", err, ErrDeclined)
+	}
+}
+
+func TestFakeProviderIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	provider := NewFakeProvider()
+	amount := money.New(50_00, "TJS")
+
+	reference, err := provider.Authorize(ctx, &Request{Key: "key", Method: MethodCard, Amount: amount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := provider.Authorize(ctx, &Request{Key: "key", Method: MethodCard, Amount: amount})
+	if err != nil || again != reference {
+		t.Errorf("authorizing again: got %s %v, want %s", again, err, reference)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = provider.Capture(ctx, reference, amount)
+		if err != nil {
+			t.Fatalf("capture %d: %v", i+1, err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		err = provider.Refund(ctx, reference, "refund", money.New(30_00, "TJS"))
+		if err != nil {
+			t.Fatalf("refund %d: %v", i+1, err)
+		}
+	}
+	// the repeated refund was not taken, so the rest is still refundable
+	err = provider.Refund(ctx, reference, "rest", money.New(20_00, "TJS"))
+	if err != nil {
+		t.Errorf("refunding the rest: %v", err)
+	}
+	err = provider.Refund(ctx, reference, "over", money.New(1, "TJS"))
+	if err == nil {
+		t.Error("refund over captured amount succeeded")
+	}
+}
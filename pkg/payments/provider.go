@@ -0,0 +1,116 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/darkside1809/gosql/pkg/money"
+)
+
+// ErrUnknownReference is returned by providers for payments they don't know
+var ErrUnknownReference = errors.New("payments: unknown reference")
+
+// Request to authorize amount of a payment of the sale. Key is idempotency
+// key of the payment, requests with the same key are the same payment.
+type Request struct {
+	Key    string
+	SaleID int64
+	Method string
+	Amount money.Money
+}
+
+// Provider authorizes, captures and refunds card and transfer payments,
+// production deployments plug in acquirers or banks, the fake one is for
+// tests and local use. Declined payments are reported with ErrDeclined
+// wrapping the reason, any other error means the provider failed. Every
+// call is repeated after failures, so it must be idempotent.
+type Provider interface {
+	// Authorize holds amount of the request and returns reference of the
+	// payment, the same reference for the same key
+	Authorize(ctx context.Context, request *Request) (string, error)
+	// Capture takes authorized amount of the payment, capturing captured
+	// payment again succeeds
+	Capture(ctx context.Context, reference string, amount money.Money) error
+	// Refund returns amount of captured payment once for the key, refunds
+	// may be partial
+	Refund(ctx context.Context, reference string, key string, amount money.Money) error
+}
+
+// FakeDeclined is minor units ending of amounts FakeProvider declines,
+// e.g. 10.13 or 1.13
+const FakeDeclined = 13
+
+// FakeProvider keeps payments in memory and answers the same way every time:
+// amounts ending in FakeDeclined minor units are declined, references are
+// fake_1, fake_2 and so on, captures of other amounts than authorized and
+// refunds over captured amount fail
+type FakeProvider struct {
+	mu         sync.Mutex
+	next       int
+	references map[string]string
+	payments   map[string]*fakePayment
+}
+
+type fakePayment struct {
+	amount   money.Money
+	captured bool
+	refunded int64
+	refunds  map[string]int64
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{references: map[string]string{}, payments: map[string]*fakePayment{}}
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, request *Request) (string, error) {
+	if request.Amount.Amount%100 == FakeDeclined {
+		return "", ErrDeclined.Wrap(errors.New("fake: amount ending in 13 is declined"))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if reference, ok := p.references[request.Key]; ok && request.Key != "" {
+		return reference, nil
+	}
+	p.next++
+	reference := fmt.Sprintf("fake_%d", p.next)
+	p.references[request.Key] = reference
+	p.payments[reference] = &fakePayment{amount: request.Amount, refunds: map[string]int64{}}
+	return reference, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, reference string, amount money.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payment, ok := p.payments[reference]
+	if !ok {
+		return ErrUnknownReference
+	}
+	if amount != payment.amount {
+		return errors.New("fake: capture differs from authorized amount")
+	}
+	payment.captured = true
+	return nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, reference string, key string, amount money.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payment, ok := p.payments[reference]
+	if !ok {
+		return ErrUnknownReference
+	}
+	if refunded, ok := payment.refunds[key]; ok {
+		if refunded != amount.Amount {
+			return errors.New("fake: refund key is used for another amount")
+		}
+		return nil
+	}
+	if !payment.captured || amount.Currency != payment.amount.Currency || payment.refunded+amount.Amount > payment.amount.Amount {
+		return errors.New("fake: refund exceeds captured amount")
+	}
+	payment.refunds[key] = amount.Amount
+	payment.refunded += amount.Amount
+	return nil
+}
@@ -0,0 +1,470 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/metrics"
+	"github.com/darkside1809/gosql/pkg/money"
+	"github.com/darkside1809/gosql/pkg/outbox"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/darkside1809/gosql/pkg/validate"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var paymentsTotal = metrics.Default.CounterVec("gosql_payments_total", "Payments by method and status.", "method", "status")
+
+// Service takes payments of sales. The sale row is locked while its
+// payments change, so concurrent payments never pay more than due. Without
+// provider only cash is taken.
+type Service struct {
+	pool     *pgxpool.Pool
+	provider Provider
+}
+
+func NewService(pool *pgxpool.Pool, provider Provider) *Service {
+	return &Service{pool: pool, provider: provider}
+}
+
+// Payments returns summary of the sale with its payments, oldest first
+func (s *Service) Payments(ctx context.Context, saleID int64) (summary *Summary, err error) {
+	ctx, span := tracing.Start(ctx, "payments.Payments")
+	defer tracing.End(span, &err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	summary, err = load(ctx, tx, saleID, false)
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// Pay takes payment of the sale. Declined payment is recorded and
+// ErrDeclined is returned. Paying again with the key of a recorded payment
+// returns it, finishing it first when provider or database failed before.
+func (s *Service) Pay(ctx context.Context, saleID int64, item *Payment) (saved *Payment, err error) {
+	ctx, span := tracing.Start(ctx, "payments.Pay")
+	defer tracing.End(span, &err)
+
+	if item.Method == MethodCash && item.AuthorizeOnly {
+		return nil, validate.ErrFailed.WithDetails(apperr.Detail{Field: "authorize_only", Rule: "method", Message: "cash is captured at once"})
+	}
+	if item.Method != MethodCash && s.provider == nil {
+		return nil, ErrNoProvider.WithDetails(apperr.Detail{Field: "method", Rule: "method", Message: "only cash is taken"})
+	}
+	if item.IdempotencyKey == "" {
+		item.IdempotencyKey, err = newKey()
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+	}
+
+	saved, err = s.open(ctx, saleID, item)
+	if err != nil {
+		return nil, err
+	}
+	return s.process(ctx, saved, !saved.AuthorizeOnly)
+}
+
+// open records new payment of the sale as pending, cash as captured, or
+// returns payment recorded before with the same idempotency key
+func (s *Service) open(ctx context.Context, saleID int64, item *Payment) (*Payment, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	summary, err := load(ctx, tx, saleID, true)
+	if err != nil {
+		return nil, err
+	}
+	saved := &Payment{}
+	err = scan(tx.QueryRow(ctx, `SELECT `+columns+` FROM payments WHERE idempotency_key = $1`, item.IdempotencyKey), saved)
+	if err == nil {
+		if saved.SaleID != saleID || saved.Method != item.Method || saved.Amount.Amount != item.Amount.Amount {
+			return nil, ErrKeyReused
+		}
+		return saved, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	err = summary.admit(&item.Amount)
+	if err != nil {
+		return nil, err
+	}
+	status := StatusPending
+	if item.Method == MethodCash {
+		status = StatusCaptured
+	}
+	err = scan(tx.QueryRow(ctx, `
+		INSERT INTO payments(sale_id, manager_id, idempotency_key, method, amount, currency, authorize_only, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING `+columns, saleID, item.ManagerID, item.IdempotencyKey, item.Method, item.Amount.Amount, item.Amount.Currency,
+		item.AuthorizeOnly, status), saved)
+	if isUniqueViolation(err) {
+		// key is taken by payment of another sale since the lookup
+		return nil, ErrKeyReused
+	}
+	if err == nil {
+		err = audit.Record(ctx, tx, "payment.create", "payment", saved.ID, nil, saved)
+	}
+	if err == nil && status == StatusCaptured {
+		err = settle(ctx, tx, summary)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	if status == StatusCaptured {
+		paymentsTotal.With(saved.Method, saved.Status).Inc()
+	}
+	return saved, nil
+}
+
+// process finishes payment at the provider: pending payment is authorized
+// and captured when capture is set, capturing one is captured. Answers of the
+// provider are recorded by transactions of their own. Payment in any other
+// status is returned as it is, declined one with ErrDeclined.
+func (s *Service) process(ctx context.Context, item *Payment, capture bool) (*Payment, error) {
+	var err error
+	if item.Status == StatusPending {
+		var reference string
+		reference, err = s.provider.Authorize(ctx, &Request{Key: item.IdempotencyKey, SaleID: item.SaleID, Method: item.Method, Amount: item.Amount})
+		switch {
+		case errors.Is(err, ErrDeclined):
+			item, err = s.record(ctx, item.ID, inStatus(StatusPending), "payment.decline", `
+				UPDATE payments SET status = 'declined', error = $2, updated = CURRENT_TIMESTAMP WHERE id = $1`, err.Error())
+		case err != nil:
+			return nil, ErrProvider.Wrap(err)
+		default:
+			status := StatusAuthorized
+			if capture {
+				status = StatusCapturing
+			}
+			item, err = s.record(ctx, item.ID, inStatus(StatusPending), "payment.authorize", `
+				UPDATE payments SET status = $2, reference = $3, updated = CURRENT_TIMESTAMP WHERE id = $1`, status, reference)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if item.Status == StatusCapturing {
+		err = s.provider.Capture(ctx, item.Reference, item.Amount)
+		if err != nil {
+			return nil, ErrProvider.Wrap(err)
+		}
+		item, err = s.record(ctx, item.ID, inStatus(StatusCapturing), "payment.capture", `
+			UPDATE payments SET status = 'captured', updated = CURRENT_TIMESTAMP WHERE id = $1`)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if item.Status == StatusDeclined {
+		return nil, ErrDeclined.WithDetails(apperr.Detail{Field: "method", Message: item.Error})
+	}
+	return item, nil
+}
+
+// Capture takes amount of authorized payment, payment left pending or
+// capturing by a failure is finished
+func (s *Service) Capture(ctx context.Context, id int64) (saved *Payment, err error) {
+	ctx, span := tracing.Start(ctx, "payments.Capture")
+	defer tracing.End(span, &err)
+
+	item := &Payment{}
+	err = scan(s.pool.QueryRow(ctx, `SELECT `+columns+` FROM payments WHERE id = $1`, id), item)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	if item.Method != MethodCash && s.provider == nil {
+		return nil, ErrNoProvider
+	}
+	switch item.Status {
+	case StatusAuthorized:
+		item, err = s.record(ctx, id, inStatus(StatusAuthorized), "payment.capturing", `
+			UPDATE payments SET status = 'capturing', updated = CURRENT_TIMESTAMP WHERE id = $1`)
+		if err != nil {
+			return nil, err
+		}
+	case StatusPending, StatusCapturing:
+	default:
+		return nil, ErrNotAuthorized
+	}
+	return s.process(ctx, item, true)
+}
+
+// Refund returns amount of captured payment, cash is returned by the
+// manager. Refund in progress is finished first, so it is repeated after
+// failures with the same or zero amount.
+func (s *Service) Refund(ctx context.Context, id int64, refund *Refund) (saved *Payment, err error) {
+	ctx, span := tracing.Start(ctx, "payments.Refund")
+	defer tracing.End(span, &err)
+
+	item, err := s.openRefund(ctx, id, refund)
+	if err != nil {
+		return nil, err
+	}
+	if item.Refunding.Amount == 0 {
+		return item, nil
+	}
+
+	err = s.provider.Refund(ctx, item.Reference, item.refundKey, item.Refunding)
+	if err != nil {
+		return nil, ErrProvider.Wrap(err)
+	}
+	refunding := func(p *Payment) bool { return p.Refunding.Amount > 0 }
+	return s.record(ctx, id, refunding, "payment.refund", `
+		UPDATE payments SET refunded = refunded + refunding, refunding = 0, refund_key = NULL,
+				status = CASE WHEN refunded + refunding = amount THEN 'refunded' ELSE status END,
+				updated = CURRENT_TIMESTAMP
+			WHERE id = $1`)
+}
+
+// openRefund records refund of the payment as in progress with a new key,
+// cash is refunded at once, or returns refund in progress
+func (s *Service) openRefund(ctx context.Context, id int64, refund *Refund) (*Payment, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	before, summary, err := lock(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if before.Method != MethodCash && s.provider == nil {
+		return nil, ErrNoProvider
+	}
+	if before.Refunding.Amount > 0 {
+		if refund.Amount.Amount != 0 && refund.Amount.Amount != before.Refunding.Amount {
+			return nil, ErrRefundInProgress.WithDetails(apperr.Detail{Field: "amount", Message: "refund of " + before.Refunding.String() + " is in progress"})
+		}
+		return before, nil
+	}
+	if before.Status != StatusCaptured {
+		return nil, ErrNotCaptured
+	}
+	left := before.Amount.Amount - before.Refunded.Amount
+	amount := refund.Amount
+	if amount.Amount == 0 {
+		amount.Amount = left
+	}
+	if amount.Currency == "" {
+		amount.Currency = before.Amount.Currency
+	}
+	if amount.Currency != before.Amount.Currency {
+		return nil, money.ErrCurrencyMismatch.WithDetails(apperr.Detail{Field: "amount.currency", Rule: "currency", Message: "must be " + before.Amount.Currency + " of the payment"})
+	}
+	if amount.Amount > left {
+		return nil, ErrExceedsPayment.WithDetails(apperr.Detail{Field: "amount", Rule: "max", Message: "refundable is " + money.New(left, amount.Currency).String()})
+	}
+
+	saved := &Payment{}
+	if before.Method == MethodCash {
+		err = scan(tx.QueryRow(ctx, `
+			UPDATE payments SET refunded = refunded + $2,
+					status = CASE WHEN refunded + $2 = amount THEN 'refunded' ELSE status END,
+					updated = CURRENT_TIMESTAMP
+				WHERE id = $1 RETURNING `+columns, id, amount.Amount), saved)
+		if err == nil {
+			err = audit.Record(ctx, tx, "payment.refund", "payment", id, before, saved)
+		}
+		if err == nil {
+			err = settle(ctx, tx, summary)
+		}
+	} else {
+		var key string
+		key, err = newKey()
+		if err == nil {
+			err = scan(tx.QueryRow(ctx, `
+				UPDATE payments SET refunding = $2, refund_key = $3, updated = CURRENT_TIMESTAMP
+					WHERE id = $1 RETURNING `+columns, id, amount.Amount, key), saved)
+		}
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	if saved.Status == StatusRefunded {
+		paymentsTotal.With(saved.Method, saved.Status).Inc()
+	}
+	return saved, nil
+}
+
+// inStatus matches payments in the status
+func inStatus(status string) func(*Payment) bool {
+	return func(item *Payment) bool { return item.Status == status }
+}
+
+// record changes the payment by query with id in $1 and args after it when
+// the payment still matches, audits the change and settles the sale. When
+// concurrent request changed the payment already, it is returned as it is.
+func (s *Service) record(ctx context.Context, id int64, matches func(*Payment) bool, action string, query string, args ...interface{}) (*Payment, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	before, summary, err := lock(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !matches(before) {
+		return before, nil
+	}
+
+	saved := &Payment{}
+	err = scan(tx.QueryRow(ctx, query+` RETURNING `+columns, append([]interface{}{id}, args...)...), saved)
+	if err == nil {
+		err = audit.Record(ctx, tx, action, "payment", id, before, saved)
+	}
+	if err == nil {
+		err = settle(ctx, tx, summary)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	switch saved.Status {
+	case StatusAuthorized, StatusCaptured, StatusRefunded, StatusDeclined:
+		if saved.Status != before.Status {
+			paymentsTotal.With(saved.Method, saved.Status).Inc()
+		}
+	}
+	return saved, nil
+}
+
+// newKey returns random idempotency key
+func newKey() (string, error) {
+	buffer := make([]byte, 16)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// isUniqueViolation reports whether err is duplicate key error of the server
+func isUniqueViolation(err error) bool {
+	var state interface{ SQLState() string }
+	return errors.As(err, &state) && state.SQLState() == "23505"
+}
+
+// lock locks sale of the payment and then the payment, so payments of a sale
+// are changed one at a time
+func lock(ctx context.Context, tx pgx.Tx, id int64) (*Payment, *Summary, error) {
+	var saleID int64
+	err := tx.QueryRow(ctx, `SELECT sale_id FROM payments WHERE id = $1`, id).Scan(&saleID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, ErrInternal.Wrap(err)
+	}
+	summary, err := load(ctx, tx, saleID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	item := &Payment{}
+	err = scan(tx.QueryRow(ctx, `SELECT `+columns+` FROM payments WHERE id = $1 FOR UPDATE`, id), item)
+	if err != nil {
+		return nil, nil, ErrInternal.Wrap(err)
+	}
+	return item, summary, nil
+}
+
+// load returns summary of payments of the sale, the sale row is locked
+// until the transaction ends when lock is set
+func load(ctx context.Context, tx pgx.Tx, saleID int64, lock bool) (*Summary, error) {
+	summary := &Summary{SaleID: saleID}
+	query := `SELECT status FROM sales WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	err := tx.QueryRow(ctx, query, saleID).Scan(&summary.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSaleNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	// positions of a sale share currency
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(total), 0)::bigint, COALESCE(MIN(currency), '') FROM sale_positions WHERE sale_id = $1`, saleID).
+		Scan(&summary.Total.Amount, &summary.Total.Currency)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+
+	rows, err := tx.Query(ctx, `SELECT `+columns+` FROM payments WHERE sale_id = $1 ORDER BY id`, saleID)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer rows.Close()
+	summary.Payments = make([]*Payment, 0)
+	for rows.Next() {
+		item := &Payment{}
+		err = scan(rows, item)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		summary.Payments = append(summary.Payments, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	summary.sum()
+	return summary, nil
+}
+
+// settle updates status of the sale locked by load after its payments
+// changed and publishes sale.paid or sale.refunded when it changes
+func settle(ctx context.Context, tx pgx.Tx, before *Summary) error {
+	after, err := load(ctx, tx, before.SaleID, false)
+	if err != nil {
+		return err
+	}
+	status := after.status()
+	if status == before.Status {
+		return nil
+	}
+	_, err = tx.Exec(ctx, `UPDATE sales SET status = $2 WHERE id = $1`, before.SaleID, status)
+	if err != nil {
+		return err
+	}
+	eventType := outbox.EventSalePaid
+	if status == SaleRefunded {
+		eventType = outbox.EventSaleRefunded
+	} else if status != SalePaid {
+		return nil
+	}
+	after.Status = status
+	return outbox.Publish(ctx, tx, eventType, "sale", before.SaleID, after)
+}
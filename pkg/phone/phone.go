@@ -0,0 +1,63 @@
+package phone
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/darkside1809/gosql/pkg/validate"
+)
+
+var ErrInvalid = errors.New("phone: not a valid phone number")
+
+// defaultCountry is calling code, e.g. 992, prepended to numbers written without it
+var defaultCountry string
+
+// SetDefaultCountry sets calling code used for national numbers, empty code
+// makes such numbers invalid
+func SetDefaultCountry(code string) {
+	defaultCountry = strings.TrimPrefix(strings.TrimSpace(code), "+")
+}
+
+// Normalize converts phone written by a person, e.g. "00 992 (90) 123-45-67",
+// to E.164 format, e.g. +992901234567
+func Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	var b strings.Builder
+	for i, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+		default:
+			return "", ErrInvalid
+		}
+	}
+
+	number := b.String()
+	switch {
+	case strings.HasPrefix(number, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = "+" + number[2:]
+	case defaultCountry != "":
+		// national trunk prefix is dropped, e.g. 0901234567
+		number = "+" + defaultCountry + strings.TrimLeft(number, "0")
+	default:
+		return "", ErrInvalid
+	}
+	if !validate.E164.MatchString(number) {
+		return "", ErrInvalid
+	}
+	return number, nil
+}
+
+// Clean returns normalized phone or raw value when it can't be normalized,
+// so validation reports the value client sent
+func Clean(raw string) string {
+	number, err := Normalize(raw)
+	if err != nil {
+		return raw
+	}
+	return number
+}
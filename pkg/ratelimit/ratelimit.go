@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit of token bucket: Rate tokens per second are added up to Burst
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Per creates limit allowing n events per period with burst of n
+func Per(n int, period time.Duration) Limit {
+	return Limit{Rate: float64(n) / period.Seconds(), Burst: n}
+}
+
+// Store keeps buckets, memory store serves single instance,
+// instances behind a balancer plug in a shared implementation
+type Store interface {
+	// Take removes token from bucket of the key, when the bucket is empty
+	// it returns false and time until next token
+	Take(ctx context.Context, key string, limit Limit) (ok bool, retryAfter time.Duration, err error)
+	// Reset forgets bucket of the key
+	Reset(ctx context.Context, key string) error
+}
+
+type bucket struct {
+	limit   Limit
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps buckets in process memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	swept   time.Time
+}
+
+// NewMemoryStore creates empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// sweepInterval is how often full buckets are dropped from memory
+const sweepInterval = time.Minute
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.swept) > sweepInterval {
+		s.sweep(now)
+		s.swept = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	if limit.Rate <= 0 {
+		return false, time.Hour, nil
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets, key)
+	return nil
+}
+
+// sweep drops buckets which are full again, they are equal to missing ones
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Lockout is progressive lock of an account after repeated failed logins
+type Lockout struct {
+	// Threshold is number of failures which locks the account
+	Threshold int
+	// Base is lock duration at threshold, it doubles on every next failure
+	Base time.Duration
+	// Max caps lock duration
+	Max time.Duration
+}
+
+// DefaultLockout locks for a minute after 5 failures, up to a day
+var DefaultLockout = Lockout{Threshold: 5, Base: time.Minute, Max: 24 * time.Hour}
+
+// Duration returns lock duration after failures in a row, zero when not locked
+func (l Lockout) Duration(failures int) time.Duration {
+	if l.Threshold <= 0 || failures < l.Threshold {
+		return 0
+	}
+	d := l.Base
+	for i := l.Threshold; i < failures; i++ {
+		d *= 2
+		if d >= l.Max {
+			return l.Max
+		}
+	}
+	return d
+}
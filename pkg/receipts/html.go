@@ -0,0 +1,66 @@
+package receipts
+
+import (
+	"html/template"
+	"io"
+)
+
+var htmlTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"amount": formatAmount,
+	"rate":   formatRate,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 14px; color: #222; max-width: 800px; margin: 2em auto; }
+h1 { font-size: 22px; margin-bottom: 0; }
+table { width: 100%; border-collapse: collapse; margin-top: 1.5em; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.num { text-align: right; white-space: nowrap; }
+.parties { display: flex; justify-content: space-between; margin-top: 1.5em; }
+.totals td { border: none; }
+.totals tr:last-child td { font-weight: bold; border-top: 2px solid #222; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>{{.Seller.Name}}</h1>
+<div>{{.Seller.Address}}</div>
+{{if .Seller.TaxID}}<div>Tax ID: {{.Seller.TaxID}}</div>{{end}}
+{{if .Seller.Phone}}<div>Phone: {{.Seller.Phone}}</div>{{end}}
+<div class="parties">
+<div>
+<strong>Invoice {{.Number}}</strong><br>
+Date: {{.Issued.Format "2006-01-02 15:04"}}<br>
+Sale: {{.SaleID}}
+</div>
+<div>
+<strong>Customer</strong><br>
+{{.Customer.Name}}<br>
+{{.Customer.Phone}}<br>
+Manager: {{.Manager.Name}}
+</div>
+</div>
+<table>
+<thead>
+<tr><th>#</th><th>Item</th><th class="num">Qty</th><th class="num">Price</th><th class="num">Tax</th><th class="num">Rate</th><th class="num">Amount</th></tr>
+</thead>
+<tbody>
+{{range .Lines}}<tr><td>{{.Position}}</td><td>{{.Name}}{{if .SKU}}<br><small>{{.SKU}}</small>{{end}}</td><td class="num">{{.Qty}}</td><td class="num">{{amount $.Currency .Price}}</td><td class="num">{{amount $.Currency .Tax}}</td><td class="num">{{rate .TaxRate}}</td><td class="num">{{amount $.Currency .Amount}}</td></tr>
+{{end}}</tbody>
+</table>
+<table class="totals">
+<tr><td class="num">Subtotal</td><td class="num">{{amount .Currency .Subtotal}} {{.Currency}}</td></tr>
+{{range .Taxes}}<tr><td class="num">Tax {{rate .Rate}} of {{amount $.Currency .Net}}</td><td class="num">{{amount $.Currency .Tax}} {{$.Currency}}</td></tr>
+{{end}}
+<tr><td class="num">Total</td><td class="num">{{amount .Currency .Total}} {{.Currency}}</td></tr>
+</table>
+</body>
+</html>
+`))
+
+func writeHTML(w io.Writer, receipt *Receipt) error {
+	return htmlTemplate.Execute(w, receipt)
+}
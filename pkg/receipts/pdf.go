@@ -0,0 +1,269 @@
+package receipts
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Receipts are A4 PDF documents written with standard fonts, nothing is
+// embedded. Standard fonts have Windows-1252 glyphs only, Cyrillic is
+// transliterated and other characters are replaced with question marks.
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 50
+	// monoWidth is advance of Courier glyphs in thousandths of font size,
+	// amounts are set in Courier so they can be aligned right
+	monoWidth = 600
+)
+
+// Fonts of the document
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+	fontMono    = "F3"
+)
+
+// right edges of table columns
+var (
+	columnQty    = 330.0
+	columnPrice  = 405.0
+	columnTax    = 475.0
+	columnAmount = float64(pageWidth - margin)
+)
+
+func writePDF(w io.Writer, receipt *Receipt) error {
+	doc := &pdfDocument{}
+	doc.addPage()
+
+	doc.text(fontBold, 16, margin, doc.y, receipt.Seller.Name)
+	doc.y -= 18
+	for _, line := range []string{receipt.Seller.Address, prefixed("Tax ID: ", receipt.Seller.TaxID), prefixed("Phone: ", receipt.Seller.Phone)} {
+		if line != "" {
+			doc.text(fontRegular, 10, margin, doc.y, line)
+			doc.y -= 13
+		}
+	}
+	doc.y -= 12
+	top := doc.y
+	doc.text(fontBold, 12, margin, doc.y, "Invoice "+receipt.Number)
+	doc.text(fontRegular, 10, margin, doc.y-15, "Date: "+receipt.Issued.Format("2006-01-02 15:04"))
+	doc.text(fontRegular, 10, margin, doc.y-28, "Sale: "+strconv.FormatInt(receipt.SaleID, 10))
+	doc.text(fontBold, 10, 330, top, "Customer")
+	doc.text(fontRegular, 10, 330, top-15, receipt.Customer.Name)
+	doc.text(fontRegular, 10, 330, top-28, receipt.Customer.Phone)
+	doc.text(fontRegular, 10, 330, top-41, "Manager: "+receipt.Manager.Name)
+	doc.y -= 70
+
+	doc.tableHeader()
+	for _, line := range receipt.Lines {
+		height := 14.0
+		if line.SKU != "" {
+			height = 24
+		}
+		if doc.y-height < margin+20 {
+			doc.addPage()
+			doc.tableHeader()
+		}
+		doc.text(fontRegular, 10, margin, doc.y, strconv.Itoa(line.Position))
+		doc.text(fontRegular, 10, margin+20, doc.y, truncate(line.Name, 42))
+		if line.SKU != "" {
+			doc.text(fontRegular, 8, margin+20, doc.y-10, line.SKU)
+		}
+		doc.number(columnQty, doc.y, strconv.FormatInt(line.Qty, 10))
+		doc.number(columnPrice, doc.y, formatAmount(receipt.Currency, line.Price))
+		doc.number(columnTax, doc.y, formatAmount(receipt.Currency, line.Tax))
+		doc.number(columnAmount, doc.y, formatAmount(receipt.Currency, line.Amount))
+		doc.y -= height
+	}
+
+	if doc.y < margin+80 {
+		doc.addPage()
+	}
+	doc.rule(doc.y + 8)
+	doc.y -= 10
+	type total struct {
+		label  string
+		amount int64
+	}
+	totals := []total{{"Subtotal", receipt.Subtotal}}
+	for _, tax := range receipt.Taxes {
+		totals = append(totals, total{"Tax " + formatRate(tax.Rate) + " of " + formatAmount(receipt.Currency, tax.Net), tax.Tax})
+	}
+	totals = append(totals, total{"Total", receipt.Total})
+	for i, item := range totals {
+		font := fontRegular
+		if i == len(totals)-1 {
+			font = fontBold
+		}
+		if doc.y < margin+20 {
+			doc.addPage()
+		}
+		doc.text(font, 10, columnPrice-110, doc.y, item.label)
+		doc.number(columnAmount, doc.y, strings.TrimSpace(formatAmount(receipt.Currency, item.amount)+" "+receipt.Currency))
+		doc.y -= 15
+	}
+	return doc.writeTo(w)
+}
+
+func prefixed(prefix string, value string) string {
+	if value == "" {
+		return ""
+	}
+	return prefix + value
+}
+
+// truncate cuts text to n characters
+func truncate(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:n-3]) + "..."
+}
+
+// pdfDocument keeps content streams of pages, y is baseline of the next
+// line on the last page
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (d *pdfDocument) addPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - margin
+}
+
+func (d *pdfDocument) tableHeader() {
+	d.text(fontBold, 10, margin, d.y, "#")
+	d.text(fontBold, 10, margin+20, d.y, "Item")
+	for _, column := range []struct {
+		right float64
+		title string
+	}{{columnQty, "Qty"}, {columnPrice, "Price"}, {columnTax, "Tax"}, {columnAmount, "Amount"}} {
+		d.text(fontBold, 10, column.right-textWidth(column.title, 10, 560), d.y, column.title)
+	}
+	d.rule(d.y - 5)
+	d.y -= 20
+}
+
+// text shows text with baseline at x, y
+func (d *pdfDocument) text(font string, size float64, x float64, y float64, text string) {
+	page := d.pages[len(d.pages)-1]
+	fmt.Fprintf(page, "BT /%s %s Tf %s %s Td (", font, formatFloat(size), formatFloat(x), formatFloat(y))
+	page.Write(pdfString(text))
+	page.WriteString(") Tj ET\n")
+}
+
+// number shows text in Courier with its end at right
+func (d *pdfDocument) number(right float64, y float64, text string) {
+	d.text(fontMono, 10, right-textWidth(text, 10, monoWidth), y, text)
+}
+
+// rule draws horizontal line across the page
+func (d *pdfDocument) rule(y float64) {
+	fmt.Fprintf(d.pages[len(d.pages)-1], "0.5 w %d %s m %d %s l S\n", margin, formatFloat(y), pageWidth-margin, formatFloat(y))
+}
+
+// writeTo writes objects of the document followed by cross-reference table
+// of their offsets
+func (d *pdfDocument) writeTo(w io.Writer) error {
+	out := &bytes.Buffer{}
+	offsets := make([]int, 0)
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	stream := func(content []byte) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(out, "%d 0 obj\n<< /Length %d >>\nstream\n", len(offsets), len(content))
+		out.Write(content)
+		out.WriteString("\nendstream\nendobj\n")
+	}
+
+	// catalog, pages and three fonts precede page objects and their contents
+	const firstPage = 6
+	kids := &bytes.Buffer{}
+	for i := range d.pages {
+		fmt.Fprintf(kids, "%d 0 R ", firstPage+i*2)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(d.pages)))
+	for _, font := range []string{"Helvetica", "Helvetica-Bold", "Courier"} {
+		object("<< /Type /Font /Subtype /Type1 /BaseFont /" + font + " /Encoding /WinAnsiEncoding >>")
+	}
+	for i, page := range d.pages {
+		footer := "Page " + strconv.Itoa(i+1) + " of " + strconv.Itoa(len(d.pages))
+		fmt.Fprintf(page, "BT /%s 8 Tf %s %d Td (%s) Tj ET\n", fontRegular, formatFloat(pageWidth-margin-textWidth(footer, 8, 556)), margin/2, footer)
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /%s 3 0 R /%s 4 0 R /%s 5 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, fontMono, firstPage+i*2+1))
+		stream(page.Bytes())
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// textWidth estimates width of text with average glyph advance in
+// thousandths of font size, it is exact for Courier
+func textWidth(text string, size float64, advance float64) float64 {
+	return float64(utf8.RuneCountInString(text)) * advance * size / 1000
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// pdfString encodes text in Windows-1252 escaping delimiters of PDF strings
+func pdfString(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			out = append(out, '\\', byte(r))
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		case r == '€':
+			out = append(out, 0x80)
+		case r == '—' || r == '–':
+			out = append(out, '-')
+		default:
+			if latin, ok := cyrillic[r]; ok {
+				out = append(out, latin...)
+			} else if latin, ok := cyrillic[unicode.ToLower(r)]; ok {
+				out = append(out, capitalize(latin)...)
+			} else {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
+
+func capitalize(s string) string {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return s
+	}
+	return string(s[0]-'a'+'A') + s[1:]
+}
+
+// cyrillic transliterates lower case letters of Russian and Tajik alphabets
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'ғ': "gh", 'ӣ': "i", 'қ': "q", 'ӯ': "u", 'ҳ': "h", 'ҷ': "j",
+}
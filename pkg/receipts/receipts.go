@@ -0,0 +1,138 @@
+// Package receipts renders invoices of sales as HTML and PDF. Sales are
+// numbered without gaps when they are made, receipts are built from stored
+// positions every time they are requested, so they can be downloaded again.
+package receipts
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/money"
+)
+
+// Formats of receipts
+const (
+	FormatPDF  = "pdf"
+	FormatHTML = "html"
+)
+
+var ErrUnknownFormat = apperr.New(apperr.KindInvalid, "unknown_format", "format must be pdf or html")
+
+// DefaultPrefix is put before invoice numbers when config has none
+const DefaultPrefix = "INV-"
+
+// Seller is shown in the header of receipts
+type Seller struct {
+	Name    string
+	Address string
+	TaxID   string
+	Phone   string
+}
+
+// Config of receipts
+type Config struct {
+	Seller   Seller
+	Prefix   string
+	Location *time.Location
+}
+
+// Party is customer or manager of the sale
+type Party struct {
+	ID    int64
+	Name  string
+	Phone string
+}
+
+// Line of receipt is a sale position, amounts are in minor units, Amount
+// is paid by customer and includes Tax at TaxRate in basis points
+type Line struct {
+	Position int
+	SKU      string
+	Name     string
+	Qty      int64
+	Price    int64
+	TaxRate  int
+	Tax      int64
+	Amount   int64
+}
+
+// TaxTotal sums lines taxed at the rate, Net is their amount without tax
+type TaxTotal struct {
+	Rate int
+	Net  int64
+	Tax  int64
+}
+
+// Receipt of a sale, Total is what customer paid and includes Tax, Taxes
+// are totals by rate in ascending order. Positions of a sale share Currency.
+type Receipt struct {
+	Number   string
+	SaleID   int64
+	Issued   time.Time
+	Seller   Seller
+	Customer Party
+	Manager  Party
+	Lines    []*Line
+	Taxes    []*TaxTotal
+	Subtotal int64
+	Tax      int64
+	Total    int64
+	Currency string
+}
+
+// Write renders receipt in the format
+func Write(w io.Writer, format string, receipt *Receipt) error {
+	switch format {
+	case FormatPDF:
+		return writePDF(w, receipt)
+	case FormatHTML:
+		return writeHTML(w, receipt)
+	}
+	return ErrUnknownFormat
+}
+
+// ContentType returns media type of the format
+func ContentType(format string) string {
+	if format == FormatHTML {
+		return "text/html; charset=utf-8"
+	}
+	return "application/pdf"
+}
+
+// formatNumber returns invoice number with prefix, e.g. INV-000042
+func formatNumber(prefix string, number int64) string {
+	digits := strconv.FormatInt(number, 10)
+	if len(digits) < 6 {
+		digits = strings.Repeat("0", 6-len(digits)) + digits
+	}
+	return prefix + digits
+}
+
+// formatAmount returns minor units as decimal of the currency with thousands
+// separated by spaces, e.g. 1 234.50
+func formatAmount(currency string, amount int64) string {
+	units, fraction := money.Format(amount, currency), ""
+	sign := ""
+	if strings.HasPrefix(units, "-") {
+		sign, units = "-", units[1:]
+	}
+	if i := strings.IndexByte(units, '.'); i >= 0 {
+		units, fraction = units[:i], units[i:]
+	}
+	for i := len(units) - 3; i > 0; i -= 3 {
+		units = units[:i] + " " + units[i:]
+	}
+	return sign + units + fraction
+}
+
+// formatRate returns basis points as percent, e.g. 12.5%
+func formatRate(rate int) string {
+	percent := strconv.Itoa(rate / 100)
+	if fraction := rate % 100; fraction != 0 {
+		percent += "." + strings.TrimSuffix(strconv.Itoa(100 + fraction)[1:], "0")
+	}
+	return percent + "%"
+}
@@ -0,0 +1,103 @@
+package receipts
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+var ErrNotFound = apperr.New(apperr.KindNotFound, "sale_not_found", "sale not found")
+
+// Service builds receipts of stored sales
+type Service struct {
+	pool   *pgxpool.Pool
+	config *Config
+}
+
+func NewService(pool *pgxpool.Pool, config *Config) *Service {
+	if config.Prefix == "" {
+		config.Prefix = DefaultPrefix
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	return &Service{pool: pool, config: config}
+}
+
+// Receipt returns receipt of the sale, customerID other than zero limits
+// sales to purchases of the customer
+func (s *Service) Receipt(ctx context.Context, saleID int64, customerID int64) (receipt *Receipt, err error) {
+	ctx, span := tracing.Start(ctx, "receipts.Receipt")
+	defer tracing.End(span, &err)
+
+	receipt = &Receipt{
+		SaleID: saleID,
+		Seller: s.config.Seller,
+		Lines:  make([]*Line, 0),
+		Taxes:  make([]*TaxTotal, 0),
+	}
+	var number int64
+	err = s.pool.QueryRow(ctx, `
+		SELECT s.number, s.created, c.id, c.name, c.phone, m.id, m.name
+			FROM sales s
+			JOIN customers c ON c.id = s.customer_id
+			JOIN managers m ON m.id = s.manager_id
+			WHERE s.id = $1 AND ($2::bigint = 0 OR s.customer_id = $2)`, saleID, customerID).Scan(
+		&number, &receipt.Issued, &receipt.Customer.ID, &receipt.Customer.Name, &receipt.Customer.Phone,
+		&receipt.Manager.ID, &receipt.Manager.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	receipt.Number = formatNumber(s.config.Prefix, number)
+	// stored times are UTC
+	receipt.Issued = receipt.Issued.In(s.config.Location)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT COALESCE(p.sku, ''), p.name, sp.qty, sp.price, sp.currency, sp.tax_rate, sp.tax, sp.total
+			FROM sale_positions sp JOIN products p ON p.id = sp.product_id
+			WHERE sp.sale_id = $1
+			ORDER BY sp.id`, saleID)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer rows.Close()
+	rates := make(map[int]*TaxTotal)
+	for rows.Next() {
+		line := &Line{Position: len(receipt.Lines) + 1}
+		err = rows.Scan(&line.SKU, &line.Name, &line.Qty, &line.Price, &receipt.Currency, &line.TaxRate, &line.Tax, &line.Amount)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		receipt.Lines = append(receipt.Lines, line)
+		receipt.Total += line.Amount
+		receipt.Tax += line.Tax
+
+		total, ok := rates[line.TaxRate]
+		if !ok {
+			total = &TaxTotal{Rate: line.TaxRate}
+			rates[line.TaxRate] = total
+			receipt.Taxes = append(receipt.Taxes, total)
+		}
+		total.Net += line.Amount - line.Tax
+		total.Tax += line.Tax
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	receipt.Subtotal = receipt.Total - receipt.Tax
+	sort.Slice(receipt.Taxes, func(i, j int) bool {
+		return receipt.Taxes[i].Rate < receipt.Taxes[j].Rate
+	})
+	return receipt, nil
+}
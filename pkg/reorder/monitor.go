@@ -0,0 +1,153 @@
+package reorder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/metrics"
+	"github.com/darkside1809/gosql/pkg/notify"
+)
+
+// DefaultCheckInterval is interval between checks of Monitor
+const DefaultCheckInterval = 15 * time.Minute
+
+var alertsTotal = metrics.Default.Counter("gosql_low_stock_alerts_total", "Products administrators were notified of as below reorder threshold.")
+
+// Monitor notifies active administrators of products whose available stock
+// fell below reorder threshold. Product is alerted once until its stock is
+// back above the threshold, several instances may run at once.
+type Monitor struct {
+	svc      *Service
+	notifier notify.Notifier
+	interval time.Duration
+}
+
+func NewMonitor(svc *Service, notifier notify.Notifier, interval time.Duration) *Monitor {
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	return &Monitor{svc: svc, notifier: notifier, interval: interval}
+}
+
+// Run checks stock until ctx is done
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		_, err := m.Check(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Default().Error("reorder.Monitor", logger.Err(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check notifies of products which fell below threshold since the last
+// check once and returns their number
+func (m *Monitor) Check(ctx context.Context) (int, error) {
+	pool := m.svc.pool
+	_, err := pool.Exec(ctx, `
+		UPDATE products p SET reorder_alerted = NULL
+			WHERE p.reorder_alerted IS NOT NULL
+				AND (NOT p.active OR p.qty - `+held+` >= COALESCE(p.reorder_threshold, $1::bigint))`, m.svc.threshold)
+	if err != nil {
+		return 0, err
+	}
+
+	// products are claimed before notifying, so other instances skip them
+	rows, err := pool.Query(ctx, `
+		UPDATE products p SET reorder_alerted = CURRENT_TIMESTAMP
+			WHERE p.active AND p.reorder_alerted IS NULL
+				AND p.qty - `+held+` < COALESCE(p.reorder_threshold, $1::bigint)
+			RETURNING p.id`, m.svc.threshold)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	err = m.notify(ctx, ids)
+	if err != nil {
+		// alerts are sent again by the next check
+		_, resetErr := pool.Exec(ctx, `UPDATE products SET reorder_alerted = NULL WHERE id = ANY($1)`, ids)
+		if resetErr != nil {
+			logger.Default().Error("reorder.Monitor", logger.Err(resetErr))
+		}
+		return 0, err
+	}
+	alertsTotal.Add(float64(len(ids)))
+	return len(ids), nil
+}
+
+// notify sends suggestions of the products to every active administrator
+func (m *Monitor) notify(ctx context.Context, ids []int64) error {
+	items, err := m.svc.query(ctx, m.svc.pool, `p.id = ANY($4::bigint[])`, DefaultDays, DefaultCoverDays, len(ids), ids)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		name := item.Name
+		if item.SKU != "" {
+			name = item.SKU + " " + name
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d available, threshold %d, order %d", name, item.Available, item.Threshold, item.Suggested))
+	}
+	body := strings.Join(lines, "\n")
+
+	rows, err := m.svc.pool.Query(ctx, `SELECT phone FROM managers WHERE is_admin AND active ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	phones := make([]string, 0)
+	for rows.Next() {
+		var phone string
+		err = rows.Scan(&phone)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		phones = append(phones, phone)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, phone := range phones {
+		err = m.notifier.Notify(ctx, &notify.Message{
+			To:      phone,
+			Subject: fmt.Sprintf("%d products below reorder threshold", len(items)),
+			Body:    body,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Package reorder finds products whose available stock is below their
+// reorder threshold or runs out sooner than new stock arrives, and suggests
+// quantities to order from average daily sales of recent days.
+package reorder
+
+import (
+	"github.com/darkside1809/gosql/pkg/apperr"
+)
+
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+
+const (
+	// DefaultDays of sales the velocity is averaged over
+	DefaultDays = 30
+	// DefaultCoverDays is number of days of sales a reorder covers, about
+	// the time new stock takes to arrive
+	DefaultCoverDays = 14
+	// MaxDays caps both windows, a year
+	MaxDays = 365
+	// MaxSuggestions caps number of suggestions returned at once
+	MaxSuggestions = 500
+)
+
+// Filter of suggestions, zero fields are defaults
+type Filter struct {
+	Days      int
+	CoverDays int
+}
+
+// Suggestion to order Suggested units of the product, so available stock
+// stays above Threshold for CoverDays at Velocity units a day
+type Suggestion struct {
+	ProductID int64  `json:"product_id"`
+	SKU       string `json:"sku,omitempty"`
+	Name      string `json:"name"`
+	Qty       int    `json:"qty"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+	Threshold int    `json:"threshold"`
+	// Sold units in the last Days
+	Sold     int     `json:"sold"`
+	Velocity float64 `json:"velocity"`
+	// DaysLeft until available stock runs out, missing when nothing was sold
+	DaysLeft  *float64 `json:"days_left,omitempty"`
+	Suggested int      `json:"suggested"`
+}
+
+// suggest fills velocity, days left and suggested quantity from sales of days
+func (item *Suggestion) suggest(days int, cover int) {
+	item.Available = item.Qty - item.Reserved
+	item.Velocity = float64(item.Sold) / float64(days)
+	if item.Sold > 0 {
+		left := float64(item.Available) / item.Velocity
+		item.DaysLeft = &left
+	}
+	// sales of cover days rounded up, on top of the threshold
+	need := item.Threshold + (item.Sold*cover+days-1)/days
+	item.Suggested = 0
+	if need > item.Available {
+		item.Suggested = need - item.Available
+	}
+}
+
+// held is quantity of product p held by active reservations
+const held = `COALESCE((
+		SELECT SUM(r.qty) FROM reservations r
+			WHERE r.product_id = p.id AND r.status = 'active' AND r.expires > CURRENT_TIMESTAMP
+	), 0)::bigint`
+
+// query selects active products with their stock, reservations, threshold
+// and sales, soonest to run out first. $1 is default threshold, $2 days of
+// sales, $3 limit and %s is condition on columns of p, it may use $4.
+const query = `
+	SELECT p.id, COALESCE(p.sku, ''), p.name, p.qty, p.held, p.threshold, p.sold FROM (
+			SELECT p.id, p.sku, p.name, p.qty, COALESCE(p.reorder_threshold, $1::bigint) AS threshold,
+				` + held + ` AS held,
+				COALESCE((
+					SELECT SUM(sp.qty) FROM sale_positions sp JOIN sales s ON s.id = sp.sale_id
+						WHERE sp.product_id = p.id AND s.created > CURRENT_TIMESTAMP - $2::int * INTERVAL '1 day'
+				), 0)::bigint AS sold
+				FROM products p
+				WHERE p.active
+		) p
+		WHERE %s
+		ORDER BY (p.qty - p.held)::float8 / NULLIF(p.sold, 0) NULLS LAST, p.qty - p.held - p.threshold, p.id
+		LIMIT $3::int`
@@ -0,0 +1,93 @@
+package reorder
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/darkside1809/gosql/pkg/validate"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// DefaultThreshold is stock below which products without reorder threshold
+// are reordered, the same as low stock threshold of managers
+const DefaultThreshold = 10
+
+// Service suggests reorders of products
+type Service struct {
+	pool      *pgxpool.Pool
+	threshold int
+}
+
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool, threshold: DefaultThreshold}
+}
+
+// SetDefaultThreshold changes threshold of products without reorder threshold
+func (s *Service) SetDefaultThreshold(threshold int) {
+	s.threshold = threshold
+}
+
+// Suggestions returns products below their threshold or selling out within
+// cover days of the filter, soonest to run out first
+func (s *Service) Suggestions(ctx context.Context, filter *Filter) (items []*Suggestion, err error) {
+	ctx, span := tracing.Start(ctx, "reorder.Suggestions")
+	defer tracing.End(span, &err)
+
+	details := make([]apperr.Detail, 0)
+	if filter.Days < 0 || filter.Days > MaxDays {
+		details = append(details, apperr.Detail{Field: "days", Rule: "max", Message: "must be from 1 to 365"})
+	}
+	if filter.CoverDays < 0 || filter.CoverDays > MaxDays {
+		details = append(details, apperr.Detail{Field: "cover_days", Rule: "max", Message: "must be from 1 to 365"})
+	}
+	if len(details) != 0 {
+		return nil, validate.ErrFailed.WithDetails(details...)
+	}
+	days, cover := filter.Days, filter.CoverDays
+	if days == 0 {
+		days = DefaultDays
+	}
+	if cover == 0 {
+		cover = DefaultCoverDays
+	}
+	// available stock lasts less than cover days when it is below sales of cover days
+	condition := `p.qty - p.held < p.threshold OR (p.qty - p.held) * $2::int < p.sold * $4::int`
+	items, err = s.query(ctx, s.pool, condition, days, cover, MaxSuggestions, cover)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return items, nil
+}
+
+// Querier is a pool or a transaction
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// query returns suggestions of products matching the condition, arg is $4
+func (s *Service) query(ctx context.Context, db Querier, condition string, days int, cover int, limit int, arg interface{}) ([]*Suggestion, error) {
+	rows, err := db.Query(ctx, fmt.Sprintf(query, condition), s.threshold, days, limit, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Suggestion, 0)
+	for rows.Next() {
+		item := &Suggestion{}
+		err = rows.Scan(&item.ProductID, &item.SKU, &item.Name, &item.Qty, &item.Reserved, &item.Threshold, &item.Sold)
+		if err != nil {
+			return nil, err
+		}
+		item.suggest(days, cover)
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
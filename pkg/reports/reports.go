@@ -0,0 +1,267 @@
+// Package reports aggregates sales for managers: revenue, units and average
+// order value over time and by manager, department, product or customer.
+// Sales are stored in UTC, periods and date filters follow the timezone of the report.
+// Amounts of every currency are converted into the currency of the report at
+// exchange rates effective at the end of the range.
+package reports
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/money"
+	"github.com/darkside1809/gosql/pkg/validate"
+)
+
+// Intervals of time series
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// Dimensions of grouped reports
+const (
+	DimensionManager    = "manager"
+	DimensionDepartment = "department"
+	DimensionProduct    = "product"
+	DimensionCustomer   = "customer"
+)
+
+// Orders of groups
+const (
+	OrderRevenue = "revenue"
+	OrderUnits   = "units"
+	OrderOrders  = "orders"
+)
+
+const (
+	// DefaultDays is length of the range when filter has no from
+	DefaultDays = 30
+	// MaxDays caps length of the range
+	MaxDays = 366 * 3
+	// DefaultLimit is number of groups returned when filter has no limit
+	DefaultLimit = 10
+	// MaxLimit caps number of groups
+	MaxLimit = 500
+)
+
+const dateLayout = "2006-01-02"
+
+// Filter of reports, To is exclusive
+type Filter struct {
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+	Interval string
+	// Compare adds previous period of the same length
+	Compare bool
+	Order   string
+	Limit   int
+	// Currency of amounts, default currency of the service when empty
+	Currency string
+}
+
+// previous returns start of the period preceding the filter
+func (f *Filter) previous() time.Time {
+	return f.From.Add(-f.To.Sub(f.From))
+}
+
+// Metrics of sales in currency of the report. Revenue is paid by customers
+// and includes Tax, Net is revenue without tax.
+type Metrics struct {
+	Revenue money.Money `json:"revenue"`
+	Tax     money.Money `json:"tax"`
+	Net     money.Money `json:"net"`
+	Units   int64       `json:"units"`
+	Orders  int64       `json:"orders"`
+	// AverageOrder is revenue per order rounded to minor unit
+	AverageOrder money.Money `json:"average_order"`
+}
+
+func newMetrics(currency string, revenue int64, tax int64, units int64, orders int64) Metrics {
+	m := Metrics{
+		Revenue:      money.New(revenue, currency),
+		Tax:          money.New(tax, currency),
+		Net:          money.New(revenue-tax, currency),
+		Units:        units,
+		Orders:       orders,
+		AverageOrder: money.New(0, currency),
+	}
+	if orders != 0 {
+		m.AverageOrder.Amount = revenue/orders + (revenue%orders*2)/orders
+	}
+	return m
+}
+
+// Comparison of the period with previous one, changes are percents and
+// missing when previous value is zero
+type Comparison struct {
+	Previous           Metrics  `json:"previous"`
+	RevenueChange      *float64 `json:"revenue_change,omitempty"`
+	TaxChange          *float64 `json:"tax_change,omitempty"`
+	UnitsChange        *float64 `json:"units_change,omitempty"`
+	OrdersChange       *float64 `json:"orders_change,omitempty"`
+	AverageOrderChange *float64 `json:"average_order_change,omitempty"`
+}
+
+func newComparison(current Metrics, previous Metrics) *Comparison {
+	return &Comparison{
+		Previous:           previous,
+		RevenueChange:      change(current.Revenue.Amount, previous.Revenue.Amount),
+		TaxChange:          change(current.Tax.Amount, previous.Tax.Amount),
+		UnitsChange:        change(current.Units, previous.Units),
+		OrdersChange:       change(current.Orders, previous.Orders),
+		AverageOrderChange: change(current.AverageOrder.Amount, previous.AverageOrder.Amount),
+	}
+}
+
+func change(current int64, previous int64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	percent := float64(current-previous) * 100 / float64(previous)
+	// two decimals are enough for dashboards
+	percent = float64(int64(percent*100)) / 100
+	return &percent
+}
+
+// Bucket of time series, Period is local date the period starts at
+type Bucket struct {
+	Period  string  `json:"period"`
+	Metrics Metrics `json:"metrics"`
+}
+
+// SalesReport is time series of sales in the range
+type SalesReport struct {
+	From       time.Time   `json:"from"`
+	To         time.Time   `json:"to"`
+	Timezone   string      `json:"timezone"`
+	Currency   string      `json:"currency"`
+	Interval   string      `json:"interval"`
+	Totals     Metrics     `json:"totals"`
+	Comparison *Comparison `json:"comparison,omitempty"`
+	Buckets    []*Bucket   `json:"buckets"`
+}
+
+// Group of sales, ID is zero for departments
+type Group struct {
+	ID         int64       `json:"id,omitempty"`
+	Name       string      `json:"name"`
+	Metrics    Metrics     `json:"metrics"`
+	Comparison *Comparison `json:"comparison,omitempty"`
+}
+
+// GroupReport is top groups of sales in the range
+type GroupReport struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Timezone  string    `json:"timezone"`
+	Currency  string    `json:"currency"`
+	Dimension string    `json:"dimension"`
+	Order     string    `json:"order"`
+	Groups    []*Group  `json:"groups"`
+}
+
+// ParseFilter reads filter from query of the request. from and to are dates
+// in tz or RFC 3339 times, to date is inclusive, range is last 30 days by default.
+// currency is ISO 4217 code amounts are converted into.
+func ParseFilter(query url.Values) (*Filter, error) {
+	filter := &Filter{
+		Location: time.UTC,
+		Interval: IntervalDay,
+		Order:    OrderRevenue,
+		Limit:    DefaultLimit,
+	}
+	details := make([]apperr.Detail, 0)
+
+	if tz := query.Get("tz"); tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil || tz == "Local" {
+			details = append(details, apperr.Detail{Field: "tz", Rule: "timezone", Message: "must be IANA timezone, e.g. Asia/Dushanbe"})
+		} else {
+			filter.Location = location
+		}
+	}
+	parseTime := func(name string, end bool) time.Time {
+		value := query.Get(name)
+		if value == "" {
+			return time.Time{}
+		}
+		if t, err := time.ParseInLocation(dateLayout, value, filter.Location); err == nil {
+			if end {
+				t = t.AddDate(0, 0, 1)
+			}
+			return t
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			details = append(details, apperr.Detail{Field: name, Rule: "date", Message: "must be date YYYY-MM-DD or RFC 3339 time"})
+		}
+		return t
+	}
+	filter.From = parseTime("from", false)
+	filter.To = parseTime("to", true)
+	if filter.To.IsZero() {
+		now := time.Now().In(filter.Location)
+		filter.To = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, filter.Location).AddDate(0, 0, 1)
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.AddDate(0, 0, -DefaultDays)
+	}
+	switch {
+	case !filter.From.Before(filter.To):
+		details = append(details, apperr.Detail{Field: "to", Rule: "min", Message: "must be after from"})
+	case filter.To.Sub(filter.From) > MaxDays*24*time.Hour:
+		details = append(details, apperr.Detail{Field: "from", Rule: "max", Message: "range must be at most " + strconv.Itoa(MaxDays) + " days"})
+	}
+
+	oneOf := func(name string, dst *string, values ...string) {
+		value := query.Get(name)
+		if value == "" {
+			return
+		}
+		for _, item := range values {
+			if item == value {
+				*dst = value
+				return
+			}
+		}
+		details = append(details, apperr.Detail{Field: name, Rule: "oneof", Message: "must be one of " + strings.Join(values, " ")})
+	}
+	oneOf("interval", &filter.Interval, IntervalDay, IntervalWeek, IntervalMonth)
+	oneOf("order", &filter.Order, OrderRevenue, OrderUnits, OrderOrders)
+
+	if value := query.Get("currency"); value != "" {
+		filter.Currency = money.Code(value)
+		if !validate.Currency.MatchString(filter.Currency) {
+			details = append(details, apperr.Detail{Field: "currency", Rule: "currency", Message: "must be ISO 4217 currency code, e.g. USD"})
+		}
+	}
+	if value := query.Get("compare"); value != "" {
+		compare, err := strconv.ParseBool(value)
+		if err != nil {
+			details = append(details, apperr.Detail{Field: "compare", Rule: "type", Message: "must be true or false"})
+		}
+		filter.Compare = compare
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		switch {
+		case err != nil || limit < 1:
+			details = append(details, apperr.Detail{Field: "limit", Rule: "min", Message: "must be positive integer"})
+		case limit > MaxLimit:
+			details = append(details, apperr.Detail{Field: "limit", Rule: "max", Message: "must be at most " + strconv.Itoa(MaxLimit)})
+		default:
+			filter.Limit = limit
+		}
+	}
+
+	if len(details) != 0 {
+		return nil, apperr.ErrBadRequest.WithDetails(details...)
+	}
+	return filter, nil
+}
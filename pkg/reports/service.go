@@ -0,0 +1,263 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/exchange"
+	"github.com/darkside1809/gosql/pkg/money"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+
+// dimension describes how sales are grouped, expressions are constants
+// chosen by name, values of the filter are always parameters
+type dimension struct {
+	key  string
+	name string
+	join string
+}
+
+var dimensions = map[string]dimension{
+	DimensionManager:    {key: "m.id", name: "m.name", join: "JOIN managers m ON m.id = s.manager_id"},
+	DimensionDepartment: {key: "0::bigint", name: "COALESCE(m.department, '')", join: "JOIN managers m ON m.id = s.manager_id"},
+	DimensionProduct:    {key: "p.id", name: "p.name", join: "JOIN products p ON p.id = sp.product_id"},
+	DimensionCustomer:   {key: "c.id", name: "c.name", join: "JOIN customers c ON c.id = s.customer_id"},
+}
+
+// orderColumns are positions of metrics of the current period in the group query
+var orderColumns = map[string]string{
+	OrderRevenue: "3",
+	OrderUnits:   "4",
+	OrderOrders:  "5",
+}
+
+// convert joins factors of currencies passed as the last two parameters
+// of a query, amounts are converted with ROUND(amount * f.factor)
+const convert = `JOIN unnest($%d::text[], $%d::text[]::numeric[]) AS f(currency, factor) ON f.currency = sp.currency`
+
+// Service runs reports over sales
+type Service struct {
+	pool *pgxpool.Pool
+	// currency of reports which filter has no currency
+	currency string
+}
+
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool, currency: money.DefaultCurrency}
+}
+
+// SetCurrency sets ISO 4217 currency of reports by default
+func (s *Service) SetCurrency(currency string) {
+	s.currency = money.Code(currency)
+}
+
+// Sales returns totals and time series of the range in buckets of the interval,
+// buckets without sales are present with zero metrics
+func (s *Service) Sales(ctx context.Context, filter *Filter) (report *SalesReport, err error) {
+	ctx, span := tracing.Start(ctx, "reports.Sales")
+	defer tracing.End(span, &err)
+
+	factors, err := s.factors(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	report = &SalesReport{
+		From:     filter.From.In(filter.Location),
+		To:       filter.To.In(filter.Location),
+		Timezone: filter.Location.String(),
+		Currency: factors.Target,
+		Interval: filter.Interval,
+		Buckets:  make([]*Bucket, 0),
+	}
+
+	current, previous, err := s.totals(ctx, filter, factors)
+	if err != nil {
+		return nil, err
+	}
+	report.Totals = current
+	if filter.Compare {
+		report.Comparison = newComparison(current, previous)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		WITH periods AS (
+			SELECT generate_series(date_trunc($1::text, $2::timestamp), $3::timestamp - INTERVAL '1 microsecond', ('1 ' || $1::text)::interval) AS period
+		), lines AS (
+			SELECT date_trunc($1::text, (s.created AT TIME ZONE 'UTC') AT TIME ZONE $4::text) AS period,
+					s.id AS sale_id, ROUND(sp.total * f.factor) AS amount, ROUND(sp.tax * f.factor) AS tax, sp.qty
+				FROM sales s JOIN sale_positions sp ON sp.sale_id = s.id `+fmt.Sprintf(convert, 7, 8)+`
+				WHERE s.created >= $5 AND s.created < $6
+		)
+		SELECT p.period, COALESCE(SUM(l.amount), 0)::bigint, COALESCE(SUM(l.tax), 0)::bigint,
+				COALESCE(SUM(l.qty), 0)::bigint, COUNT(DISTINCT l.sale_id)
+			FROM periods p LEFT JOIN lines l ON l.period = p.period
+			GROUP BY p.period
+			ORDER BY p.period`,
+		filter.Interval, wallClock(filter.From, filter.Location), wallClock(filter.To, filter.Location), filter.Location.String(),
+		filter.From.UTC(), filter.To.UTC(), factors.Currencies, factors.Values)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var period time.Time
+		var revenue, tax, units, orders int64
+		err = rows.Scan(&period, &revenue, &tax, &units, &orders)
+		if err != nil {
+			return nil, queryError(err)
+		}
+		report.Buckets = append(report.Buckets, &Bucket{Period: period.Format(dateLayout), Metrics: newMetrics(factors.Target, revenue, tax, units, orders)})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return report, nil
+}
+
+// totals returns metrics of the range and of the previous period of the same length
+func (s *Service) totals(ctx context.Context, filter *Filter, factors *exchange.Factors) (current Metrics, previous Metrics, err error) {
+	var revenue, tax, units, orders, previousRevenue, previousTax, previousUnits, previousOrders int64
+	err = s.pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(ROUND(sp.total * f.factor)) FILTER (WHERE s.created >= $2), 0)::bigint,
+				COALESCE(SUM(ROUND(sp.tax * f.factor)) FILTER (WHERE s.created >= $2), 0)::bigint,
+				COALESCE(SUM(sp.qty) FILTER (WHERE s.created >= $2), 0)::bigint,
+				COUNT(DISTINCT s.id) FILTER (WHERE s.created >= $2),
+				COALESCE(SUM(ROUND(sp.total * f.factor)) FILTER (WHERE s.created < $2), 0)::bigint,
+				COALESCE(SUM(ROUND(sp.tax * f.factor)) FILTER (WHERE s.created < $2), 0)::bigint,
+				COALESCE(SUM(sp.qty) FILTER (WHERE s.created < $2), 0)::bigint,
+				COUNT(DISTINCT s.id) FILTER (WHERE s.created < $2)
+			FROM sales s JOIN sale_positions sp ON sp.sale_id = s.id `+fmt.Sprintf(convert, 4, 5)+`
+			WHERE s.created >= $1 AND s.created < $3`,
+		s.since(filter), filter.From.UTC(), filter.To.UTC(), factors.Currencies, factors.Values).Scan(
+		&revenue, &tax, &units, &orders, &previousRevenue, &previousTax, &previousUnits, &previousOrders)
+	if err != nil {
+		return Metrics{}, Metrics{}, queryError(err)
+	}
+	return newMetrics(factors.Target, revenue, tax, units, orders), newMetrics(factors.Target, previousRevenue, previousTax, previousUnits, previousOrders), nil
+}
+
+// Groups returns top groups of the dimension ordered by metric of the filter
+func (s *Service) Groups(ctx context.Context, name string, filter *Filter) (report *GroupReport, err error) {
+	ctx, span := tracing.Start(ctx, "reports.Groups")
+	defer tracing.End(span, &err)
+
+	dim, ok := dimensions[name]
+	if !ok {
+		return nil, apperr.ErrBadRequest.WithDetails(apperr.Detail{Field: "dimension", Rule: "oneof", Message: "unknown dimension"})
+	}
+	factors, err := s.factors(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	report = &GroupReport{
+		From:      filter.From.In(filter.Location),
+		To:        filter.To.In(filter.Location),
+		Timezone:  filter.Location.String(),
+		Currency:  factors.Target,
+		Dimension: name,
+		Order:     filter.Order,
+		Groups:    make([]*Group, 0),
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+dim.key+`, `+dim.name+`,
+				COALESCE(SUM(ROUND(sp.total * f.factor)) FILTER (WHERE s.created >= $2), 0)::bigint,
+				COALESCE(SUM(sp.qty) FILTER (WHERE s.created >= $2), 0)::bigint,
+				COUNT(DISTINCT s.id) FILTER (WHERE s.created >= $2),
+				COALESCE(SUM(ROUND(sp.total * f.factor)) FILTER (WHERE s.created < $2), 0)::bigint,
+				COALESCE(SUM(sp.qty) FILTER (WHERE s.created < $2), 0)::bigint,
+				COUNT(DISTINCT s.id) FILTER (WHERE s.created < $2),
+				COALESCE(SUM(ROUND(sp.tax * f.factor)) FILTER (WHERE s.created >= $2), 0)::bigint,
+				COALESCE(SUM(ROUND(sp.tax * f.factor)) FILTER (WHERE s.created < $2), 0)::bigint
+			FROM sales s JOIN sale_positions sp ON sp.sale_id = s.id `+fmt.Sprintf(convert, 5, 6)+` `+dim.join+`
+			WHERE s.created >= $1 AND s.created < $3
+			GROUP BY 1, 2
+			ORDER BY `+orderColumns[filter.Order]+` DESC, 2
+			LIMIT $4`,
+		s.since(filter), filter.From.UTC(), filter.To.UTC(), filter.Limit, factors.Currencies, factors.Values)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Group{}
+		var revenue, tax, units, orders, previousRevenue, previousTax, previousUnits, previousOrders int64
+		err = rows.Scan(&item.ID, &item.Name, &revenue, &units, &orders, &previousRevenue, &previousUnits, &previousOrders, &tax, &previousTax)
+		if err != nil {
+			return nil, queryError(err)
+		}
+		item.Metrics = newMetrics(factors.Target, revenue, tax, units, orders)
+		if filter.Compare {
+			item.Comparison = newComparison(item.Metrics, newMetrics(factors.Target, previousRevenue, previousTax, previousUnits, previousOrders))
+		}
+		report.Groups = append(report.Groups, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return report, nil
+}
+
+// factors returns factors into currency of the filter from rates effective
+// at the end of the range, or now when it ends in the future. Returns
+// exchange.ErrNoRate when sales of the range have currency without rate.
+func (s *Service) factors(ctx context.Context, filter *Filter) (*exchange.Factors, error) {
+	currency := filter.Currency
+	if currency == "" {
+		currency = s.currency
+	}
+	at := filter.To
+	if now := time.Now(); at.After(now) {
+		at = now
+	}
+	factors, err := exchange.LoadFactors(ctx, s.pool, currency, at)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	var currencies []string
+	err = s.pool.QueryRow(ctx, `
+		SELECT COALESCE(array_agg(DISTINCT sp.currency), '{}')
+			FROM sales s JOIN sale_positions sp ON sp.sale_id = s.id
+			WHERE s.created >= $1 AND s.created < $2`,
+		s.since(filter), filter.To.UTC()).Scan(&currencies)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = factors.Check(currencies)
+	if err != nil {
+		return nil, err
+	}
+	return factors, nil
+}
+
+// queryError returns money.ErrOverflow when sums do not fit bigint
+func queryError(err error) error {
+	if exchange.IsOverflow(err) {
+		return money.ErrOverflow
+	}
+	return ErrInternal.Wrap(err)
+}
+
+// since returns start of sales read by the queries, previous period
+// is read only when it is compared
+func (s *Service) since(filter *Filter) time.Time {
+	if filter.Compare {
+		return filter.previous().UTC()
+	}
+	return filter.From.UTC()
+}
+
+// wallClock returns local time in the location as timestamp without timezone
+func wallClock(t time.Time, location *time.Location) time.Time {
+	local := t.In(location)
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC)
+}
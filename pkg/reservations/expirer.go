@@ -0,0 +1,59 @@
+package reservations
+
+import (
+	"context"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/metrics"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// DefaultExpiryInterval is interval between runs of Expirer
+const DefaultExpiryInterval = time.Minute
+
+var expiredTotal = metrics.Default.Counter("gosql_reservations_expired_total", "Reservations expired by the expirer.")
+
+// Expirer marks active reservations past their expiry as expired. Stock is
+// available again as soon as they expire, the status only keeps lists and
+// reports honest, so several instances may run at once.
+type Expirer struct {
+	pool     *pgxpool.Pool
+	interval time.Duration
+}
+
+func NewExpirer(pool *pgxpool.Pool, interval time.Duration) *Expirer {
+	if interval <= 0 {
+		interval = DefaultExpiryInterval
+	}
+	return &Expirer{pool: pool, interval: interval}
+}
+
+// Run expires reservations until ctx is done
+func (e *Expirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		_, err := e.Expire(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Default().Error("reservations.Expirer", logger.Err(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Expire marks stale reservations once and returns their number
+func (e *Expirer) Expire(ctx context.Context) (int64, error) {
+	tag, err := e.pool.Exec(ctx, `
+		UPDATE reservations SET status = 'expired', updated = CURRENT_TIMESTAMP
+			WHERE status = 'active' AND expires <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	expiredTotal.Add(float64(tag.RowsAffected()))
+	return tag.RowsAffected(), nil
+}
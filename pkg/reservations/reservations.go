@@ -0,0 +1,120 @@
+// Package reservations holds stock of products for pending orders. Reserved
+// quantity stays in qty of the product, it is only unavailable to others
+// until the reservation is converted into a sale, released or expires, so
+// expiry needs no stock update and stale reservations stop counting at once.
+package reservations
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/jackc/pgx/v4"
+)
+
+// Statuses of reservations
+const (
+	StatusActive    = "active"
+	StatusConverted = "converted"
+	StatusReleased  = "released"
+	StatusExpired   = "expired"
+)
+
+const (
+	// DefaultTTL is lifetime of reservations which have no TTL
+	DefaultTTL = 15 * time.Minute
+	// MaxTTL caps lifetime of reservations, a week
+	MaxTTL = 7 * 24 * time.Hour
+)
+
+var ErrNotFound = apperr.New(apperr.KindNotFound, "reservation_not_found", "reservation not found")
+var ErrNotActive = apperr.New(apperr.KindConflict, "reservation_not_active", "reservation is converted, released or expired")
+var ErrUnavailable = apperr.New(apperr.KindUnprocessable, "insufficient_stock", "product is inactive or has not enough available stock")
+var ErrOtherCustomer = apperr.New(apperr.KindUnprocessable, "reservation_of_other_customer", "reservation is held for another customer")
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+
+// Reservation holds Qty of the product given by ProductID or SKU until Expires
+type Reservation struct {
+	ID         int64  `json:"id"`
+	ProductID  int64  `json:"product_id,omitempty" validate:"min=0"`
+	SKU        string `json:"sku,omitempty" validate:"sku"`
+	CustomerID int64  `json:"customer_id,omitempty" validate:"min=0"`
+	ManagerID  int64  `json:"manager_id"`
+	Qty        int    `json:"qty" validate:"required,min=1"`
+	// TTL in seconds of new reservation, DefaultTTL when zero
+	TTL     int       `json:"ttl,omitempty" validate:"min=0,max=604800"`
+	Status  string    `json:"status"`
+	SaleID  int64     `json:"sale_id,omitempty"`
+	Expires time.Time `json:"expires"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Availability of a product, Available is Qty less Reserved
+type Availability struct {
+	ProductID int64 `json:"product_id"`
+	Qty       int   `json:"qty"`
+	Reserved  int   `json:"reserved"`
+	Available int   `json:"available"`
+}
+
+// Filter of reservations, zero fields match every reservation
+type Filter struct {
+	Status     string
+	ProductID  int64
+	CustomerID int64
+}
+
+// columns are selected for Reservation in the order scanned by scan
+const columns = `r.id, r.product_id, COALESCE(p.sku, ''), COALESCE(r.customer_id, 0), r.manager_id, r.qty, r.status, COALESCE(r.sale_id, 0), r.expires, r.created, r.updated`
+
+// scan scans row of columns, extra destinations follow them
+func scan(row pgx.Row, item *Reservation, extra ...interface{}) error {
+	return row.Scan(append([]interface{}{&item.ID, &item.ProductID, &item.SKU, &item.CustomerID, &item.ManagerID, &item.Qty, &item.Status, &item.SaleID,
+		&item.Expires, &item.Created, &item.Updated}, extra...)...)
+}
+
+// Held returns quantity of the product held by active reservations which
+// have not expired, lock the product first so it doesn't change until commit
+func Held(ctx context.Context, tx pgx.Tx, productID int64) (int, error) {
+	held := 0
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(qty), 0)::bigint FROM reservations
+			WHERE product_id = $1 AND status = 'active' AND expires > CURRENT_TIMESTAMP`, productID).Scan(&held)
+	return held, err
+}
+
+// Claim locks active reservation for sale to the customer, it is converted
+// with Convert in the same transaction
+func Claim(ctx context.Context, tx pgx.Tx, id int64, customerID int64) (*Reservation, error) {
+	item := &Reservation{}
+	expired := false
+	// expiry is compared by the server clock, the same that sets it
+	err := scan(tx.QueryRow(ctx, `
+		SELECT `+columns+`, r.expires <= CURRENT_TIMESTAMP FROM reservations r JOIN products p ON p.id = r.product_id
+			WHERE r.id = $1
+			FOR UPDATE OF r`, id), item, &expired)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	if item.Status != StatusActive || expired {
+		return nil, ErrNotActive
+	}
+	if item.CustomerID != 0 && item.CustomerID != customerID {
+		return nil, ErrOtherCustomer
+	}
+	return item, nil
+}
+
+// Convert marks claimed reservation as sold in the sale, quantity it held
+// and the sale did not take returns to available stock
+func Convert(ctx context.Context, tx pgx.Tx, id int64, saleID int64) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE reservations SET status = 'converted', sale_id = $2, updated = CURRENT_TIMESTAMP
+			WHERE id = $1`, id, saleID)
+	return err
+}
@@ -0,0 +1,203 @@
+package reservations
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/darkside1809/gosql/pkg/validate"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// MaxReservations caps number of reservations returned at once
+const MaxReservations = 500
+
+// Service reserves stock of products
+type Service struct {
+	pool *pgxpool.Pool
+	ttl  time.Duration
+}
+
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool, ttl: DefaultTTL}
+}
+
+// SetDefaultTTL sets lifetime of reservations which have no TTL, it is
+// DefaultTTL by default and at most MaxTTL
+func (s *Service) SetDefaultTTL(ttl time.Duration) {
+	if ttl > MaxTTL {
+		ttl = MaxTTL
+	}
+	if ttl > 0 {
+		s.ttl = ttl
+	}
+}
+
+// Reserve holds quantity of the product given by id or SKU when it is
+// active and has enough available stock
+func (s *Service) Reserve(ctx context.Context, item *Reservation) (saved *Reservation, err error) {
+	ctx, span := tracing.Start(ctx, "reservations.Reserve")
+	defer tracing.End(span, &err)
+
+	if item.ProductID == 0 && item.SKU == "" {
+		return nil, validate.ErrFailed.WithDetails(apperr.Detail{Field: "product_id", Rule: "required", Message: "product_id or sku is required"})
+	}
+	ttl := s.ttl
+	if item.TTL != 0 {
+		ttl = time.Duration(item.TTL) * time.Second
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	// product row is locked, so sales and other reservations of it wait
+	var productID int64
+	qty := 0
+	active := false
+	err = tx.QueryRow(ctx, `
+		SELECT id, qty, active FROM products
+			WHERE CASE WHEN $1::bigint <> 0 THEN id = $1 ELSE sku = $2 END
+			FOR UPDATE`, item.ProductID, item.SKU).Scan(&productID, &qty, &active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUnavailable.WithDetails(apperr.Detail{Field: "product_id", Rule: "exists", Message: "product does not exist"})
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	held, err := Held(ctx, tx, productID)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	if !active || qty-held < item.Qty {
+		return nil, ErrUnavailable.WithDetails(apperr.Detail{Field: "qty", Rule: "max", Message: "available " + strconv.Itoa(qty-held)})
+	}
+
+	saved = &Reservation{}
+	err = scan(tx.QueryRow(ctx, `
+		WITH r AS (
+			INSERT INTO reservations(product_id, customer_id, manager_id, qty, expires)
+				VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + $5 * INTERVAL '1 second')
+				RETURNING *
+		)
+		SELECT `+columns+` FROM r JOIN products p ON p.id = r.product_id`,
+		productID, nullID(item.CustomerID), item.ManagerID, item.Qty, int64(ttl/time.Second)), saved)
+	if err == nil {
+		err = audit.Record(ctx, tx, "reservation.create", "reservation", saved.ID, nil, saved)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return saved, nil
+}
+
+// Release returns stock held by active reservation
+func (s *Service) Release(ctx context.Context, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "reservations.Release")
+	defer tracing.End(span, &err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	before := &Reservation{}
+	err = scan(tx.QueryRow(ctx, `
+		SELECT `+columns+` FROM reservations r JOIN products p ON p.id = r.product_id
+			WHERE r.id = $1 FOR UPDATE OF r`, id), before)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	if before.Status != StatusActive {
+		return ErrNotActive
+	}
+	after := *before
+	err = tx.QueryRow(ctx, `
+		UPDATE reservations SET status = 'released', updated = CURRENT_TIMESTAMP
+			WHERE id = $1 RETURNING status, updated`, id).Scan(&after.Status, &after.Updated)
+	if err == nil {
+		err = audit.Record(ctx, tx, "reservation.release", "reservation", id, before, &after)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return ErrInternal.Wrap(err)
+	}
+	return nil
+}
+
+// Reservations returns reservations matching the filter, newest first
+func (s *Service) Reservations(ctx context.Context, filter *Filter) (items []*Reservation, err error) {
+	ctx, span := tracing.Start(ctx, "reservations.Reservations")
+	defer tracing.End(span, &err)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+columns+` FROM reservations r JOIN products p ON p.id = r.product_id
+			WHERE ($1 = '' OR r.status = $1)
+				AND ($2::bigint = 0 OR r.product_id = $2)
+				AND ($3::bigint = 0 OR r.customer_id = $3)
+			ORDER BY r.id DESC LIMIT $4`, filter.Status, filter.ProductID, filter.CustomerID, MaxReservations)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer rows.Close()
+
+	items = make([]*Reservation, 0)
+	for rows.Next() {
+		item := &Reservation{}
+		err = scan(rows, item)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		items = append(items, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return items, nil
+}
+
+// Availability returns stock of the product and quantity held by reservations
+func (s *Service) Availability(ctx context.Context, productID int64) (item *Availability, err error) {
+	ctx, span := tracing.Start(ctx, "reservations.Availability")
+	defer tracing.End(span, &err)
+
+	item = &Availability{ProductID: productID}
+	err = s.pool.QueryRow(ctx, `
+		SELECT p.qty, COALESCE(SUM(r.qty), 0)::bigint FROM products p
+			LEFT JOIN reservations r ON r.product_id = p.id AND r.status = 'active' AND r.expires > CURRENT_TIMESTAMP
+			WHERE p.id = $1
+			GROUP BY p.id`, productID).Scan(&item.Qty, &item.Reserved)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound.WithDetails(apperr.Detail{Field: "id", Rule: "exists", Message: "product does not exist"})
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	item.Available = item.Qty - item.Reserved
+	return item, nil
+}
+
+// nullID returns nil for zero id, so optional references store NULL
+func nullID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
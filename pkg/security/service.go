@@ -5,19 +5,22 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"log"
 	"time"
 
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/logger"
+	"github.com/darkside1809/gosql/pkg/phone"
+	"github.com/darkside1809/gosql/pkg/tracing"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var ErrNotFound = errors.New("item not found")
-var ErrExpired = errors.New("token is expired")
-var ErrInternal = errors.New("internal error")
-var ErrNoSuchUser = errors.New("no such user")
-var ErrInvalidPassword = errors.New("invalid password")
+var ErrNotFound = apperr.New(apperr.KindNotFound, "not_found", "item not found")
+var ErrExpired = apperr.New(apperr.KindUnauthorized, "token_expired", "token is expired")
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+var ErrNoSuchUser = apperr.New(apperr.KindNotFound, "no_such_user", "no such user")
+var ErrInvalidPassword = apperr.New(apperr.KindUnauthorized, "invalid_credentials", "invalid login or password")
 var (
 	ErrStatusNotFound int64 = 404
 	ErrBadRequest int64 = 400
@@ -28,7 +31,7 @@ type Service struct {
 	pool *pgxpool.Pool
 }
 type Token struct {
-	Token string `json:"token"`
+	Token string `json:"token" validate:"required"`
 }
 
 type Responce struct {
@@ -47,8 +50,13 @@ type ResponceFail struct {
 	Reason string `json:"reason"`
 }
 type Auth struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login    string `json:"login" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// Normalize converts login, which is a phone, to E.164 before validation
+func (a *Auth) Normalize() {
+	a.Login = phone.Clean(a.Login)
 }
 
 func NewService(pool *pgxpool.Pool) *Service {
@@ -62,25 +70,27 @@ func (s *Service) Auth(login string, password string) (ok bool) {
 	defer rows.Close()
 
 	if errors.Is(err, pgx.ErrNoRows) {
-		log.Print("Rows not found")
+		logger.FromContext(ctx).Debug("security.Auth: no rows")
 		return false
 	}
 	if !rows.Next() {
 		return false
 	}
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("security.Auth", logger.Err(err))
 		return false
 	}
 	return true
 }
 
 func (s *Service) AuthenticateCustomer(ctx context.Context, token string,) (id int64, err error) {
+	ctx, span := tracing.Start(ctx, "security.AuthenticateCustomer")
+	defer tracing.End(span, &err)
 	expiredTime := time.Now()
 	nowTimeInSec := expiredTime.UnixNano()
 	err = s.pool.QueryRow(ctx, `SELECT customer_id, expire FROM customers_tokens WHERE token = $1`, token).Scan(&id, &expiredTime)
 	if err != nil {
-		log.Print(err)
+		logger.FromContext(ctx).Error("security.AuthenticateCustomer", logger.Err(err))
 		return 0, ErrNoSuchUser
 	}
 
@@ -91,6 +101,8 @@ func (s *Service) AuthenticateCustomer(ctx context.Context, token string,) (id i
 }
 
 func (s *Service) TokenForCustomer(ctx context.Context, phone string, password string) (token string, err error) {
+	ctx, span := tracing.Start(ctx, "security.TokenForCustomer")
+	defer tracing.End(span, &err)
 	var hash string
 	var id int64
 	err = s.pool.QueryRow(ctx, 
@@ -104,7 +116,9 @@ func (s *Service) TokenForCustomer(ctx context.Context, phone string, password s
 		return "", ErrInternal
 	}
 
+	_, compareSpan := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	compareSpan.End()
 	if err != nil {
 		return "", ErrInvalidPassword
 	}
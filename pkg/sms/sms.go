@@ -0,0 +1,64 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Gateway sends text messages, production deployments plug in a provider,
+// console and file gateways are stand-ins for local use
+type Gateway interface {
+	Send(ctx context.Context, to string, text string) error
+}
+
+type record struct {
+	To   string    `json:"to"`
+	Text string    `json:"text"`
+	Sent time.Time `json:"sent"`
+}
+
+// WriterGateway writes messages as JSON lines instead of sending them
+type WriterGateway struct {
+	mu   sync.Mutex
+	w    io.Writer
+	path string
+}
+
+// NewConsoleGateway creates gateway printing messages to w, e.g. os.Stdout
+func NewConsoleGateway(w io.Writer) *WriterGateway {
+	return &WriterGateway{w: w}
+}
+
+// NewFileGateway creates gateway appending messages to file at path
+func NewFileGateway(path string) *WriterGateway {
+	return &WriterGateway{path: path}
+}
+
+func (g *WriterGateway) Send(ctx context.Context, to string, text string) error {
+	data, err := json.Marshal(record{To: to, Text: text, Sent: time.Now()})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.path == "" {
+		_, err = g.w.Write(data)
+		return err
+	}
+	file, err := os.OpenFile(g.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
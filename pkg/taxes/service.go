@@ -0,0 +1,174 @@
+package taxes
+
+import (
+	"context"
+	"errors"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+	"github.com/darkside1809/gosql/pkg/audit"
+	"github.com/darkside1809/gosql/pkg/tracing"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var ErrNotFound = apperr.New(apperr.KindNotFound, "tax_class_not_found", "tax class not found")
+var ErrInternal = apperr.New(apperr.KindInternal, "internal", "internal error")
+var ErrCodeUsed = apperr.New(apperr.KindConflict, "tax_class_code_used", "tax class with the code exists")
+var ErrRateExists = apperr.New(apperr.KindConflict, "tax_rate_exists", "tax class has rate effective at the time")
+
+// Service manages tax classes and rates
+type Service struct {
+	pool *pgxpool.Pool
+}
+
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool}
+}
+
+// Classes returns every class with its rates, latest first
+func (s *Service) Classes(ctx context.Context) (items []*Class, err error) {
+	ctx, span := tracing.Start(ctx, "taxes.Classes")
+	defer tracing.End(span, &err)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT c.id, c.code, c.name, c.created,
+				COALESCE(r.id, 0), COALESCE(r.rate, 0), COALESCE(r.effective, c.created), COALESCE(r.created, c.created),
+				COALESCE((SELECT rate FROM tax_rates WHERE class_id = c.id AND effective <= CURRENT_TIMESTAMP
+					ORDER BY effective DESC LIMIT 1), 0)
+			FROM tax_classes c LEFT JOIN tax_rates r ON r.class_id = c.id
+			ORDER BY c.id, r.effective DESC`)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer rows.Close()
+
+	items = make([]*Class, 0)
+	var class *Class
+	for rows.Next() {
+		item := &Class{Rates: make([]*Rate, 0)}
+		rate := &Rate{}
+		err = rows.Scan(&item.ID, &item.Code, &item.Name, &item.Created, &rate.ID, &rate.Rate, &rate.Effective, &rate.Created, &item.Rate)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		if class == nil || class.ID != item.ID {
+			class = item
+			items = append(items, class)
+		}
+		// class without rates has one row with zero rate id
+		if rate.ID != 0 {
+			rate.ClassID = class.ID
+			class.Rates = append(class.Rates, rate)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return items, nil
+}
+
+// SaveClass creates class when ID is zero and renames it otherwise, rates
+// are added with AddRate
+func (s *Service) SaveClass(ctx context.Context, item *Class) (saved *Class, err error) {
+	ctx, span := tracing.Start(ctx, "taxes.SaveClass")
+	defer tracing.End(span, &err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	saved = &Class{Rates: make([]*Rate, 0)}
+	if item.ID == 0 {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO tax_classes(code, name) VALUES($1, $2) ON CONFLICT (code) DO NOTHING
+				RETURNING id, code, name, created`, item.Code, item.Name).Scan(
+			&saved.ID, &saved.Code, &saved.Name, &saved.Created)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCodeUsed
+		}
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		err = audit.Record(ctx, tx, "tax_class.create", "tax_class", saved.ID, nil, saved)
+	} else {
+		before := &Class{}
+		err = tx.QueryRow(ctx, `
+			SELECT id, code, name, created FROM tax_classes WHERE id = $1 FOR UPDATE`, item.ID).Scan(
+			&before.ID, &before.Code, &before.Name, &before.Created)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		used := false
+		err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM tax_classes WHERE code = $1 AND id <> $2)`, item.Code, item.ID).Scan(&used)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		if used {
+			return nil, ErrCodeUsed
+		}
+		err = tx.QueryRow(ctx, `
+			UPDATE tax_classes SET code = $2, name = $3 WHERE id = $1
+				RETURNING id, code, name, created`, item.ID, item.Code, item.Name).Scan(
+			&saved.ID, &saved.Code, &saved.Name, &saved.Created)
+		if err != nil {
+			return nil, ErrInternal.Wrap(err)
+		}
+		err = audit.Record(ctx, tx, "tax_class.update", "tax_class", saved.ID, before, saved)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return saved, nil
+}
+
+// AddRate adds rate to the class, it applies to sales made from its
+// effective time, stored sales keep their taxes
+func (s *Service) AddRate(ctx context.Context, classID int64, item *Rate) (saved *Rate, err error) {
+	ctx, span := tracing.Start(ctx, "taxes.AddRate")
+	defer tracing.End(span, &err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	exists := false
+	err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM tax_classes WHERE id = $1)`, classID).Scan(&exists)
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	saved = &Rate{}
+	// stored times are UTC
+	err = tx.QueryRow(ctx, `
+		INSERT INTO tax_rates(class_id, rate, effective) VALUES($1, $2, $3) ON CONFLICT (class_id, effective) DO NOTHING
+			RETURNING id, class_id, rate, effective, created`, classID, item.Rate, item.Effective.UTC()).Scan(
+		&saved.ID, &saved.ClassID, &saved.Rate, &saved.Effective, &saved.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRateExists
+	}
+	if err == nil {
+		err = audit.Record(ctx, tx, "tax_rate.create", "tax_class", classID, nil, saved)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return nil, ErrInternal.Wrap(err)
+	}
+	return saved, nil
+}
@@ -0,0 +1,44 @@
+// Package taxes keeps tax classes of products and their rates. Rate of a class
+// applies from its effective time until the next rate of the class, so rates
+// are changed ahead of time and past sales keep rates they were made with.
+package taxes
+
+import "time"
+
+// MaxRate is 100% in basis points
+const MaxRate = 10000
+
+// Class groups products taxed at the same rate, e.g. standard or reduced.
+// Rate is the one in effect now, Rates are every rate of the class.
+type Class struct {
+	ID      int64     `json:"id"`
+	Code    string    `json:"code" validate:"required,sku"`
+	Name    string    `json:"name" validate:"required,max=200"`
+	Rate    int       `json:"rate"`
+	Rates   []*Rate   `json:"rates"`
+	Created time.Time `json:"created"`
+}
+
+// Rate of tax class in basis points, e.g. 1500 is 15%, effective from the time
+type Rate struct {
+	ID        int64     `json:"id"`
+	ClassID   int64     `json:"class_id"`
+	Rate      int       `json:"rate" validate:"min=0,max=10000"`
+	Effective time.Time `json:"effective" validate:"required"`
+	Created   time.Time `json:"created"`
+}
+
+// Compute returns tax of the amount at rate in basis points and total paid
+// by customer. Inclusive amount already contains tax, otherwise tax is added
+// to it. Tax is rounded half up to minor unit.
+func Compute(amount int64, rate int, inclusive bool) (tax int64, total int64) {
+	if rate == 0 {
+		return 0, amount
+	}
+	if inclusive {
+		base := int64(MaxRate + rate)
+		return (amount*int64(rate) + base/2) / base, amount
+	}
+	tax = (amount*int64(rate) + MaxRate/2) / MaxRate
+	return tax, amount + tax
+}
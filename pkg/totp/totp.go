@@ -0,0 +1,90 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parameters of codes, they are the defaults of authenticator apps
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// Skew is number of periods before and after current one which are accepted
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns random 160 bit secret in base32
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// URI returns otpauth URI shown as QR code to authenticator apps
+func URI(issuer string, account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(Digits))
+	query.Set("period", strconv.Itoa(int(Period.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Step returns time step of t
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns code of the time step, RFC 6238 with HMAC-SHA1
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", err
+	}
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code := strconv.FormatUint(uint64(value%1000000), 10)
+	return strings.Repeat("0", Digits-len(code)) + code, nil
+}
+
+// Validate checks code at time t, it returns matched step, callers store
+// it and reject codes of the same or earlier steps to prevent replay
+func Validate(secret string, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(t)
+	for step := current - Skew; step <= current+Skew; step++ {
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
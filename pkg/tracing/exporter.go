@@ -0,0 +1,234 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans to a backend
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []*SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// OTLPExporter sends spans to OpenTelemetry collector using OTLP/HTTP with JSON encoding
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewOTLPExporter creates exporter, endpoint is collector base URL, e.g. http://localhost:4318
+func NewOTLPExporter(endpoint string, headers map[string]string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: strings.TrimRight(endpoint, "/") + "/v1/traces",
+		headers:  headers,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, service string, spans []*SpanData) error {
+	body, err := json.Marshal(otlpRequest(service, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return errors.New("otlp: collector responded " + resp.Status)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// WriterExporter writes spans as JSON lines, used with stdout or a file for offline use
+type WriterExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriterExporter creates exporter writing to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewFileExporter creates exporter appending to file at path
+func NewFileExporter(path string) (*WriterExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterExporter{w: file, closer: file}, nil
+}
+
+type spanLine struct {
+	Service  string `json:"service"`
+	TraceID  string `json:"trace_id"`
+	SpanID   string `json:"span_id"`
+	ParentID string `json:"parent_id,omitempty"`
+	Duration string `json:"duration"`
+	*SpanData
+}
+
+func (e *WriterExporter) Export(ctx context.Context, service string, spans []*SpanData) error {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	for _, span := range spans {
+		line := spanLine{
+			Service:  service,
+			TraceID:  span.TraceID.String(),
+			SpanID:   span.SpanID.String(),
+			Duration: span.End.Sub(span.Start).String(),
+			SpanData: span,
+		}
+		if span.ParentID.IsValid() {
+			line.ParentID = span.ParentID.String()
+		}
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+// OTLP JSON structures, see opentelemetry-proto trace/v1
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpEvent struct {
+	Name         string         `json:"name"`
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+func otlpRequest(service string, spans []*SpanData) map[string]interface{} {
+	items := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		item := otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+			Status:            otlpStatus{Code: span.StatusCode, Message: span.StatusMessage},
+		}
+		if span.ParentID.IsValid() {
+			item.ParentSpanID = span.ParentID.String()
+		}
+		for _, event := range span.Events {
+			item.Events = append(item.Events, otlpEvent{
+				Name:         event.Name,
+				TimeUnixNano: strconv.FormatInt(event.Time.UnixNano(), 10),
+				Attributes:   otlpAttributes(event.Attributes),
+			})
+		}
+		items = append(items, item)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": service}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "github.com/darkside1809/gosql/pkg/tracing"},
+						"spans": items,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	items := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch v := attributes[key].(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		items = append(items, otlpKeyValue{Key: key, Value: value})
+	}
+	return items
+}
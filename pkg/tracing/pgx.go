@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// QueryLogger is pgx logger recording a client span for every query,
+// only SQL text is attached, bound parameters are never recorded.
+// pgx reports queries after they finished, so start of the span is
+// computed from the reported duration.
+type QueryLogger struct{}
+
+// NewQueryLogger creates logger for pgx.ConnConfig.Logger, the config
+// must have LogLevel at least pgx.LogLevelInfo
+func NewQueryLogger() *QueryLogger {
+	return &QueryLogger{}
+}
+
+func (l *QueryLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if ctx == nil || SpanFromContext(ctx) == nil {
+		// queries outside of traced requests, e.g. pool health checks
+		return
+	}
+	sql, ok := data["sql"].(string)
+	if !ok {
+		return
+	}
+
+	end := time.Now()
+	start := end
+	if took, ok := data["time"].(time.Duration); ok {
+		start = end.Add(-took)
+	}
+	_, span := Start(ctx, "db "+msg, WithKind(KindClient), WithStart(start), WithAttributes(map[string]interface{}{
+		"db.system":    "postgresql",
+		"db.statement": sql,
+	}))
+	if tag, ok := data["commandTag"]; ok {
+		span.SetAttribute("db.command_tag", fmt.Sprint(tag))
+	}
+	if rows, ok := data["rowCount"].(int); ok {
+		span.SetAttribute("db.rows", rows)
+	}
+	if err, ok := data["err"].(error); ok && level <= pgx.LogLevelError {
+		span.RecordError(err)
+	}
+	span.EndAt(end)
+}
@@ -0,0 +1,357 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/darkside1809/gosql/pkg/logger"
+)
+
+// TraceID identifies all spans of one request
+type TraceID [16]byte
+
+// SpanID identifies single span
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// Kind of the span, values match OTLP
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Status codes of the span, values match OTLP
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// Event is a timestamped annotation of the span
+type Event struct {
+	Name       string                 `json:"name"`
+	Time       time.Time              `json:"time"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// SpanData is a finished span passed to exporters
+type SpanData struct {
+	TraceID       TraceID                `json:"-"`
+	SpanID        SpanID                 `json:"-"`
+	ParentID      SpanID                 `json:"-"`
+	Name          string                 `json:"name"`
+	Kind          Kind                   `json:"kind"`
+	Start         time.Time              `json:"start"`
+	End           time.Time              `json:"end"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Events        []Event                `json:"events,omitempty"`
+	StatusCode    int                    `json:"status_code"`
+	StatusMessage string                 `json:"status_message,omitempty"`
+}
+
+// Span is an operation being traced, methods are safe for concurrent use
+type Span struct {
+	mu     sync.Mutex
+	tracer *Tracer
+	data   SpanData
+	ended  bool
+}
+
+// TraceID returns id of the trace span belongs to
+func (s *Span) TraceID() TraceID {
+	return s.data.TraceID
+}
+
+// SpanID returns id of the span
+func (s *Span) SpanID() SpanID {
+	return s.data.SpanID
+}
+
+// SetAttribute attaches key value pair to the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = map[string]interface{}{}
+	}
+	s.data.Attributes[key] = value
+}
+
+// RecordError adds exception event and marks span as failed
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Events = append(s.data.Events, Event{
+		Name:       "exception",
+		Time:       time.Now(),
+		Attributes: map[string]interface{}{"exception.message": err.Error()},
+	})
+	s.data.StatusCode = StatusError
+	s.data.StatusMessage = err.Error()
+}
+
+// SetStatus sets status code of the span
+func (s *Span) SetStatus(code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.StatusCode = code
+	s.data.StatusMessage = message
+}
+
+// End finishes span and hands it to the tracer, repeated calls are ignored
+func (s *Span) End() {
+	s.EndAt(time.Now())
+}
+
+// EndAt finishes span at provided time
+func (s *Span) EndAt(end time.Time) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = end
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.enqueue(&data)
+}
+
+// Option changes span on start
+type Option func(*SpanData)
+
+// WithKind sets kind of the span
+func WithKind(kind Kind) Option {
+	return func(d *SpanData) { d.Kind = kind }
+}
+
+// WithStart sets start time, used for operations reported after they finished
+func WithStart(start time.Time) Option {
+	return func(d *SpanData) { d.Start = start }
+}
+
+// WithAttributes sets initial attributes of the span
+func WithAttributes(attributes map[string]interface{}) Option {
+	return func(d *SpanData) {
+		if d.Attributes == nil {
+			d.Attributes = map[string]interface{}{}
+		}
+		for k, v := range attributes {
+			d.Attributes[k] = v
+		}
+	}
+}
+
+type contextKey struct {
+	name string
+}
+
+var spanContextKey = &contextKey{"span"}
+var remoteContextKey = &contextKey{"remote span"}
+
+type remoteParent struct {
+	traceID TraceID
+	spanID  SpanID
+}
+
+// SpanFromContext returns current span or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey).(*Span)
+	return span
+}
+
+// Start creates child span of the span in context using default tracer
+func Start(ctx context.Context, name string, opts ...Option) (context.Context, *Span) {
+	return Default().Start(ctx, name, opts...)
+}
+
+// Tracer creates spans and passes finished ones to exporters in batches
+type Tracer struct {
+	service   string
+	exporters []Exporter
+	queue     chan *SpanData
+	flush     chan chan struct{}
+	done      chan struct{}
+	interval  time.Duration
+	batchSize int
+}
+
+// NewTracer creates tracer, without exporters spans are dropped
+func NewTracer(service string, exporters ...Exporter) *Tracer {
+	t := &Tracer{
+		service:   service,
+		exporters: exporters,
+		queue:     make(chan *SpanData, 4096),
+		flush:     make(chan chan struct{}),
+		done:      make(chan struct{}),
+		interval:  5 * time.Second,
+		batchSize: 512,
+	}
+	if len(exporters) != 0 {
+		go t.run()
+	}
+	return t
+}
+
+var std = NewTracer("gosql")
+
+// Default returns tracer used by Start
+func Default() *Tracer {
+	return std
+}
+
+// SetDefault replaces default tracer
+func SetDefault(t *Tracer) {
+	std = t
+}
+
+// Start creates child span of the span in context
+func (t *Tracer) Start(ctx context.Context, name string, opts ...Option) (context.Context, *Span) {
+	data := SpanData{Name: name, Kind: KindInternal, Start: time.Now()}
+	if parent := SpanFromContext(ctx); parent != nil {
+		data.TraceID = parent.TraceID()
+		data.ParentID = parent.SpanID()
+	} else if remote, ok := ctx.Value(remoteContextKey).(remoteParent); ok {
+		data.TraceID = remote.traceID
+		data.ParentID = remote.spanID
+	} else {
+		_, _ = rand.Read(data.TraceID[:])
+	}
+	_, _ = rand.Read(data.SpanID[:])
+	for _, opt := range opts {
+		opt(&data)
+	}
+
+	span := &Span{tracer: t, data: data}
+	return context.WithValue(ctx, spanContextKey, span), span
+}
+
+func (t *Tracer) enqueue(data *SpanData) {
+	if len(t.exporters) == 0 {
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+		logger.Default().Warn("tracing queue is full, span dropped", logger.F("span", data.Name))
+	}
+}
+
+func (t *Tracer) run() {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	batch := make([]*SpanData, 0, t.batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		for _, exporter := range t.exporters {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := exporter.Export(ctx, t.service, batch)
+			cancel()
+			if err != nil {
+				logger.Default().Warn("export spans", logger.Err(err), logger.F("spans", len(batch)))
+			}
+		}
+		batch = make([]*SpanData, 0, t.batchSize)
+	}
+
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) >= t.batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case reply := <-t.flush:
+			for len(t.queue) > 0 {
+				batch = append(batch, <-t.queue)
+			}
+			export()
+			close(reply)
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Shutdown exports queued spans and closes exporters
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if len(t.exporters) == 0 {
+		return nil
+	}
+	reply := make(chan struct{})
+	select {
+	case t.flush <- reply:
+		<-reply
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	close(t.done)
+
+	var err error
+	for _, exporter := range t.exporters {
+		if e := exporter.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// TraceparentHeader is W3C trace context header
+const TraceparentHeader = "traceparent"
+
+// Extract reads W3C traceparent header and makes it parent of spans started from ctx
+func Extract(ctx context.Context, header http.Header) context.Context {
+	parts := strings.Split(strings.TrimSpace(header.Get(TraceparentHeader)), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+	var remote remoteParent
+	if _, err := hex.Decode(remote.traceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(remote.spanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	if !remote.traceID.IsValid() || !remote.spanID.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteContextKey, remote)
+}
+
+// Inject writes traceparent header of the span in context
+func Inject(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set(TraceparentHeader, "00-"+span.TraceID().String()+"-"+span.SpanID().String()+"-01")
+}
+
+// End finishes span and records error pointed by err, it's deferred by
+// functions with named error result: defer tracing.End(span, &err)
+func End(span *Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+	}
+	span.End()
+}
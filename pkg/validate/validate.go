@@ -0,0 +1,242 @@
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/darkside1809/gosql/pkg/apperr"
+)
+
+// ErrFailed is returned when request has invalid fields, details list every field
+var ErrFailed = apperr.New(apperr.KindUnprocessable, "validation_failed", "request validation failed")
+
+// E164 matches phone numbers in international format, e.g. +992000000001
+var E164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// SKU matches stock keeping units: letters, digits, dots, dashes and underscores
+var SKU = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Barcode matches digits of EAN-8, UPC-A, EAN-13 and GTIN-14 codes
+var Barcode = regexp.MustCompile(`^([0-9]{8}|[0-9]{12,14})$`)
+
+// Currency matches ISO 4217 currency codes, e.g. USD
+var Currency = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// CheckDigit reports whether the last digit of GTIN code is its check
+// digit: digits are weighted 3 and 1 from the right, the sum with check
+// digit is a multiple of ten
+func CheckDigit(code string) bool {
+	if !Barcode.MatchString(code) {
+		return false
+	}
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		digit := int(code[i] - '0')
+		if (len(code)-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// Struct checks fields of v against rules declared in `validate` tags.
+// Supported rules:
+//
+//	required   string is not blank, number is not zero, slice is not empty
+//	min=N      minimal length of string or slice, minimal value of number
+//	max=N      maximal length of string or slice, maximal value of number
+//	phone      string is a phone number in E.164 format
+//	oneof=a b  string is one of listed values
+//	url        string is absolute http or https URL
+//	sku        string is a stock keeping unit of up to 64 characters
+//	barcode    string is EAN-8, UPC-A, EAN-13 or GTIN-14 with valid check digit
+//	currency   string is ISO 4217 currency code in upper case
+//
+// min and max compare amounts of money by their minor units.
+// Nested structs and slices of structs are checked too.
+func Struct(v interface{}) error {
+	var details []apperr.Detail
+	check(reflect.ValueOf(v), "", &details)
+	if len(details) != 0 {
+		return ErrFailed.WithDetails(details...)
+	}
+	return nil
+}
+
+func check(v reflect.Value, prefix string, details *[]apperr.Detail) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := fieldName(field)
+			if name == "-" {
+				continue
+			}
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			value := v.Field(i)
+			for _, rule := range rules(field.Tag.Get("validate")) {
+				if message := apply(rule, value); message != "" {
+					*details = append(*details, apperr.Detail{Field: name, Rule: rule.name, Message: message})
+					break
+				}
+			}
+			check(value, name, details)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			name := prefix + "[" + strconv.Itoa(i) + "]"
+			item := v.Index(i)
+			if item.Kind() == reflect.Ptr && item.IsNil() {
+				*details = append(*details, apperr.Detail{Field: name, Rule: "required", Message: "is required"})
+				continue
+			}
+			check(item, name, details)
+		}
+	}
+}
+
+func fieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+type rule struct {
+	name string
+	arg  string
+}
+
+func rules(tag string) []rule {
+	items := make([]rule, 0)
+	if tag == "" {
+		return items
+	}
+	for _, part := range strings.Split(tag, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		item := rule{name: strings.TrimSpace(kv[0])}
+		if len(kv) == 2 {
+			item.arg = strings.TrimSpace(kv[1])
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// apply returns empty string when value satisfies the rule
+func apply(r rule, v reflect.Value) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if r.name == "required" {
+				return "is required"
+			}
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch r.name {
+	case "required":
+		if isZero(v) {
+			return "is required"
+		}
+	case "min", "max":
+		limit, err := strconv.ParseFloat(r.arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: bad %s argument %q", r.name, r.arg))
+		}
+		size, unit := measure(v)
+		if r.name == "min" && size < limit {
+			return "must be at least " + r.arg + unit
+		}
+		if r.name == "max" && size > limit {
+			return "must be at most " + r.arg + unit
+		}
+	case "phone":
+		if v.Kind() == reflect.String && v.String() != "" && !E164.MatchString(v.String()) {
+			return "must be a phone number in E.164 format"
+		}
+	case "oneof":
+		if v.Kind() == reflect.String && v.String() != "" {
+			for _, allowed := range strings.Fields(r.arg) {
+				if v.String() == allowed {
+					return ""
+				}
+			}
+			return "must be one of: " + r.arg
+		}
+	case "url":
+		if v.Kind() == reflect.String && v.String() != "" {
+			u, err := url.Parse(v.String())
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return "must be absolute http or https URL"
+			}
+		}
+	case "sku":
+		if v.Kind() == reflect.String && v.String() != "" && !SKU.MatchString(v.String()) {
+			return "must be up to 64 letters, digits, dots, dashes or underscores"
+		}
+	case "barcode":
+		if v.Kind() == reflect.String && v.String() != "" && !CheckDigit(v.String()) {
+			return "must be EAN-8, UPC-A, EAN-13 or GTIN-14 with valid check digit"
+		}
+	case "currency":
+		if v.Kind() == reflect.String && v.String() != "" && !Currency.MatchString(v.String()) {
+			return "must be ISO 4217 currency code, e.g. USD"
+		}
+	default:
+		panic("validate: unknown rule " + r.name)
+	}
+	return ""
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// measure returns length of strings and collections, the value of numbers
+// or minor units of amounts
+func measure(v reflect.Value) (float64, string) {
+	if amount, ok := v.Interface().(interface{ Minor() int64 }); ok {
+		return float64(amount.Minor()), ""
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	panic("validate: min/max is not supported for " + v.Kind().String())
+}